@@ -0,0 +1,304 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Runix-Org/runix/platform/fs"
+	"github.com/mattn/go-sqlite3"
+	"go.uber.org/zap"
+)
+
+// Pages copied per backup step, the source is unlocked between steps
+const backupPagesPerStep = 256
+
+// Backup makes an online copy of the database to path using the SQLite backup API
+func (db *DB) Backup(ctx context.Context, path string) error {
+	if db.conn.closed.Load() {
+		return ErrClosed
+	}
+
+	return classifyError(backupDatabase(ctx, db.readerSQL, path))
+}
+
+// backupDatabase writes a copy of src to a temporary file and renames it to path,
+// so path never contains a partial backup
+func backupDatabase(ctx context.Context, src *sql.DB, path string) error {
+	if _, err := fs.CreateDir(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("create backup dir: %w", err)
+	}
+
+	tmpPath := path + ".tmp"
+	_ = os.Remove(tmpPath)
+	defer os.Remove(tmpPath)
+
+	dst, err := sql.Open("sqlite3", tmpPath)
+	if err != nil {
+		return fmt.Errorf("open backup file: %w", err)
+	}
+	defer dst.Close()
+
+	dstConn, err := dst.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("connect backup file: %w", err)
+	}
+	defer dstConn.Close()
+
+	srcConn, err := src.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("connect db: %w", err)
+	}
+	defer srcConn.Close()
+
+	err = dstConn.Raw(func(dstDriverConn any) error {
+		return srcConn.Raw(func(srcDriverConn any) error {
+			dstSQLite, ok := dstDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("backup file connection is not sqlite3")
+			}
+			srcSQLite, ok := srcDriverConn.(*sqlite3.SQLiteConn)
+			if !ok {
+				return errors.New("db connection is not sqlite3")
+			}
+
+			b, err := dstSQLite.Backup("main", srcSQLite, "main")
+			if err != nil {
+				return err
+			}
+			for {
+				done, err := b.Step(backupPagesPerStep)
+				if err != nil {
+					_ = b.Close()
+					return err
+				}
+				if done {
+					break
+				}
+				if err := ctx.Err(); err != nil {
+					_ = b.Close()
+					return err
+				}
+			}
+			return b.Finish()
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("backup: %w", err)
+	}
+
+	if err := dstConn.Close(); err != nil {
+		return fmt.Errorf("close backup file: %w", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("close backup file: %w", err)
+	}
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("rename backup file: %w", err)
+	}
+
+	return nil
+}
+
+// checkIntegrity runs PRAGMA quick_check, ErrCorrupt is returned for a damaged database
+func checkIntegrity(ctx context.Context, sqlDB *sql.DB) error {
+	rows, err := sqlDB.QueryContext(ctx, "PRAGMA quick_check")
+	if err != nil {
+		return classifyError(err)
+	}
+	defer rows.Close()
+
+	var problems []string
+	for rows.Next() {
+		var line string
+		if err := rows.Scan(&line); err != nil {
+			return classifyError(err)
+		}
+		if line != "ok" {
+			problems = append(problems, line)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return classifyError(err)
+	}
+
+	if len(problems) != 0 {
+		return fmt.Errorf("%w: %s", ErrCorrupt, strings.Join(problems, "; "))
+	}
+	return nil
+}
+
+// checkFileIntegrity opens the database file read-only and checks it
+func checkFileIntegrity(ctx context.Context, path string) error {
+	sqlDB, err := sql.Open("sqlite3", "file:"+path+"?mode=ro")
+	if err != nil {
+		return err
+	}
+	defer sqlDB.Close()
+
+	return checkIntegrity(ctx, sqlDB)
+}
+
+func backupBaseName(cfg *DBConfig) string {
+	return strings.TrimSuffix(filepath.Base(cfg.Path), filepath.Ext(cfg.Path))
+}
+
+// Periodic backups: <name>-<time>.bak
+func periodicBackupPath(cfg *DBConfig, now time.Time) string {
+	return filepath.Join(cfg.BackupDir, fmt.Sprintf("%s-%s.bak", backupBaseName(cfg), now.Format("20060102-150405.000000")))
+}
+
+// Backups made before migrations: <name>.v<version>.<time>.bak
+func migrationBackupPath(cfg *DBConfig, version int, now time.Time) string {
+	return filepath.Join(cfg.BackupDir,
+		fmt.Sprintf("%s.v%d.%s.bak", backupBaseName(cfg), version, now.Format("20060102-150405.000000")))
+}
+
+type backupFile struct {
+	path    string
+	modTime time.Time
+}
+
+// listBackups returns the backups matching pattern, newest first
+func listBackups(cfg *DBConfig, pattern string) []backupFile {
+	paths, _ := filepath.Glob(filepath.Join(cfg.BackupDir, pattern))
+
+	files := make([]backupFile, 0, len(paths))
+	for _, path := range paths {
+		fi, err := os.Stat(path)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue
+		}
+		files = append(files, backupFile{path: path, modTime: fi.ModTime()})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].modTime.Equal(files[j].modTime) {
+			return files[i].path > files[j].path
+		}
+		return files[i].modTime.After(files[j].modTime)
+	})
+	return files
+}
+
+func listPeriodicBackups(cfg *DBConfig) []backupFile {
+	return listBackups(cfg, backupBaseName(cfg)+"-*.bak")
+}
+
+func listAllBackups(cfg *DBConfig) []backupFile {
+	return listBackups(cfg, backupBaseName(cfg)+"*.bak")
+}
+
+// rotateBackups keeps the newest cfg.BackupKeep periodic backups
+func rotateBackups(cfg *DBConfig, logger *zap.Logger) {
+	backups := listPeriodicBackups(cfg)
+	if len(backups) <= cfg.BackupKeep {
+		return
+	}
+
+	for _, b := range backups[cfg.BackupKeep:] {
+		if err := os.Remove(b.path); err != nil {
+			logger.Warn("Failed removing old backup", zap.String("path", b.path), zap.Error(err))
+		}
+	}
+}
+
+// restoreFromBackup moves the damaged database aside and replaces it with the newest good backup.
+// Returns false if there is no usable backup, then the database starts empty.
+func restoreFromBackup(ctx context.Context, cfg *DBConfig, logger *zap.Logger) (bool, error) {
+	corruptPath := fmt.Sprintf("%s.corrupt-%s", cfg.Path, time.Now().Format("20060102-150405"))
+	if err := os.Rename(cfg.Path, corruptPath); err != nil {
+		return false, fmt.Errorf("move corrupted db: %w", err)
+	}
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Rename(cfg.Path+suffix, corruptPath+suffix); err != nil && !os.IsNotExist(err) {
+			return false, fmt.Errorf("move corrupted db %s: %w", suffix, err)
+		}
+	}
+	logger.Warn("Corrupted DB moved aside", zap.String("path", corruptPath))
+
+	for _, b := range listAllBackups(cfg) {
+		if err := checkFileIntegrity(ctx, b.path); err != nil {
+			logger.Warn("Skipping damaged backup", zap.String("path", b.path), zap.Error(err))
+			continue
+		}
+
+		if err := copyFile(b.path, cfg.Path); err != nil {
+			return false, fmt.Errorf("restore backup %s: %w", b.path, err)
+		}
+
+		logger.Warn("DB restored from backup", zap.String("backup", b.path))
+		return true, nil
+	}
+
+	logger.Error("No usable DB backup found, starting with an empty DB")
+	return false, nil
+}
+
+func copyFile(srcPath string, dstPath string) error {
+	src, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	tmpPath := dstPath + ".tmp"
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpPath)
+
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Sync(); err != nil {
+		_ = dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmpPath, dstPath)
+}
+
+// runBackups makes a backup every cfg.BackupInterval until ctx is done.
+// A backup is made at once if the newest one is older than the interval.
+func (db *DB) runBackups(ctx context.Context, cfg *DBConfig) {
+	backup := func() {
+		path := periodicBackupPath(cfg, time.Now())
+		if err := db.Backup(ctx, path); err != nil {
+			if ctx.Err() == nil {
+				db.logger.Warn("Failed periodic DB backup", zap.String("path", path), zap.Error(err))
+			}
+			return
+		}
+		db.logger.Info("DB backup created", zap.String("path", path))
+		rotateBackups(cfg, db.logger)
+	}
+
+	if backups := listPeriodicBackups(cfg); len(backups) == 0 || time.Since(backups[0].modTime) >= cfg.BackupInterval {
+		backup()
+	}
+
+	ticker := time.NewTicker(cfg.BackupInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			backup()
+		}
+	}
+}
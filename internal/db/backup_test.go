@@ -0,0 +1,139 @@
+package db
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+type BackupSuite struct {
+	suite.Suite
+	cfg *DBConfig
+}
+
+func (s *BackupSuite) SetupTest() {
+	s.cfg = newTestConfig(s.T())
+}
+
+func (s *BackupSuite) seed(db *DB) {
+	t := s.T()
+
+	_, err := db.LaunchCount().IncrementMany(context.Background(), "list", "plugin", []string{"a", "a", "b"})
+	require.NoError(t, err)
+}
+
+func (s *BackupSuite) checkSeed(db *DB) {
+	t := s.T()
+
+	counts, err := db.LaunchCount().Get(context.Background(), "list", "plugin")
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint{"a": 2, "b": 1}, counts)
+}
+
+func (s *BackupSuite) corrupt(path string) {
+	t := s.T()
+
+	f, err := os.OpenFile(path, os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte(strings.Repeat("garbage!", 16)), 0)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+}
+
+func (s *BackupSuite) TestManualBackup() {
+	t := s.T()
+	ctx := context.Background()
+
+	db := newTestDB(t, s.cfg)
+	defer db.Close()
+	s.seed(db)
+
+	path := filepath.Join(t.TempDir(), "copy.db")
+	require.NoError(t, db.Backup(ctx, path))
+	require.NoError(t, checkFileIntegrity(ctx, path))
+
+	cfg := newTestConfig(t)
+	cfg.Path = path
+	restored := newTestDB(t, cfg)
+	defer restored.Close()
+	s.checkSeed(restored)
+
+	db.Close()
+	require.ErrorIs(t, db.Backup(ctx, path), ErrClosed)
+}
+
+func (s *BackupSuite) TestPeriodicBackupAndRotation() {
+	t := s.T()
+
+	s.cfg.DisableBackups = false
+	s.cfg.BackupKeep = 2
+	s.cfg.BackupInterval = 20 * time.Millisecond
+
+	db := newTestDB(t, s.cfg)
+	s.seed(db)
+	require.Eventually(t, func() bool {
+		return len(listPeriodicBackups(s.cfg)) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(5 * s.cfg.BackupInterval)
+	db.Close()
+
+	backups := listPeriodicBackups(s.cfg)
+	require.Len(t, backups, 2)
+	for _, b := range backups {
+		require.NoError(t, checkFileIntegrity(context.Background(), b.path))
+	}
+}
+
+func (s *BackupSuite) TestRestoreCorrupted() {
+	t := s.T()
+	ctx := context.Background()
+
+	db := newTestDB(t, s.cfg)
+	s.seed(db)
+	require.NoError(t, db.Backup(ctx, periodicBackupPath(s.cfg, time.Now().Add(-time.Hour))))
+	db.Close()
+
+	// the newest backup is damaged too, the older good one must be used
+	damaged := periodicBackupPath(s.cfg, time.Now())
+	require.NoError(t, copyFile(s.cfg.Path, damaged))
+	s.corrupt(damaged)
+	s.corrupt(s.cfg.Path)
+
+	db, err := New(ctx, s.cfg, zap.NewNop())
+	require.NoError(t, err)
+	defer db.Close()
+	s.checkSeed(db)
+
+	corrupted, err := filepath.Glob(s.cfg.Path + ".corrupt-*")
+	require.NoError(t, err)
+	require.Len(t, corrupted, 1)
+}
+
+func (s *BackupSuite) TestCorruptedWithoutBackup() {
+	t := s.T()
+	ctx := context.Background()
+
+	db := newTestDB(t, s.cfg)
+	s.seed(db)
+	db.Close()
+	s.corrupt(s.cfg.Path)
+
+	db, err := New(ctx, s.cfg, zap.NewNop())
+	require.NoError(t, err)
+	defer db.Close()
+
+	counts, err := db.LaunchCount().Get(ctx, "list", "plugin")
+	require.NoError(t, err)
+	require.Empty(t, counts)
+}
+
+func TestBackupSuite(t *testing.T) {
+	suite.Run(t, new(BackupSuite))
+}
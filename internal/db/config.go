@@ -5,21 +5,38 @@ import (
 	"fmt"
 	"net/url"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/Runix-Org/runix/platform/fs"
+	"github.com/Runix-Org/runix/platform/xdg/base"
 	gormlogger "gorm.io/gorm/logger"
 )
 
 type DBConfig struct {
 	// Path to sqlite file
 	Path string
+	// Directory for backups (default: "backups" next to Path)
+	BackupDir string
+	// Interval of periodic online backups (default: 24h)
+	BackupInterval time.Duration
+	// Number of periodic backups to keep (default: 5)
+	BackupKeep int
+	// Disable periodic backups (default: false)
+	DisableBackups bool
+
+	// Max size of keys and values stored by a plugin in bytes (default: 1 MiB)
+	PluginKVQuota int64
+	// Interval of removing expired plugin keys (default: 10m)
+	PluginKVCleanupInterval time.Duration
 
 	// GORM slow query threshold (default: 250ms)
 	// For logging
 	SlowThreshold time.Duration
 	// GORM log level (default: Warn)
 	LogLevel gormlogger.LogLevel
+	// Receive every executed statement, in addition to DB.Metrics
+	QueryObservers []QueryObserver
 
 	// SQLite busy timeout (default: 10s)
 	BusyTimeout time.Duration
@@ -32,7 +49,7 @@ type DBConfig struct {
 	// Disable foreign keys (default: false)
 	DisableForeignKeys bool
 
-	// Connection pool
+	// Reader connection pool, the writer pool always has a single connection
 	MaxOpenConns    int           // (default: 16)
 	MaxIdleConns    int           // (default: 8)
 	ConnMaxIdleTime time.Duration // (default: 5m)
@@ -41,29 +58,47 @@ type DBConfig struct {
 
 func NewDBConfigDefault(path string, logLevel gormlogger.LogLevel) *DBConfig {
 	return &DBConfig{
-		Path:               path,
-		SlowThreshold:      250 * time.Millisecond,
-		LogLevel:           logLevel,
-		BusyTimeout:        10 * time.Second,
-		MemoryDB:           false,
-		JournalMode:        "WAL",
-		Synchronous:        "NORMAL",
-		DisableForeignKeys: false,
-		MaxOpenConns:       16,
-		MaxIdleConns:       8,
-		ConnMaxIdleTime:    5 * time.Minute,
-		ConnMaxLifetime:    0,
+		Path:                    path,
+		BackupDir:               filepath.Join(base.GetAppDataDir(), "backups"),
+		BackupInterval:          24 * time.Hour,
+		BackupKeep:              5,
+		DisableBackups:          false,
+		PluginKVQuota:           1 << 20,
+		PluginKVCleanupInterval: 10 * time.Minute,
+		SlowThreshold:           250 * time.Millisecond,
+		LogLevel:                logLevel,
+		BusyTimeout:             10 * time.Second,
+		MemoryDB:                false,
+		JournalMode:             "WAL",
+		Synchronous:             "NORMAL",
+		DisableForeignKeys:      false,
+		MaxOpenConns:            16,
+		MaxIdleConns:            8,
+		ConnMaxIdleTime:         5 * time.Minute,
+		ConnMaxLifetime:         0,
 	}
 }
 
 var (
-	ErrInvalidLogLevel = errors.New("invalid db config log level")
-	ErrEmptyPath       = errors.New("empty path in db config")
+	ErrInvalidLogLevel    = errors.New("invalid db config log level")
+	ErrEmptyPath          = errors.New("empty path in db config")
+	ErrUnknownJournalMode = errors.New("unknown journal mode")
+	ErrUnknownSynchronous = errors.New("unknown synchronous mode")
 )
 
+// https://www.sqlite.org/pragma.html#pragma_journal_mode
+var journalModes = map[string]struct{}{
+	"DELETE": {}, "TRUNCATE": {}, "PERSIST": {}, "MEMORY": {}, "WAL": {}, "OFF": {},
+}
+
+// https://www.sqlite.org/pragma.html#pragma_synchronous
+var synchronousModes = map[string]struct{}{
+	"OFF": {}, "NORMAL": {}, "FULL": {}, "EXTRA": {},
+}
+
 func (cfg *DBConfig) validate() error {
 	if cfg.Path == "" {
-		return ErrEmptyPath
+		return &ValidationError{Field: "Path", Reason: ErrEmptyPath}
 	}
 	if !filepath.IsAbs(cfg.Path) {
 		p, err := filepath.Abs(cfg.Path)
@@ -77,6 +112,23 @@ func (cfg *DBConfig) validate() error {
 		return fmt.Errorf("create db dir: %w", err)
 	}
 
+	if cfg.BackupDir == "" {
+		cfg.BackupDir = filepath.Join(filepath.Dir(cfg.Path), "backups")
+	}
+	if cfg.BackupInterval <= 0 {
+		cfg.BackupInterval = 24 * time.Hour
+	}
+	if cfg.BackupKeep <= 0 {
+		cfg.BackupKeep = 5
+	}
+
+	if cfg.PluginKVQuota <= 0 {
+		cfg.PluginKVQuota = 1 << 20
+	}
+	if cfg.PluginKVCleanupInterval <= 0 {
+		cfg.PluginKVCleanupInterval = 10 * time.Minute
+	}
+
 	if cfg.SlowThreshold <= 0 {
 		cfg.SlowThreshold = 250 * time.Millisecond
 	}
@@ -84,7 +136,7 @@ func (cfg *DBConfig) validate() error {
 	if cfg.LogLevel <= 0 {
 		cfg.LogLevel = gormlogger.Warn
 	} else if cfg.LogLevel > gormlogger.Info {
-		return ErrInvalidLogLevel
+		return &ValidationError{Field: "LogLevel", Value: fmt.Sprint(int(cfg.LogLevel)), Reason: ErrInvalidLogLevel}
 	}
 
 	if cfg.BusyTimeout <= 0 {
@@ -98,10 +150,18 @@ func (cfg *DBConfig) validate() error {
 			cfg.JournalMode = "WAL"
 		}
 	}
+	cfg.JournalMode = strings.ToUpper(cfg.JournalMode)
+	if _, ok := journalModes[cfg.JournalMode]; !ok {
+		return &ValidationError{Field: "JournalMode", Value: cfg.JournalMode, Reason: ErrUnknownJournalMode}
+	}
 
 	if cfg.Synchronous == "" {
 		cfg.Synchronous = "NORMAL"
 	}
+	cfg.Synchronous = strings.ToUpper(cfg.Synchronous)
+	if _, ok := synchronousModes[cfg.Synchronous]; !ok {
+		return &ValidationError{Field: "Synchronous", Value: cfg.Synchronous, Reason: ErrUnknownSynchronous}
+	}
 
 	if cfg.MaxOpenConns <= 0 {
 		cfg.MaxOpenConns = 16
@@ -121,13 +181,23 @@ func (cfg *DBConfig) validate() error {
 	return nil
 }
 
+var uriPathReplacer = strings.NewReplacer("%", "%25", "?", "%3f", "#", "%23")
+
+// BuildDSN returns the DSN of the writer connection
 func (cfg *DBConfig) BuildDSN() string {
+	return cfg.buildDSN(false)
+}
+
+func (cfg *DBConfig) buildDSN(readOnly bool) string {
 	// see: https://github.com/mattn/go-sqlite3#connection-string
 	q := url.Values{}
 
-	if cfg.MemoryDB {
+	switch {
+	case cfg.MemoryDB:
 		q.Set("mode", "memory")
-	} else {
+	case readOnly:
+		q.Set("mode", "ro")
+	default:
 		q.Set("mode", "rwc") // read/write/create
 	}
 
@@ -135,12 +205,20 @@ func (cfg *DBConfig) BuildDSN() string {
 	// https://www.sqlite.org/pragma.html#pragma_busy_timeout
 	q.Set("_busy_timeout", fmt.Sprintf("%d", cfg.BusyTimeout.Milliseconds()))
 
-	// https://www.sqlite.org/pragma.html#pragma_journal_mode
-	q.Set("_journal_mode", cfg.JournalMode)
+	if !readOnly {
+		// Take the write lock at BEGIN, a deferred transaction that is upgraded
+		// to a write one fails at once with SQLITE_BUSY
+		// https://www.sqlite.org/lang_transaction.html
+		q.Set("_txlock", "immediate")
 
-	// Balance of reliability/speed
-	// https://www.sqlite.org/pragma.html#pragma_synchronous
-	q.Set("_synchronous", cfg.Synchronous)
+		// Set by the writer, it is persistent for WAL
+		// https://www.sqlite.org/pragma.html#pragma_journal_mode
+		q.Set("_journal_mode", cfg.JournalMode)
+
+		// Balance of reliability/speed
+		// https://www.sqlite.org/pragma.html#pragma_synchronous
+		q.Set("_synchronous", cfg.Synchronous)
+	}
 
 	// https://www.sqlite.org/pragma.html#pragma_foreign_keys
 	if cfg.DisableForeignKeys {
@@ -149,6 +227,8 @@ func (cfg *DBConfig) BuildDSN() string {
 		q.Set("_foreign_keys", "1")
 	}
 
-	dsn := cfg.Path + "?" + q.Encode()
+	// mode is only applied to URI file names
+	// https://www.sqlite.org/uri.html
+	dsn := "file:" + uriPathReplacer.Replace(cfg.Path) + "?" + q.Encode()
 	return dsn
 }
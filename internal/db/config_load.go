@@ -0,0 +1,176 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Runix-Org/runix/platform/fs"
+	"github.com/Runix-Org/runix/platform/xdg/base"
+	"gopkg.in/ini.v1"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+const (
+	// Section of the config file with database settings
+	ConfigSection = "database"
+	// Prefix of environment variables overriding the config file
+	ConfigEnvPrefix = "RUNIX_DB_"
+)
+
+var (
+	ErrInvalidDuration = errors.New("must be a duration like 500ms or 10s")
+	ErrInvalidNumber   = errors.New("must be a positive integer")
+)
+
+// Keys of the [database] section, each one can be overridden by
+// RUNIX_DB_<KEY in upper case>, e.g. RUNIX_DB_BUSY_TIMEOUT=5s
+//
+//	[database]
+//	path = ~/.local/share/runix/runix.db
+//	journal_mode = WAL
+//	synchronous = NORMAL
+//	busy_timeout = 10s
+//	max_open_conns = 16
+//	max_idle_conns = 8
+//	log_level = warn
+var configKeys = []struct {
+	name string
+	set  func(cfg *DBConfig, value string) error
+}{
+	{"path", func(cfg *DBConfig, v string) error {
+		cfg.Path = fs.ExpandUser(v)
+		return nil
+	}},
+	{"journal_mode", func(cfg *DBConfig, v string) error {
+		cfg.JournalMode = v
+		return nil
+	}},
+	{"synchronous", func(cfg *DBConfig, v string) error {
+		cfg.Synchronous = v
+		return nil
+	}},
+	{"busy_timeout", func(cfg *DBConfig, v string) error {
+		return parseDurationField("BusyTimeout", v, &cfg.BusyTimeout)
+	}},
+	{"max_open_conns", func(cfg *DBConfig, v string) error {
+		return parseNumberField("MaxOpenConns", v, &cfg.MaxOpenConns)
+	}},
+	{"max_idle_conns", func(cfg *DBConfig, v string) error {
+		return parseNumberField("MaxIdleConns", v, &cfg.MaxIdleConns)
+	}},
+	{"log_level", func(cfg *DBConfig, v string) error {
+		return parseLogLevelField("LogLevel", v, &cfg.LogLevel)
+	}},
+}
+
+// DefaultConfigFile is the config file in the application config dir
+func DefaultConfigFile() string {
+	return filepath.Join(base.GetAppConfigDir(), "config.ini")
+}
+
+// NewDBConfig builds the config from the defaults, the [database] section of
+// configPath and RUNIX_DB_* environment variables, in this order.
+// A missing config file is not an error.
+func NewDBConfig(configPath string) (*DBConfig, error) {
+	cfg := NewDBConfigDefault(filepath.Join(base.GetAppDataDir(), "runix.db"), gormlogger.Warn)
+	if err := cfg.LoadFile(configPath); err != nil {
+		return nil, err
+	}
+	if err := cfg.LoadEnv(); err != nil {
+		return nil, err
+	}
+	if err := cfg.validate(); err != nil {
+		return nil, fmt.Errorf("validate db config: %w", err)
+	}
+
+	return cfg, nil
+}
+
+// LoadFile overrides the config with the [database] section of the ini file at path
+func (cfg *DBConfig) LoadFile(path string) error {
+	if !fs.ExistsFile(path) {
+		return nil
+	}
+
+	file, err := ini.Load(path)
+	if err != nil {
+		return fmt.Errorf("load config file %s: %w", path, err)
+	}
+	sect, err := file.GetSection(ConfigSection)
+	if err != nil {
+		return nil
+	}
+
+	for _, key := range configKeys {
+		if !sect.HasKey(key.name) {
+			continue
+		}
+		if err := key.set(cfg, strings.TrimSpace(sect.Key(key.name).String())); err != nil {
+			return fmt.Errorf("config file %s [%s] %s: %w", path, ConfigSection, key.name, err)
+		}
+	}
+
+	return nil
+}
+
+// LoadEnv overrides the config with RUNIX_DB_* environment variables
+func (cfg *DBConfig) LoadEnv() error {
+	return cfg.loadEnv(os.LookupEnv)
+}
+
+func (cfg *DBConfig) loadEnv(lookup func(string) (string, bool)) error {
+	for _, key := range configKeys {
+		name := ConfigEnvPrefix + strings.ToUpper(key.name)
+		value, ok := lookup(name)
+		if !ok {
+			continue
+		}
+		if err := key.set(cfg, strings.TrimSpace(value)); err != nil {
+			return fmt.Errorf("env %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+func parseDurationField(field string, value string, dst *time.Duration) error {
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return &ValidationError{Field: field, Value: value, Reason: ErrInvalidDuration}
+	}
+
+	*dst = d
+	return nil
+}
+
+func parseNumberField(field string, value string, dst *int) error {
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return &ValidationError{Field: field, Value: value, Reason: ErrInvalidNumber}
+	}
+
+	*dst = n
+	return nil
+}
+
+var logLevels = map[string]gormlogger.LogLevel{
+	"silent": gormlogger.Silent,
+	"error":  gormlogger.Error,
+	"warn":   gormlogger.Warn,
+	"info":   gormlogger.Info,
+}
+
+func parseLogLevelField(field string, value string, dst *gormlogger.LogLevel) error {
+	level, ok := logLevels[strings.ToLower(value)]
+	if !ok {
+		return &ValidationError{Field: field, Value: value, Reason: ErrInvalidLogLevel}
+	}
+
+	*dst = level
+	return nil
+}
@@ -0,0 +1,133 @@
+package db
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type ConfigSuite struct {
+	suite.Suite
+	dir string
+}
+
+func (s *ConfigSuite) SetupTest() {
+	s.dir = s.T().TempDir()
+}
+
+func (s *ConfigSuite) writeConfig(content string) string {
+	path := filepath.Join(s.dir, "config.ini")
+	require.NoError(s.T(), os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func envLookup(env map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+}
+
+func (s *ConfigSuite) TestLoadFileAndEnv() {
+	t := s.T()
+
+	cfg := newTestConfig(t)
+	path := s.writeConfig(`
+[other]
+path = /ignored.db
+
+[database]
+path = ` + filepath.Join(s.dir, "file.db") + `
+journal_mode = truncate
+synchronous = full
+busy_timeout = 3s
+max_open_conns = 4
+max_idle_conns = 2
+log_level = info
+`)
+	require.NoError(t, cfg.LoadFile(path))
+	require.NoError(t, cfg.loadEnv(envLookup(map[string]string{
+		"RUNIX_DB_BUSY_TIMEOUT": "500ms",
+		"RUNIX_DB_LOG_LEVEL":    "Error",
+		"RUNIX_DB_PATH":         filepath.Join(s.dir, "env.db"),
+	})))
+	require.NoError(t, cfg.validate())
+
+	require.Equal(t, filepath.Join(s.dir, "env.db"), cfg.Path)
+	require.Equal(t, "TRUNCATE", cfg.JournalMode)
+	require.Equal(t, "FULL", cfg.Synchronous)
+	require.Equal(t, 500*time.Millisecond, cfg.BusyTimeout)
+	require.Equal(t, 4, cfg.MaxOpenConns)
+	require.Equal(t, 2, cfg.MaxIdleConns)
+	require.Equal(t, gormlogger.Error, cfg.LogLevel)
+}
+
+func (s *ConfigSuite) TestMissingFileOrSection() {
+	t := s.T()
+
+	cfg := newTestConfig(t)
+	require.NoError(t, cfg.LoadFile(filepath.Join(s.dir, "missing.ini")))
+	require.NoError(t, cfg.LoadFile(s.writeConfig("[other]\nkey = value\n")))
+	require.NoError(t, cfg.validate())
+	require.Equal(t, "WAL", cfg.JournalMode)
+}
+
+func (s *ConfigSuite) TestInvalidValues() {
+	for _, tc := range []struct {
+		key    string
+		value  string
+		field  string
+		reason error
+	}{
+		{"busy_timeout", "10", "BusyTimeout", ErrInvalidDuration},
+		{"busy_timeout", "-1s", "BusyTimeout", ErrInvalidDuration},
+		{"max_open_conns", "many", "MaxOpenConns", ErrInvalidNumber},
+		{"max_idle_conns", "0", "MaxIdleConns", ErrInvalidNumber},
+		{"log_level", "debug", "LogLevel", ErrInvalidLogLevel},
+		{"journal_mode", "fast", "JournalMode", ErrUnknownJournalMode},
+		{"synchronous", "always", "Synchronous", ErrUnknownSynchronous},
+	} {
+		s.Run(tc.key+"="+tc.value, func() {
+			t := s.T()
+
+			cfg := newTestConfig(t)
+			err := cfg.LoadFile(s.writeConfig("[database]\n" + tc.key + " = " + tc.value + "\n"))
+			if err == nil {
+				err = cfg.validate()
+			}
+			var verr *ValidationError
+			require.ErrorAs(t, err, &verr)
+			require.Equal(t, tc.field, verr.Field)
+			require.ErrorIs(t, err, tc.reason)
+
+			cfg = newTestConfig(t)
+			err = cfg.loadEnv(envLookup(map[string]string{ConfigEnvPrefix + strings.ToUpper(tc.key): tc.value}))
+			if err == nil {
+				err = cfg.validate()
+			}
+			require.ErrorIs(t, err, tc.reason)
+		})
+	}
+}
+
+func (s *ConfigSuite) TestValidate() {
+	t := s.T()
+
+	cfg := newTestConfig(t)
+	cfg.Path = ""
+	require.ErrorIs(t, cfg.validate(), ErrEmptyPath)
+
+	cfg = newTestConfig(t)
+	cfg.LogLevel = gormlogger.Info + 1
+	require.ErrorIs(t, cfg.validate(), ErrInvalidLogLevel)
+}
+
+func TestConfigSuite(t *testing.T) {
+	suite.Run(t, new(ConfigSuite))
+}
@@ -0,0 +1,87 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+const (
+	busyRetryAttempts = 5
+	busyRetryDelay    = 20 * time.Millisecond
+	busyRetryMaxDelay = 500 * time.Millisecond
+)
+
+// conn is shared by all repositories.
+// It routes reads and writes to their pools, tracks the closed state,
+// classifies errors and retries busy writes.
+type conn struct {
+	writer *gorm.DB
+	reader *gorm.DB
+	closed atomic.Bool
+	logger *zap.Logger
+}
+
+func newConn(writer *gorm.DB, reader *gorm.DB, logger *zap.Logger) *conn {
+	return &conn{
+		writer: writer,
+		reader: reader,
+		logger: logger,
+	}
+}
+
+// read runs fn on the read-only pool
+func (c *conn) read(ctx context.Context, fn func(db *gorm.DB) error) error {
+	if c.closed.Load() {
+		return ErrClosed
+	}
+
+	ctx = withCallerOp(ctx, 1)
+	return classifyError(fn(c.reader.WithContext(ctx)))
+}
+
+// write runs fn on the writer connection and retries it with backoff while the database
+// is busy (locked by another process).
+// fn must be idempotent if it is not wrapped in a transaction.
+func (c *conn) write(ctx context.Context, fn func(db *gorm.DB) error) error {
+	ctx = withCallerOp(ctx, 1)
+	delay := busyRetryDelay
+	for attempt := 1; ; attempt++ {
+		if c.closed.Load() {
+			return ErrClosed
+		}
+
+		err := classifyError(fn(c.writer.WithContext(ctx)))
+		if !errors.Is(err, ErrBusy) || attempt == busyRetryAttempts {
+			return err
+		}
+
+		c.logger.Debug("Database is busy, retrying write",
+			zap.Int("attempt", attempt),
+			zap.Duration("delay", delay),
+			zap.Error(err),
+		)
+
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, busyRetryMaxDelay)
+	}
+}
+
+// transaction is a write where fn runs in a single BEGIN IMMEDIATE transaction
+func (c *conn) transaction(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return c.write(withCallerOp(ctx, 1), func(db *gorm.DB) error {
+		return db.Transaction(fn)
+	})
+}
+
+func (c *conn) close() {
+	c.closed.Store(true)
+}
@@ -0,0 +1,130 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type ConnSuite struct {
+	suite.Suite
+	cfg *DBConfig
+	db  *DB
+}
+
+func (s *ConnSuite) SetupTest() {
+	t := s.T()
+
+	s.cfg = newTestConfig(t)
+	s.db = newTestDB(t, s.cfg)
+}
+
+func (s *ConnSuite) TearDownTest() {
+	s.db.Close()
+}
+
+func (s *ConnSuite) TestPools() {
+	t := s.T()
+	ctx := context.Background()
+
+	require.Equal(t, 1, s.db.writerSQL.Stats().MaxOpenConnections)
+	require.Equal(t, s.cfg.MaxOpenConns, s.db.readerSQL.Stats().MaxOpenConnections)
+
+	// the reader pool is read-only
+	err := s.db.conn.read(ctx, func(db *gorm.DB) error {
+		return db.Exec("INSERT INTO `launch_counts` (`list_id`, `plugin_id`, `item_id`) VALUES ('a', 'b', 'c')").Error
+	})
+	require.ErrorContains(t, err, "readonly")
+
+	// writes are visible to readers after commit
+	_, err = s.db.LaunchCount().Increment(ctx, "apps", "desktop", "firefox")
+	require.NoError(t, err)
+	count, err := s.db.LaunchCount().GetItem(ctx, "apps", "desktop", "firefox")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, count)
+}
+
+func (s *ConnSuite) TestMemoryDBSharesPool() {
+	t := s.T()
+	ctx := context.Background()
+
+	cfg := newTestConfig(t)
+	cfg.MemoryDB = true
+	db := newTestDB(t, cfg)
+	defer db.Close()
+
+	require.Same(t, db.writerSQL, db.readerSQL)
+	_, err := db.LaunchCount().Increment(ctx, "apps", "desktop", "firefox")
+	require.NoError(t, err)
+	counts, err := db.LaunchCount().Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint{"firefox": 1}, counts)
+	require.NoFileExists(t, cfg.Path)
+}
+
+// Concurrent writers must not fail with ErrBusy and must not lose updates
+func (s *ConnSuite) TestStress() {
+	t := s.T()
+	ctx := context.Background()
+
+	const (
+		workers    = 16
+		iterations = 50
+	)
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*iterations*4)
+	for w := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			itemID := fmt.Sprintf("item-%d", w%4)
+			for i := range iterations {
+				if _, err := s.db.LaunchCount().Increment(ctx, "apps", "desktop", itemID); err != nil {
+					errs <- err
+				}
+				if err := s.db.QuerySelection().Record(ctx, "apps", "desktop", "it", itemID); err != nil {
+					errs <- err
+				}
+				if i%10 == 0 {
+					if err := s.db.ItemOverride().Pin(ctx, "apps", "desktop", itemID); err != nil {
+						errs <- err
+					}
+				}
+				if _, err := s.db.LaunchCount().Get(ctx, "apps", "desktop"); err != nil {
+					errs <- err
+				}
+				if _, err := s.db.QuerySelection().Lookup(ctx, "apps", "desktop", "it"); err != nil {
+					errs <- err
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	counts, err := s.db.LaunchCount().Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.Len(t, counts, 4)
+	for itemID, count := range counts {
+		require.EqualValues(t, workers/4*iterations, count, itemID)
+	}
+
+	overrides, err := s.db.ItemOverride().Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.Len(t, overrides, 4)
+}
+
+func TestConnSuite(t *testing.T) {
+	suite.Run(t, new(ConnSuite))
+}
@@ -3,86 +3,228 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
 
+	"github.com/Runix-Org/runix/platform/fs"
 	"go.uber.org/zap"
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
 )
 
+// DB has a single connection writer pool and a read-only reader pool.
+// SQLite allows one writer at a time, with a single writer connection concurrent writes
+// wait in the pool instead of failing with SQLITE_BUSY, while reads run in parallel in WAL mode.
+// Memory databases use the writer pool for reads, every connection has its own memory database.
 type DB struct {
-	gormDB      *gorm.DB
-	sqlDB       *sql.DB
+	writer      *gorm.DB
+	writerSQL   *sql.DB
+	reader      *gorm.DB
+	readerSQL   *sql.DB
+	conn        *conn
 	launchCount *LaunchCountRepo
+	querySel    *QuerySelectionRepo
+	overrides   *ItemOverrideRepo
+	pluginKV    *PluginKVRepo
+	metrics     *QueryMetrics
+
+	// Periodic backups and cleanup
+	stopBackground context.CancelFunc
+	backgroundWG   sync.WaitGroup
 
 	logger *zap.Logger
 }
 
-func New(ctx context.Context, cfg *DBConfig, logger *zap.Logger) (*DB, bool) {
+func New(ctx context.Context, cfg *DBConfig, logger *zap.Logger) (*DB, error) {
 	logger = logger.With(zap.String("db", "sqlite"))
 	if err := cfg.validate(); err != nil {
-		logger.Error("Failed validating DB config", zap.Error(err))
-		return nil, false
+		return nil, fmt.Errorf("validate db config: %w", err)
+	}
+
+	metrics := newQueryMetrics(cfg.SlowThreshold)
+	writer, writerSQL, err := open(ctx, cfg, metrics, logger)
+	if errors.Is(err, ErrCorrupt) {
+		logger.Error("DB is corrupted, restoring", zap.String("path", cfg.Path), zap.Error(err))
+		if _, err := restoreFromBackup(ctx, cfg, logger); err != nil {
+			return nil, fmt.Errorf("restore db: %w", err)
+		}
+		writer, writerSQL, err = open(ctx, cfg, metrics, logger)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := newMigrator(writer, cfg, logger).migrate(ctx); err != nil {
+		_ = writerSQL.Close()
+		return nil, fmt.Errorf("migrate db: %w", classifyError(err))
 	}
 
-	gormLog := NewDBLogger(logger, cfg.LogLevel, cfg.SlowThreshold)
+	if err := writer.WithContext(ctx).Exec("PRAGMA optimize").Error; err != nil {
+		logger.Warn("Failed optimizing DB", zap.Error(err))
+	}
 
-	gdb, err := gorm.Open(sqlite.Open(cfg.BuildDSN()), &gorm.Config{
+	reader, readerSQL := writer, writerSQL
+	if !cfg.MemoryDB {
+		// the file exists after migrations, so it can be opened read-only
+		reader, readerSQL, err = openReader(ctx, cfg, metrics, logger)
+		if err != nil {
+			_ = writerSQL.Close()
+			return nil, err
+		}
+	}
+
+	conn := newConn(writer, reader, logger)
+	db := &DB{
+		writer:      writer,
+		writerSQL:   writerSQL,
+		reader:      reader,
+		readerSQL:   readerSQL,
+		conn:        conn,
+		launchCount: newLaunchCountRepo(conn),
+		querySel:    newQuerySelectionRepo(conn),
+		overrides:   newItemOverrideRepo(conn),
+		pluginKV:    newPluginKVRepo(conn, cfg.PluginKVQuota),
+		metrics:     metrics,
+		logger:      logger,
+	}
+
+	bgCtx, stop := context.WithCancel(context.Background())
+	db.stopBackground = stop
+	db.backgroundWG.Add(1)
+	go func() {
+		defer db.backgroundWG.Done()
+		db.runCleanup(bgCtx, cfg.PluginKVCleanupInterval)
+	}()
+	if !cfg.MemoryDB && !cfg.DisableBackups {
+		db.backgroundWG.Add(1)
+		go func() {
+			defer db.backgroundWG.Done()
+			db.runBackups(bgCtx, cfg)
+		}()
+	}
+
+	return db, nil
+}
+
+func openGorm(dsn string, cfg *DBConfig, metrics *QueryMetrics, logger *zap.Logger) (*gorm.DB, *sql.DB, error) {
+	observers := append([]QueryObserver{metrics}, cfg.QueryObservers...)
+	gormLog := NewDBLogger(logger, cfg.LogLevel, cfg.SlowThreshold, observers...)
+
+	gdb, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{
 		// faster for simple operations, we will include transactions if necessary
 		SkipDefaultTransaction: true,
 		Logger:                 gormLog,
 	})
 	if err != nil {
-		logger.Error("Failed opening DB", zap.Error(err))
-		return nil, false
+		return nil, nil, fmt.Errorf("open db: %w", classifyError(err))
 	}
 
 	sqlDB, err := gdb.DB()
 	if err != nil {
-		logger.Error("Failed getting DB", zap.Error(err))
-		return nil, false
+		return nil, nil, fmt.Errorf("get db: %w", err)
 	}
-	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
-	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
 	sqlDB.SetConnMaxIdleTime(cfg.ConnMaxIdleTime)
 	sqlDB.SetConnMaxLifetime(cfg.ConnMaxLifetime)
 
+	return gdb, sqlDB, nil
+}
+
+// open opens the writer pool and checks the database integrity.
+// ErrCorrupt is returned if the existing file is damaged.
+func open(ctx context.Context, cfg *DBConfig, metrics *QueryMetrics, logger *zap.Logger) (*gorm.DB, *sql.DB, error) {
+	existed := !cfg.MemoryDB && fs.ExistsFile(cfg.Path)
+
+	gdb, sqlDB, err := openGorm(cfg.BuildDSN(), cfg, metrics, logger)
+	if err != nil {
+		return nil, nil, err
+	}
+	sqlDB.SetMaxOpenConns(1)
+	sqlDB.SetMaxIdleConns(1)
+	if cfg.MemoryDB {
+		// the memory database is lost with its connection
+		sqlDB.SetConnMaxIdleTime(0)
+		sqlDB.SetConnMaxLifetime(0)
+	}
+
 	if err := sqlDB.PingContext(ctx); err != nil {
-		logger.Error("Failed pinging DB", zap.Error(err))
-		return nil, false
+		_ = sqlDB.Close()
+		return nil, nil, fmt.Errorf("ping db: %w", classifyError(err))
 	}
 
-	models := []interface{}{&LaunchCountModel{}}
-	if err := gdb.WithContext(ctx).AutoMigrate(models...); err != nil {
-		logger.Error("Failed automigrating DB", zap.Error(err))
-		return nil, false
+	if existed {
+		if err := checkIntegrity(ctx, sqlDB); err != nil {
+			_ = sqlDB.Close()
+			return nil, nil, fmt.Errorf("check db integrity: %w", err)
+		}
 	}
 
-	if err := gdb.WithContext(ctx).Exec("PRAGMA optimize").Error; err != nil {
-		logger.Warn("Failed optimizing DB", zap.Error(err))
+	return gdb, sqlDB, nil
+}
+
+// openReader opens the read-only reader pool
+func openReader(ctx context.Context, cfg *DBConfig, metrics *QueryMetrics, logger *zap.Logger) (*gorm.DB, *sql.DB, error) {
+	gdb, sqlDB, err := openGorm(cfg.buildDSN(true), cfg, metrics, logger)
+	if err != nil {
+		return nil, nil, err
 	}
+	sqlDB.SetMaxOpenConns(cfg.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(cfg.MaxIdleConns)
 
-	return &DB{
-		gormDB:      gdb,
-		sqlDB:       sqlDB,
-		launchCount: &LaunchCountRepo{gdb, logger.With(zap.String("repo", "launch_count"))},
-		logger:      logger,
-	}, true
+	if err := sqlDB.PingContext(ctx); err != nil {
+		_ = sqlDB.Close()
+		return nil, nil, fmt.Errorf("ping db reader: %w", classifyError(err))
+	}
+
+	return gdb, sqlDB, nil
 }
 
 func (db *DB) LaunchCount() *LaunchCountRepo {
 	return db.launchCount
 }
 
+func (db *DB) QuerySelection() *QuerySelectionRepo {
+	return db.querySel
+}
+
+func (db *DB) ItemOverride() *ItemOverrideRepo {
+	return db.overrides
+}
+
+func (db *DB) PluginKV() *PluginKVRepo {
+	return db.pluginKV
+}
+
+// Metrics returns latency, row and error stats per repository call and the last slow queries
+func (db *DB) Metrics() *QueryMetrics {
+	return db.metrics
+}
+
+// Close closes the database, repositories return ErrClosed after it
 func (db *DB) Close() {
 	if db == nil {
 		return
 	}
-	if db.sqlDB != nil {
-		if err := db.sqlDB.Close(); err != nil {
+	if db.stopBackground != nil {
+		db.stopBackground()
+		db.backgroundWG.Wait()
+		db.stopBackground = nil
+	}
+	if db.conn != nil {
+		db.conn.close()
+	}
+	if db.readerSQL != nil && db.readerSQL != db.writerSQL {
+		if err := db.readerSQL.Close(); err != nil {
+			db.logger.Warn("Failed closing DB reader", zap.Error(err))
+		}
+	}
+	if db.writerSQL != nil {
+		if err := db.writerSQL.Close(); err != nil {
 			db.logger.Warn("Failed closing DB", zap.Error(err))
 		}
-		db.sqlDB = nil
 	}
-	db.gormDB = nil
-	db.launchCount = nil
+	db.readerSQL = nil
+	db.writerSQL = nil
+	db.reader = nil
+	db.writer = nil
 }
@@ -0,0 +1,28 @@
+package db
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func newTestConfig(t *testing.T) *DBConfig {
+	dir := t.TempDir()
+	return &DBConfig{
+		Path:      filepath.Join(dir, "launch.db"),
+		BackupDir: filepath.Join(dir, "backups"),
+		LogLevel:  gormlogger.Silent,
+		// enabled explicitly by backup tests
+		DisableBackups: true,
+	}
+}
+
+func newTestDB(t *testing.T, cfg *DBConfig) *DB {
+	db, err := New(context.Background(), cfg, zap.NewNop())
+	require.NoError(t, err)
+	return db
+}
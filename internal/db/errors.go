@@ -0,0 +1,82 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotFound = errors.New("record not found")
+	ErrBusy     = errors.New("database is busy")
+	ErrClosed   = errors.New("database is closed")
+	ErrCorrupt  = errors.New("database is corrupted")
+
+	// Validation reasons
+	ErrMustNotBeEmpty          = errors.New("must not be empty")
+	ErrMustNotBeGreaterThan255 = errors.New("length must be <= 255")
+)
+
+// ValidationError is returned when an argument of a repository method is invalid
+type ValidationError struct {
+	Field  string
+	Value  string
+	Reason error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid %s %q: %s", e.Field, e.Value, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Reason
+}
+
+func checkField(v string) error {
+	if v == "" {
+		return ErrMustNotBeEmpty
+	} else if len(v) > 255 {
+		return ErrMustNotBeGreaterThan255
+	}
+
+	return nil
+}
+
+func validateField(fieldName string, v string) error {
+	if err := checkField(v); err != nil {
+		return &ValidationError{Field: fieldName, Value: v, Reason: err}
+	}
+
+	return nil
+}
+
+// classifyError maps driver errors to the package errors, keeping the original in the chain
+func classifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+
+	var se sqlite3.Error
+	if errors.As(err, &se) && (se.Code == sqlite3.ErrBusy || se.Code == sqlite3.ErrLocked) {
+		return fmt.Errorf("%w: %w", ErrBusy, err)
+	}
+
+	if errors.As(err, &se) && (se.Code == sqlite3.ErrCorrupt || se.Code == sqlite3.ErrNotADB) {
+		return fmt.Errorf("%w: %w", ErrCorrupt, err)
+	}
+
+	// database/sql does not export its "closed" error
+	if errors.Is(err, sql.ErrConnDone) || strings.Contains(err.Error(), "sql: database is closed") {
+		return fmt.Errorf("%w: %w", ErrClosed, err)
+	}
+
+	return err
+}
@@ -0,0 +1,499 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ExportFormatVersion is the version of the JSON format written by Export.
+//
+// Version 1:
+//
+//	{
+//	  "version": 1,
+//	  "exportedAt": "2024-05-01T12:00:00Z",          // RFC 3339
+//	  "launchCounts": [
+//	    {
+//	      "listID": "apps",                          // 1..255 bytes
+//	      "pluginID": "applications",                // 1..255 bytes
+//	      "itemID": "firefox",                       // 1..255 bytes
+//	      "launchCount": 42
+//	    }
+//	  ],
+//	  "querySelections": [
+//	    {
+//	      "listID": "apps",                          // 1..255 bytes
+//	      "pluginID": "applications",                // 1..255 bytes
+//	      "prefix": "fi",                            // 1..255 bytes, lower case
+//	      "itemID": "firefox",                       // 1..255 bytes
+//	      "score": 3.5,                              // >= 0, value at updatedAt
+//	      "updatedAt": 1714564800                    // unix time
+//	    }
+//	  ],
+//	  "itemOverrides": [
+//	    {
+//	      "listID": "apps",                          // 1..255 bytes
+//	      "pluginID": "applications",                // 1..255 bytes
+//	      "itemID": "firefox",                       // 1..255 bytes
+//	      "pinned": true,
+//	      "pinOrder": 0,                             // >= 0
+//	      "hidden": false,
+//	      "title": "Browser",                        // optional, 1..255 bytes
+//	      "keywords": ["web"]                        // 1..255 bytes each
+//	    }
+//	  ]
+//	}
+//
+// Item overrides are settings rather than counters: MergeReplace overwrites the override
+// of an item, the other strategies keep the existing one like MergeKeep.
+//
+// New kinds of per-item data are added as new top level arrays,
+// readers must ignore unknown fields.
+const ExportFormatVersion = 1
+
+var (
+	ErrUnsupportedExportVersion = errors.New("unsupported export format version")
+	ErrUnknownMergeStrategy     = errors.New("unknown merge strategy")
+	ErrInvalidScore             = errors.New("score must be a finite number >= 0")
+	ErrInvalidPinOrder          = errors.New("pin order must be >= 0")
+)
+
+// MergeStrategy defines how imported values are combined with existing ones
+type MergeStrategy string
+
+const (
+	// Existing and imported values are added up
+	MergeSum MergeStrategy = "sum"
+	// The larger value wins
+	MergeMax MergeStrategy = "max"
+	// Imported values overwrite existing ones, values missing in the import are kept
+	MergeReplace MergeStrategy = "replace"
+	// Existing values win, only the missing ones are imported
+	MergeKeep MergeStrategy = "keep"
+)
+
+type ExportData struct {
+	Version         int                    `json:"version"`
+	ExportedAt      time.Time              `json:"exportedAt"`
+	LaunchCounts    []ExportLaunchCount    `json:"launchCounts"`
+	QuerySelections []ExportQuerySelection `json:"querySelections"`
+	ItemOverrides   []ExportItemOverride   `json:"itemOverrides"`
+}
+
+type ExportLaunchCount struct {
+	ListID      string `json:"listID"`
+	PluginID    string `json:"pluginID"`
+	ItemID      string `json:"itemID"`
+	LaunchCount uint   `json:"launchCount"`
+}
+
+type ExportQuerySelection struct {
+	ListID    string  `json:"listID"`
+	PluginID  string  `json:"pluginID"`
+	Prefix    string  `json:"prefix"`
+	ItemID    string  `json:"itemID"`
+	Score     float64 `json:"score"`
+	UpdatedAt int64   `json:"updatedAt"`
+}
+
+type ExportItemOverride struct {
+	ListID   string   `json:"listID"`
+	PluginID string   `json:"pluginID"`
+	ItemID   string   `json:"itemID"`
+	Pinned   bool     `json:"pinned"`
+	PinOrder int      `json:"pinOrder"`
+	Hidden   bool     `json:"hidden"`
+	Title    *string  `json:"title,omitempty"`
+	Keywords []string `json:"keywords"`
+}
+
+// ImportStats is the number of records written by kind. Duplicates of a record in the import count once,
+// records kept by MergeKeep and overrides that change nothing are not counted.
+type ImportStats struct {
+	LaunchCounts    int
+	QuerySelections int
+	ItemOverrides   int
+}
+
+// Export writes a consistent snapshot of the usage history as JSON
+func (db *DB) Export(ctx context.Context, w io.Writer) error {
+	data := ExportData{
+		Version:         ExportFormatVersion,
+		ExportedAt:      time.Now().UTC().Truncate(time.Second),
+		LaunchCounts:    []ExportLaunchCount{},
+		QuerySelections: []ExportQuerySelection{},
+		ItemOverrides:   []ExportItemOverride{},
+	}
+
+	err := db.conn.read(ctx, func(gdb *gorm.DB) error {
+		return gdb.Transaction(func(tx *gorm.DB) error {
+			var launchCounts []LaunchCountModel
+			if err := tx.Order("plugin_id, list_id, item_id").Find(&launchCounts).Error; err != nil {
+				return err
+			}
+			for _, row := range launchCounts {
+				data.LaunchCounts = append(data.LaunchCounts, ExportLaunchCount{
+					ListID:      row.ListID,
+					PluginID:    row.PluginID,
+					ItemID:      row.ItemID,
+					LaunchCount: row.LaunchCount,
+				})
+			}
+
+			var selections []QuerySelectionModel
+			if err := tx.Order("plugin_id, list_id, prefix, item_id").Find(&selections).Error; err != nil {
+				return err
+			}
+			for _, row := range selections {
+				data.QuerySelections = append(data.QuerySelections, ExportQuerySelection(row))
+			}
+
+			var overrides []ItemOverrideModel
+			if err := tx.Order("plugin_id, list_id, item_id").Find(&overrides).Error; err != nil {
+				return err
+			}
+			for _, row := range overrides {
+				o := row.toOverride()
+				data.ItemOverrides = append(data.ItemOverrides, ExportItemOverride{
+					ListID:   row.ListID,
+					PluginID: row.PluginID,
+					ItemID:   row.ItemID,
+					Pinned:   o.Pinned,
+					PinOrder: o.PinOrder,
+					Hidden:   o.Hidden,
+					Title:    o.Title,
+					Keywords: o.Keywords,
+				})
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("read usage history: %w", err)
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(&data); err != nil {
+		return fmt.Errorf("write export: %w", err)
+	}
+
+	return nil
+}
+
+// Import reads data written by Export and merges it in a single transaction.
+// Nothing is written if any record is invalid.
+func (db *DB) Import(ctx context.Context, r io.Reader, strategy MergeStrategy) (ImportStats, error) {
+	var stats ImportStats
+	if err := validateMergeStrategy(strategy); err != nil {
+		return stats, err
+	}
+
+	var data ExportData
+	if err := json.NewDecoder(r).Decode(&data); err != nil {
+		return stats, fmt.Errorf("decode import: %w", err)
+	}
+	if data.Version < 1 || data.Version > ExportFormatVersion {
+		return stats, fmt.Errorf("%w: %d", ErrUnsupportedExportVersion, data.Version)
+	}
+	if err := validateExportData(&data); err != nil {
+		return stats, err
+	}
+
+	now := db.querySel.now()
+	err := db.conn.transaction(ctx, func(tx *gorm.DB) error {
+		stats = ImportStats{}
+
+		n, err := importLaunchCounts(tx, data.LaunchCounts, strategy)
+		if err != nil {
+			return err
+		}
+		stats.LaunchCounts = int(n)
+
+		if n, err = db.importQuerySelections(tx, data.QuerySelections, strategy, now); err != nil {
+			return err
+		}
+		stats.QuerySelections = int(n)
+
+		if n, err = importItemOverrides(tx, data.ItemOverrides, strategy); err != nil {
+			return err
+		}
+		stats.ItemOverrides = int(n)
+		return nil
+	})
+	if err != nil {
+		return ImportStats{}, err
+	}
+
+	return stats, nil
+}
+
+func validateMergeStrategy(strategy MergeStrategy) error {
+	switch strategy {
+	case MergeSum, MergeMax, MergeReplace, MergeKeep:
+		return nil
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownMergeStrategy, strategy)
+	}
+}
+
+func validateExportData(data *ExportData) error {
+	for i, row := range data.LaunchCounts {
+		for _, f := range []struct{ name, value string }{
+			{"listID", row.ListID}, {"pluginID", row.PluginID}, {"itemID", row.ItemID},
+		} {
+			if err := validateField(f.name, f.value); err != nil {
+				return fmt.Errorf("launchCounts[%d]: %w", i, err)
+			}
+		}
+	}
+
+	for i, row := range data.QuerySelections {
+		for _, f := range []struct{ name, value string }{
+			{"listID", row.ListID}, {"pluginID", row.PluginID}, {"prefix", row.Prefix}, {"itemID", row.ItemID},
+		} {
+			if err := validateField(f.name, f.value); err != nil {
+				return fmt.Errorf("querySelections[%d]: %w", i, err)
+			}
+		}
+		if row.Score < 0 || math.IsNaN(row.Score) || math.IsInf(row.Score, 0) {
+			return fmt.Errorf("querySelections[%d]: %w", i,
+				&ValidationError{Field: "score", Value: fmt.Sprint(row.Score), Reason: ErrInvalidScore})
+		}
+	}
+
+	for i, row := range data.ItemOverrides {
+		for _, f := range []struct{ name, value string }{
+			{"listID", row.ListID}, {"pluginID", row.PluginID}, {"itemID", row.ItemID},
+		} {
+			if err := validateField(f.name, f.value); err != nil {
+				return fmt.Errorf("itemOverrides[%d]: %w", i, err)
+			}
+		}
+		if row.PinOrder < 0 {
+			return fmt.Errorf("itemOverrides[%d]: %w", i,
+				&ValidationError{Field: "pinOrder", Value: fmt.Sprint(row.PinOrder), Reason: ErrInvalidPinOrder})
+		}
+		if err := validateItemOverride(row.override()); err != nil {
+			return fmt.Errorf("itemOverrides[%d]: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+type itemKey struct {
+	listID, pluginID, itemID string
+}
+
+// importLaunchCounts returns the number of written counters,
+// duplicates in rows are merged with strategy before
+func importLaunchCounts(tx *gorm.DB, rows []ExportLaunchCount, strategy MergeStrategy) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	var expr clause.Expr
+	switch strategy {
+	case MergeSum:
+		expr = gorm.Expr("`launch_count` + excluded.`launch_count`")
+	case MergeMax:
+		expr = gorm.Expr("MAX(`launch_count`, excluded.`launch_count`)")
+	case MergeReplace:
+		expr = gorm.Expr("excluded.`launch_count`")
+	}
+
+	merged := make(map[itemKey]int, len(rows))
+	models := make([]LaunchCountModel, 0, len(rows))
+	for _, row := range rows {
+		key := itemKey{row.ListID, row.PluginID, row.ItemID}
+		i, ok := merged[key]
+		if !ok {
+			merged[key] = len(models)
+			models = append(models, LaunchCountModel{
+				ListID:      row.ListID,
+				PluginID:    row.PluginID,
+				ItemID:      row.ItemID,
+				LaunchCount: row.LaunchCount,
+			})
+			continue
+		}
+
+		switch strategy {
+		case MergeSum:
+			models[i].LaunchCount += row.LaunchCount
+		case MergeMax:
+			models[i].LaunchCount = max(models[i].LaunchCount, row.LaunchCount)
+		case MergeReplace:
+			models[i].LaunchCount = row.LaunchCount
+		}
+	}
+
+	onConflict := clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "plugin_id"},
+			{Name: "list_id"},
+			{Name: "item_id"},
+		},
+		// the existing counters are not written, so they are not counted
+		DoNothing: strategy == MergeKeep,
+	}
+	if strategy != MergeKeep {
+		onConflict.DoUpdates = clause.Assignments(map[string]interface{}{"launch_count": expr})
+	}
+
+	res := tx.Clauses(onConflict).CreateInBatches(models, setManyBatchSize)
+	return res.RowsAffected, res.Error
+}
+
+type querySelectionKey struct {
+	listID, pluginID, prefix, itemID string
+}
+
+// importQuerySelections returns the number of written selections.
+// Scores decay over time, so both sides are brought to the current time before merging.
+func (db *DB) importQuerySelections(
+	tx *gorm.DB,
+	rows []ExportQuerySelection,
+	strategy MergeStrategy,
+	now time.Time,
+) (int64, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	nowUnix := now.Unix()
+	repo := db.querySel
+
+	existing := map[querySelectionKey]float64{}
+	if strategy != MergeReplace {
+		lists := map[ListKey]struct{}{}
+		pairs := [][]interface{}{}
+		for _, row := range rows {
+			key := ListKey{ListID: row.ListID, PluginID: row.PluginID}
+			if _, ok := lists[key]; !ok {
+				lists[key] = struct{}{}
+				pairs = append(pairs, []interface{}{row.PluginID, row.ListID})
+			}
+		}
+
+		var current []QuerySelectionModel
+		if err := tx.Where("(plugin_id, list_id) IN ?", pairs).Find(&current).Error; err != nil {
+			return 0, err
+		}
+		for _, row := range current {
+			key := querySelectionKey{row.ListID, row.PluginID, row.Prefix, row.ItemID}
+			existing[key] = repo.decay(row.Score, row.UpdatedAt, nowUnix)
+		}
+	}
+
+	merged := make(map[querySelectionKey]float64, len(rows))
+	order := make([]querySelectionKey, 0, len(rows))
+	for _, row := range rows {
+		key := querySelectionKey{row.ListID, row.PluginID, row.Prefix, row.ItemID}
+		imported := repo.decay(row.Score, row.UpdatedAt, nowUnix)
+
+		if _, ok := merged[key]; !ok {
+			order = append(order, key)
+			merged[key] = existing[key]
+		}
+
+		switch strategy {
+		case MergeSum:
+			merged[key] += imported
+		case MergeMax:
+			merged[key] = max(merged[key], imported)
+		case MergeReplace:
+			merged[key] = imported
+		case MergeKeep:
+			if _, ok := existing[key]; !ok {
+				merged[key] = imported
+			}
+		}
+	}
+
+	models := make([]QuerySelectionModel, 0, len(order))
+	for _, key := range order {
+		if _, ok := existing[key]; ok && strategy == MergeKeep {
+			continue
+		}
+		models = append(models, QuerySelectionModel{
+			ListID:    key.listID,
+			PluginID:  key.pluginID,
+			Prefix:    key.prefix,
+			ItemID:    key.itemID,
+			Score:     merged[key],
+			UpdatedAt: nowUnix,
+		})
+	}
+
+	if len(models) == 0 {
+		return 0, nil
+	}
+
+	res := tx.
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{
+				{Name: "plugin_id"},
+				{Name: "list_id"},
+				{Name: "prefix"},
+				{Name: "item_id"},
+			},
+			DoUpdates: clause.AssignmentColumns([]string{"score", "updated_at"}),
+		}).
+		CreateInBatches(models, setManyBatchSize)
+	return res.RowsAffected, res.Error
+}
+
+func (o *ExportItemOverride) override() ItemOverride {
+	return ItemOverride{
+		Pinned:   o.Pinned,
+		PinOrder: o.PinOrder,
+		Hidden:   o.Hidden,
+		Title:    o.Title,
+		Keywords: o.Keywords,
+	}
+}
+
+// importItemOverrides overwrites the existing overrides with MergeReplace and keeps them otherwise,
+// a duplicate in rows is handled the same way. Overrides that change nothing are skipped.
+// Returns the number of written overrides.
+func importItemOverrides(tx *gorm.DB, rows []ExportItemOverride, strategy MergeStrategy) (int64, error) {
+	indexes := make(map[itemKey]int, len(rows))
+	models := make([]ItemOverrideModel, 0, len(rows))
+	for _, row := range rows {
+		o := row.override()
+		if o.IsZero() {
+			continue
+		}
+
+		model := newItemOverrideModel(row.ListID, row.PluginID, row.ItemID, o)
+		key := itemKey{row.ListID, row.PluginID, row.ItemID}
+		if i, ok := indexes[key]; !ok {
+			indexes[key] = len(models)
+			models = append(models, model)
+		} else if strategy == MergeReplace {
+			models[i] = model
+		}
+	}
+	if len(models) == 0 {
+		return 0, nil
+	}
+
+	// an ignored conflict is not counted by RowsAffected
+	var updates clause.Set
+	if strategy == MergeReplace {
+		updates = itemOverrideUpdates
+	}
+	res := insertItemOverrides(tx, models, updates)
+	return res.RowsAffected, res.Error
+}
@@ -0,0 +1,298 @@
+package db
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ExportSuite struct {
+	suite.Suite
+	src *DB
+	dst *DB
+	now time.Time
+}
+
+func (s *ExportSuite) SetupTest() {
+	t := s.T()
+
+	s.now = time.Unix(1_700_000_000, 0)
+	s.src = newTestDB(t, newTestConfig(t))
+	s.dst = newTestDB(t, newTestConfig(t))
+	for _, db := range []*DB{s.src, s.dst} {
+		db.QuerySelection().now = func() time.Time { return s.now }
+	}
+}
+
+func (s *ExportSuite) TearDownTest() {
+	s.src.Close()
+	s.dst.Close()
+}
+
+func (s *ExportSuite) export() []byte {
+	t := s.T()
+
+	var buf bytes.Buffer
+	require.NoError(t, s.src.Export(context.Background(), &buf))
+	return buf.Bytes()
+}
+
+func (s *ExportSuite) seed(db *DB, firefox uint, gimp uint) {
+	t := s.T()
+	ctx := context.Background()
+
+	require.NoError(t, db.LaunchCount().SetMany(ctx, []LaunchCountModel{
+		{ListID: "apps", PluginID: "desktop", ItemID: "firefox", LaunchCount: firefox},
+		{ListID: "apps", PluginID: "desktop", ItemID: "gimp", LaunchCount: gimp},
+	}))
+	require.NoError(t, db.QuerySelection().Record(ctx, "apps", "desktop", "f", "firefox"))
+}
+
+// seedOverrides pins firefox and hides gimp, title names the source in firefox's alias
+func (s *ExportSuite) seedOverrides(db *DB, title string) {
+	t := s.T()
+	ctx := context.Background()
+
+	require.NoError(t, db.ItemOverride().Pin(ctx, "apps", "desktop", "firefox"))
+	require.NoError(t, db.ItemOverride().SetAlias(ctx, "apps", "desktop", "firefox", &title, []string{"web"}))
+	require.NoError(t, db.ItemOverride().SetHidden(ctx, "apps", "desktop", "gimp", true))
+}
+
+func (s *ExportSuite) TestExportFormat() {
+	t := s.T()
+	s.seed(s.src, 3, 1)
+
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal(s.export(), &data))
+	require.EqualValues(t, ExportFormatVersion, data["version"])
+	require.Contains(t, data, "exportedAt")
+	require.Equal(t, []interface{}{
+		map[string]interface{}{"listID": "apps", "pluginID": "desktop", "itemID": "firefox", "launchCount": 3.0},
+		map[string]interface{}{"listID": "apps", "pluginID": "desktop", "itemID": "gimp", "launchCount": 1.0},
+	}, data["launchCounts"])
+	require.Equal(t, []interface{}{
+		map[string]interface{}{
+			"listID": "apps", "pluginID": "desktop", "prefix": "f", "itemID": "firefox",
+			"score": 1.0, "updatedAt": float64(s.now.Unix()),
+		},
+	}, data["querySelections"])
+}
+
+func (s *ExportSuite) TestImportStrategies() {
+	for _, tc := range []struct {
+		strategy MergeStrategy
+		counts   map[string]uint
+		boost    float64
+		stats    ImportStats
+	}{
+		{MergeSum, map[string]uint{"firefox": 5, "gimp": 6, "vim": 1}, 2, ImportStats{LaunchCounts: 2, QuerySelections: 1}},
+		{MergeMax, map[string]uint{"firefox": 3, "gimp": 5, "vim": 1}, 1, ImportStats{LaunchCounts: 2, QuerySelections: 1}},
+		{MergeReplace, map[string]uint{"firefox": 3, "gimp": 1, "vim": 1}, 1, ImportStats{LaunchCounts: 2, QuerySelections: 1}},
+		// all records exist, nothing is written
+		{MergeKeep, map[string]uint{"firefox": 2, "gimp": 5, "vim": 1}, 1, ImportStats{}},
+	} {
+		s.Run(string(tc.strategy), func() {
+			s.TearDownTest()
+			s.SetupTest()
+			t := s.T()
+			ctx := context.Background()
+
+			s.seed(s.src, 3, 1)
+			s.seed(s.dst, 2, 5)
+			_, err := s.dst.LaunchCount().Increment(ctx, "apps", "desktop", "vim")
+			require.NoError(t, err)
+
+			stats, err := s.dst.Import(ctx, bytes.NewReader(s.export()), tc.strategy)
+			require.NoError(t, err)
+			require.Equal(t, tc.stats, stats)
+
+			counts, err := s.dst.LaunchCount().Get(ctx, "apps", "desktop")
+			require.NoError(t, err)
+			require.Equal(t, tc.counts, counts)
+
+			boosts, err := s.dst.QuerySelection().Lookup(ctx, "apps", "desktop", "f")
+			require.NoError(t, err)
+			require.InDelta(t, tc.boost, boosts["firefox"], 1e-9)
+		})
+	}
+}
+
+func (s *ExportSuite) TestImportDecaysScores() {
+	t := s.T()
+	ctx := context.Background()
+
+	s.seed(s.src, 1, 1)
+	data := s.export()
+
+	s.now = s.now.Add(querySelectionHalfLife)
+	_, err := s.dst.Import(ctx, bytes.NewReader(data), MergeSum)
+	require.NoError(t, err)
+
+	boosts, err := s.dst.QuerySelection().Lookup(ctx, "apps", "desktop", "f")
+	require.NoError(t, err)
+	require.InDelta(t, 0.5, boosts["firefox"], 1e-9)
+}
+
+func (s *ExportSuite) TestImportValidation() {
+	t := s.T()
+	ctx := context.Background()
+
+	_, err := s.dst.Import(ctx, strings.NewReader(`{"version": 1}`), "merge")
+	require.ErrorIs(t, err, ErrUnknownMergeStrategy)
+
+	_, err = s.dst.Import(ctx, strings.NewReader(`{"version": 99}`), MergeSum)
+	require.ErrorIs(t, err, ErrUnsupportedExportVersion)
+
+	_, err = s.dst.Import(ctx, strings.NewReader(`{"version": 1, "launchCounts": [
+		{"listID": "apps", "pluginID": "desktop", "itemID": "firefox", "launchCount": 1},
+		{"listID": "apps", "pluginID": "", "itemID": "gimp", "launchCount": 1}
+	]}`), MergeSum)
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, "pluginID", verr.Field)
+
+	_, err = s.dst.Import(ctx, strings.NewReader(`{"version": 1, "querySelections": [
+		{"listID": "apps", "pluginID": "desktop", "prefix": "f", "itemID": "firefox", "score": -1}
+	]}`), MergeSum)
+	require.ErrorIs(t, err, ErrInvalidScore)
+
+	_, err = s.dst.Import(ctx, strings.NewReader(`{"version": 1, "itemOverrides": [
+		{"listID": "apps", "pluginID": "desktop", "itemID": "firefox", "pinned": true, "pinOrder": -1}
+	]}`), MergeSum)
+	require.ErrorIs(t, err, ErrInvalidPinOrder)
+
+	_, err = s.dst.Import(ctx, strings.NewReader(`{"version": 1, "launchCounts": [
+		{"listID": "apps", "pluginID": "desktop", "itemID": "firefox", "launchCount": 1}
+	], "itemOverrides": [
+		{"listID": "apps", "pluginID": "desktop", "itemID": "firefox", "hidden": true, "keywords": [""]}
+	]}`), MergeSum)
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, "keyword", verr.Field)
+
+	// nothing from the invalid imports was written
+	counts, err := s.dst.LaunchCount().Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.Empty(t, counts)
+}
+
+func (s *ExportSuite) TestItemOverridesRoundTrip() {
+	t := s.T()
+	ctx := context.Background()
+
+	s.seedOverrides(s.src, "Browser")
+	data := s.export()
+
+	var raw map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &raw))
+	require.Equal(t, []interface{}{
+		map[string]interface{}{
+			"listID": "apps", "pluginID": "desktop", "itemID": "firefox",
+			"pinned": true, "pinOrder": 0.0, "hidden": false, "title": "Browser", "keywords": []interface{}{"web"},
+		},
+		map[string]interface{}{
+			"listID": "apps", "pluginID": "desktop", "itemID": "gimp",
+			"pinned": false, "pinOrder": 0.0, "hidden": true, "keywords": []interface{}{},
+		},
+	}, raw["itemOverrides"])
+
+	stats, err := s.dst.Import(ctx, bytes.NewReader(data), MergeSum)
+	require.NoError(t, err)
+	require.Equal(t, 2, stats.ItemOverrides)
+
+	want, err := s.src.ItemOverride().Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	got, err := s.dst.ItemOverride().Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.Equal(t, want, got)
+}
+
+func (s *ExportSuite) TestImportItemOverrideStrategies() {
+	for _, tc := range []struct {
+		strategy MergeStrategy
+		title    string
+		imported int
+	}{
+		{MergeReplace, "Browser", 2},
+		{MergeKeep, "Firefox", 1},
+		// counters only, the existing override is kept
+		{MergeSum, "Firefox", 1},
+		{MergeMax, "Firefox", 1},
+	} {
+		s.Run(string(tc.strategy), func() {
+			s.TearDownTest()
+			s.SetupTest()
+			t := s.T()
+			ctx := context.Background()
+
+			s.seedOverrides(s.src, "Browser")
+			title := "Firefox"
+			require.NoError(t, s.dst.ItemOverride().SetAlias(ctx, "apps", "desktop", "firefox", &title, nil))
+
+			stats, err := s.dst.Import(ctx, bytes.NewReader(s.export()), tc.strategy)
+			require.NoError(t, err)
+			require.Equal(t, tc.imported, stats.ItemOverrides)
+
+			overrides, err := s.dst.ItemOverride().Get(ctx, "apps", "desktop")
+			require.NoError(t, err)
+			require.Equal(t, tc.title, *overrides["firefox"].Title)
+			// gimp had no override, it is imported by every strategy
+			require.True(t, overrides["gimp"].Hidden)
+		})
+	}
+}
+
+func (s *ExportSuite) TestImportStatsCountWrittenRows() {
+	data := `{"version": 1, "launchCounts": [
+		{"listID": "apps", "pluginID": "desktop", "itemID": "firefox", "launchCount": 1},
+		{"listID": "apps", "pluginID": "desktop", "itemID": "firefox", "launchCount": 2},
+		{"listID": "apps", "pluginID": "desktop", "itemID": "gimp", "launchCount": 1}
+	], "querySelections": [
+		{"listID": "apps", "pluginID": "desktop", "prefix": "f", "itemID": "firefox", "score": 1, "updatedAt": 0},
+		{"listID": "apps", "pluginID": "desktop", "prefix": "f", "itemID": "firefox", "score": 1, "updatedAt": 0}
+	], "itemOverrides": [
+		{"listID": "apps", "pluginID": "desktop", "itemID": "firefox", "hidden": true, "keywords": []},
+		{"listID": "apps", "pluginID": "desktop", "itemID": "firefox", "pinned": true, "keywords": []},
+		{"listID": "apps", "pluginID": "desktop", "itemID": "gimp", "keywords": []}
+	]}`
+
+	for _, tc := range []struct {
+		strategy MergeStrategy
+		count    uint
+		hidden   bool
+	}{
+		{MergeSum, 3, true},
+		{MergeMax, 2, true},
+		{MergeReplace, 2, false},
+		{MergeKeep, 1, true},
+	} {
+		s.Run(string(tc.strategy), func() {
+			s.TearDownTest()
+			s.SetupTest()
+			t := s.T()
+			ctx := context.Background()
+
+			stats, err := s.dst.Import(ctx, strings.NewReader(data), tc.strategy)
+			require.NoError(t, err)
+			// duplicates count once, the zero override of gimp is skipped
+			require.Equal(t, ImportStats{LaunchCounts: 2, QuerySelections: 1, ItemOverrides: 1}, stats)
+
+			count, err := s.dst.LaunchCount().GetItem(ctx, "apps", "desktop", "firefox")
+			require.NoError(t, err)
+			require.Equal(t, tc.count, count)
+			overrides, err := s.dst.ItemOverride().Get(ctx, "apps", "desktop")
+			require.NoError(t, err)
+			require.Len(t, overrides, 1)
+			require.Equal(t, tc.hidden, overrides["firefox"].Hidden)
+		})
+	}
+}
+
+func TestExportSuite(t *testing.T) {
+	suite.Run(t, new(ExportSuite))
+}
@@ -0,0 +1,382 @@
+package db
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ItemOverride holds the user's changes of a single item
+type ItemOverride struct {
+	// Pinned items are shown first, ordered by PinOrder
+	Pinned   bool
+	PinOrder int
+	// Hidden items are never shown
+	Hidden bool
+	// Custom title, nil keeps the original one
+	Title *string
+	// Extra keywords for search
+	Keywords []string
+}
+
+// IsZero reports whether the override changes nothing
+func (o ItemOverride) IsZero() bool {
+	return !o.Pinned && !o.Hidden && o.Title == nil && len(o.Keywords) == 0
+}
+
+type ItemOverrideModel struct {
+	ListID   string `gorm:"primaryKey;size:255;not null"`
+	PluginID string `gorm:"primaryKey;size:255;not null"`
+	ItemID   string `gorm:"primaryKey;size:255;not null"`
+	Pinned   bool   `gorm:"not null;default:false"`
+	PinOrder int    `gorm:"not null;default:0"`
+	Hidden   bool   `gorm:"not null;default:false"`
+	// no default tag: a batch mixing nil and set titles would get DEFAULT values SQLite does not accept
+	Title    *string
+	Keywords []string `gorm:"serializer:json;not null"`
+}
+
+func (ItemOverrideModel) TableName() string {
+	return "item_overrides"
+}
+
+func (m *ItemOverrideModel) toOverride() ItemOverride {
+	keywords := m.Keywords
+	if keywords == nil {
+		keywords = []string{}
+	}
+
+	return ItemOverride{
+		Pinned:   m.Pinned,
+		PinOrder: m.PinOrder,
+		Hidden:   m.Hidden,
+		Title:    m.Title,
+		Keywords: keywords,
+	}
+}
+
+// ItemOverrideRepo stores pinned, hidden and renamed items per list
+type ItemOverrideRepo struct {
+	conn *conn
+}
+
+func newItemOverrideRepo(conn *conn) *ItemOverrideRepo {
+	return &ItemOverrideRepo{conn: conn}
+}
+
+// Get returns itemID => override for all items of the list that have one
+func (r *ItemOverrideRepo) Get(ctx context.Context, listID string, pluginID string) (map[string]ItemOverride, error) {
+	if err := validateField("listID", listID); err != nil {
+		return nil, err
+	}
+	if err := validateField("pluginID", pluginID); err != nil {
+		return nil, err
+	}
+
+	var rows []ItemOverrideModel
+	err := r.conn.read(ctx, func(db *gorm.DB) error {
+		return db.
+			Where("plugin_id = ? AND list_id = ?", pluginID, listID).
+			Find(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]ItemOverride, len(rows))
+	for _, row := range rows {
+		result[row.ItemID] = row.toOverride()
+	}
+	return result, nil
+}
+
+// Set replaces the override of the item, a zero override removes it
+func (r *ItemOverrideRepo) Set(
+	ctx context.Context,
+	listID string,
+	pluginID string,
+	itemID string,
+	override ItemOverride,
+) error {
+	if err := r.validateIDs(listID, pluginID, itemID); err != nil {
+		return err
+	}
+	if err := validateItemOverride(override); err != nil {
+		return err
+	}
+
+	if override.IsZero() {
+		return r.conn.write(ctx, func(db *gorm.DB) error {
+			return db.
+				Where("plugin_id = ? AND list_id = ? AND item_id = ?", pluginID, listID, itemID).
+				Delete(&ItemOverrideModel{}).Error
+		})
+	}
+
+	return r.conn.write(ctx, func(db *gorm.DB) error {
+		return upsertItemOverrides(db, []ItemOverrideModel{newItemOverrideModel(listID, pluginID, itemID, override)})
+	})
+}
+
+// Pin pins the item after the already pinned ones
+func (r *ItemOverrideRepo) Pin(ctx context.Context, listID string, pluginID string, itemID string) error {
+	return r.update(ctx, listID, pluginID, itemID, func(tx *gorm.DB, o *ItemOverride) error {
+		if o.Pinned {
+			return nil
+		}
+
+		var maxOrder int
+		err := tx.Model(&ItemOverrideModel{}).
+			Where("plugin_id = ? AND list_id = ? AND pinned", pluginID, listID).
+			Select("COALESCE(MAX(pin_order), -1)").
+			Scan(&maxOrder).Error
+		if err != nil {
+			return err
+		}
+
+		o.Pinned = true
+		o.PinOrder = maxOrder + 1
+		return nil
+	})
+}
+
+func (r *ItemOverrideRepo) Unpin(ctx context.Context, listID string, pluginID string, itemID string) error {
+	return r.update(ctx, listID, pluginID, itemID, func(_ *gorm.DB, o *ItemOverride) error {
+		o.Pinned = false
+		o.PinOrder = 0
+		return nil
+	})
+}
+
+// ReorderPins pins the items in the given order, other pinned items of the list keep their pins after them
+func (r *ItemOverrideRepo) ReorderPins(ctx context.Context, listID string, pluginID string, itemIDs []string) error {
+	if err := validateField("listID", listID); err != nil {
+		return err
+	}
+	if err := validateField("pluginID", pluginID); err != nil {
+		return err
+	}
+	for _, itemID := range itemIDs {
+		if err := validateField("itemID", itemID); err != nil {
+			return err
+		}
+	}
+
+	return r.conn.transaction(ctx, func(tx *gorm.DB) error {
+		var rows []ItemOverrideModel
+		if err := tx.
+			Where("plugin_id = ? AND list_id = ?", pluginID, listID).
+			Order("pin_order, item_id").
+			Find(&rows).Error; err != nil {
+			return err
+		}
+		current := make(map[string]ItemOverrideModel, len(rows))
+		for _, row := range rows {
+			current[row.ItemID] = row
+		}
+
+		upd := make([]ItemOverrideModel, 0, len(rows)+len(itemIDs))
+		seen := make(map[string]struct{}, len(itemIDs))
+		for _, itemID := range itemIDs {
+			if _, ok := seen[itemID]; ok {
+				continue
+			}
+			seen[itemID] = struct{}{}
+
+			row, ok := current[itemID]
+			if !ok {
+				row = ItemOverrideModel{ListID: listID, PluginID: pluginID, ItemID: itemID, Keywords: []string{}}
+			}
+			row.Pinned = true
+			row.PinOrder = len(upd)
+			upd = append(upd, row)
+		}
+		for _, row := range rows {
+			if _, ok := seen[row.ItemID]; ok || !row.Pinned {
+				continue
+			}
+			row.PinOrder = len(upd)
+			upd = append(upd, row)
+		}
+		if len(upd) == 0 {
+			return nil
+		}
+
+		return upsertItemOverrides(tx, upd)
+	})
+}
+
+func (r *ItemOverrideRepo) SetHidden(ctx context.Context, listID string, pluginID string, itemID string, hidden bool) error {
+	return r.update(ctx, listID, pluginID, itemID, func(_ *gorm.DB, o *ItemOverride) error {
+		o.Hidden = hidden
+		return nil
+	})
+}
+
+// SetAlias sets the custom title and keywords, nil title keeps the original one
+func (r *ItemOverrideRepo) SetAlias(
+	ctx context.Context,
+	listID string,
+	pluginID string,
+	itemID string,
+	title *string,
+	keywords []string,
+) error {
+	return r.update(ctx, listID, pluginID, itemID, func(_ *gorm.DB, o *ItemOverride) error {
+		o.Title = title
+		o.Keywords = keywords
+		return nil
+	})
+}
+
+func (r *ItemOverrideRepo) DeleteByPlugin(ctx context.Context, pluginID string) (int64, error) {
+	if err := validateField("pluginID", pluginID); err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	err := r.conn.write(ctx, func(db *gorm.DB) error {
+		res := db.
+			Where("plugin_id = ?", pluginID).
+			Delete(&ItemOverrideModel{})
+		affected = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+func (r *ItemOverrideRepo) DeleteByList(ctx context.Context, listID string) (int64, error) {
+	if err := validateField("listID", listID); err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	err := r.conn.write(ctx, func(db *gorm.DB) error {
+		res := db.
+			Where("list_id = ?", listID).
+			Delete(&ItemOverrideModel{})
+		affected = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// update changes the override of a single item in a transaction
+func (r *ItemOverrideRepo) update(
+	ctx context.Context,
+	listID string,
+	pluginID string,
+	itemID string,
+	fn func(tx *gorm.DB, o *ItemOverride) error,
+) error {
+	if err := r.validateIDs(listID, pluginID, itemID); err != nil {
+		return err
+	}
+
+	// metrics are reported for Pin, SetHidden, ... instead of update
+	ctx = withCallerOp(ctx, 1)
+	return r.conn.transaction(ctx, func(tx *gorm.DB) error {
+		var row ItemOverrideModel
+		err := tx.
+			Where("plugin_id = ? AND list_id = ? AND item_id = ?", pluginID, listID, itemID).
+			Limit(1).
+			Find(&row).Error
+		if err != nil {
+			return err
+		}
+
+		override := row.toOverride()
+		if err := fn(tx, &override); err != nil {
+			return err
+		}
+		if err := validateItemOverride(override); err != nil {
+			return err
+		}
+
+		if override.IsZero() {
+			return tx.
+				Where("plugin_id = ? AND list_id = ? AND item_id = ?", pluginID, listID, itemID).
+				Delete(&ItemOverrideModel{}).Error
+		}
+		return upsertItemOverrides(tx, []ItemOverrideModel{newItemOverrideModel(listID, pluginID, itemID, override)})
+	})
+}
+
+func (r *ItemOverrideRepo) validateIDs(listID string, pluginID string, itemID string) error {
+	if err := validateField("listID", listID); err != nil {
+		return err
+	}
+	if err := validateField("pluginID", pluginID); err != nil {
+		return err
+	}
+	return validateField("itemID", itemID)
+}
+
+func validateItemOverride(o ItemOverride) error {
+	if o.Title != nil {
+		if err := validateField("title", *o.Title); err != nil {
+			return err
+		}
+	}
+	for _, keyword := range o.Keywords {
+		if err := validateField("keyword", keyword); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func newItemOverrideModel(listID string, pluginID string, itemID string, o ItemOverride) ItemOverrideModel {
+	keywords := o.Keywords
+	if keywords == nil {
+		keywords = []string{}
+	}
+
+	pinOrder := o.PinOrder
+	if !o.Pinned {
+		pinOrder = 0
+	}
+
+	return ItemOverrideModel{
+		ListID:   listID,
+		PluginID: pluginID,
+		ItemID:   itemID,
+		Pinned:   o.Pinned,
+		PinOrder: pinOrder,
+		Hidden:   o.Hidden,
+		Title:    o.Title,
+		Keywords: keywords,
+	}
+}
+
+// Columns written over an existing override by upsertItemOverrides
+var itemOverrideUpdates = clause.AssignmentColumns([]string{"pinned", "pin_order", "hidden", "title", "keywords"})
+
+func upsertItemOverrides(db *gorm.DB, rows []ItemOverrideModel) error {
+	return insertItemOverrides(db, rows, itemOverrideUpdates).Error
+}
+
+// insertItemOverrides inserts rows, the existing ones get updates or are kept if it is empty
+func insertItemOverrides(db *gorm.DB, rows []ItemOverrideModel, updates clause.Set) *gorm.DB {
+	return db.
+		Clauses(clause.OnConflict{
+			Columns: []clause.Column{
+				{Name: "plugin_id"},
+				{Name: "list_id"},
+				{Name: "item_id"},
+			},
+			DoUpdates: updates,
+			DoNothing: len(updates) == 0,
+		}).
+		CreateInBatches(rows, setManyBatchSize)
+}
@@ -0,0 +1,190 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type ItemOverrideSuite struct {
+	suite.Suite
+	db *DB
+}
+
+func (s *ItemOverrideSuite) SetupTest() {
+	s.db = newTestDB(s.T(), newTestConfig(s.T()))
+}
+
+func (s *ItemOverrideSuite) TearDownTest() {
+	s.db.Close()
+}
+
+func (s *ItemOverrideSuite) pinned() []string {
+	t := s.T()
+
+	overrides, err := s.db.ItemOverride().Get(context.Background(), "apps", "desktop")
+	require.NoError(t, err)
+
+	ids := make([]string, 0, len(overrides))
+	for id, o := range overrides {
+		if o.Pinned {
+			ids = append(ids, id)
+		}
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return overrides[ids[i]].PinOrder < overrides[ids[j]].PinOrder
+	})
+	return ids
+}
+
+func (s *ItemOverrideSuite) TestSetAndGet() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.ItemOverride()
+
+	title := "Browser"
+	require.NoError(t, repo.Set(ctx, "apps", "desktop", "firefox", ItemOverride{
+		Pinned: true, PinOrder: 2, Title: &title, Keywords: []string{"web", "www"},
+	}))
+	require.NoError(t, repo.Set(ctx, "apps", "desktop", "avahi", ItemOverride{Hidden: true}))
+	require.NoError(t, repo.Set(ctx, "other", "desktop", "gimp", ItemOverride{Hidden: true}))
+
+	overrides, err := repo.Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.Equal(t, map[string]ItemOverride{
+		"firefox": {Pinned: true, PinOrder: 2, Title: &title, Keywords: []string{"web", "www"}},
+		"avahi":   {Hidden: true, Keywords: []string{}},
+	}, overrides)
+
+	// a zero override removes the row
+	require.NoError(t, repo.Set(ctx, "apps", "desktop", "avahi", ItemOverride{}))
+	overrides, err = repo.Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.NotContains(t, overrides, "avahi")
+}
+
+func (s *ItemOverrideSuite) TestPinOrder() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.ItemOverride()
+
+	for _, id := range []string{"firefox", "gimp", "vim"} {
+		require.NoError(t, repo.Pin(ctx, "apps", "desktop", id))
+	}
+	// pinning again keeps the position
+	require.NoError(t, repo.Pin(ctx, "apps", "desktop", "firefox"))
+	require.Equal(t, []string{"firefox", "gimp", "vim"}, s.pinned())
+
+	require.NoError(t, repo.Unpin(ctx, "apps", "desktop", "gimp"))
+	require.Equal(t, []string{"firefox", "vim"}, s.pinned())
+
+	require.NoError(t, repo.Pin(ctx, "apps", "desktop", "gimp"))
+	require.Equal(t, []string{"firefox", "vim", "gimp"}, s.pinned())
+
+	require.NoError(t, repo.ReorderPins(ctx, "apps", "desktop", []string{"gimp", "code", "gimp"}))
+	require.Equal(t, []string{"gimp", "code", "firefox", "vim"}, s.pinned())
+
+	// unpinned item without other changes is removed
+	require.NoError(t, repo.Unpin(ctx, "apps", "desktop", "code"))
+	overrides, err := repo.Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.NotContains(t, overrides, "code")
+}
+
+// A batch of rows with and without a title is written in one statement
+func (s *ItemOverrideSuite) TestReorderPinsMixedTitles() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.ItemOverride()
+
+	title := "Browser"
+	require.NoError(t, repo.SetAlias(ctx, "apps", "desktop", "firefox", &title, nil))
+	require.NoError(t, repo.Pin(ctx, "apps", "desktop", "firefox"))
+	require.NoError(t, repo.ReorderPins(ctx, "apps", "desktop", []string{"gimp", "firefox"}))
+	require.Equal(t, []string{"gimp", "firefox"}, s.pinned())
+
+	overrides, err := repo.Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.Equal(t, &title, overrides["firefox"].Title)
+	require.Nil(t, overrides["gimp"].Title)
+}
+
+func (s *ItemOverrideSuite) TestHiddenAndAlias() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.ItemOverride()
+
+	require.NoError(t, repo.Pin(ctx, "apps", "desktop", "firefox"))
+	require.NoError(t, repo.SetHidden(ctx, "apps", "desktop", "firefox", true))
+	title := "Browser"
+	require.NoError(t, repo.SetAlias(ctx, "apps", "desktop", "firefox", &title, []string{"web"}))
+
+	overrides, err := repo.Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.Equal(t, ItemOverride{Pinned: true, Hidden: true, Title: &title, Keywords: []string{"web"}}, overrides["firefox"])
+
+	require.NoError(t, repo.SetAlias(ctx, "apps", "desktop", "firefox", nil, nil))
+	require.NoError(t, repo.SetHidden(ctx, "apps", "desktop", "firefox", false))
+	overrides, err = repo.Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.Equal(t, ItemOverride{Pinned: true, Keywords: []string{}}, overrides["firefox"])
+}
+
+func (s *ItemOverrideSuite) TestDelete() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.ItemOverride()
+
+	require.NoError(t, repo.SetHidden(ctx, "apps", "desktop", "avahi", true))
+	require.NoError(t, repo.SetHidden(ctx, "apps", "files", "tmp", true))
+	require.NoError(t, repo.SetHidden(ctx, "other", "desktop", "avahi", true))
+
+	affected, err := repo.DeleteByList(ctx, "other")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, affected)
+
+	affected, err = repo.DeleteByPlugin(ctx, "desktop")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, affected)
+
+	overrides, err := repo.Get(ctx, "apps", "files")
+	require.NoError(t, err)
+	require.Len(t, overrides, 1)
+}
+
+func (s *ItemOverrideSuite) TestValidationError() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.ItemOverride()
+
+	var verr *ValidationError
+	err := repo.Pin(ctx, "apps", "desktop", "")
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, "itemID", verr.Field)
+
+	title := strings.Repeat("x", 256)
+	err = repo.SetAlias(ctx, "apps", "desktop", "firefox", &title, nil)
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, "title", verr.Field)
+	require.ErrorIs(t, err, ErrMustNotBeGreaterThan255)
+
+	err = repo.Set(ctx, "apps", "desktop", "firefox", ItemOverride{Keywords: []string{""}})
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, "keyword", verr.Field)
+}
+
+func (s *ItemOverrideSuite) TestClosed() {
+	t := s.T()
+
+	s.db.Close()
+	_, err := s.db.ItemOverride().Get(context.Background(), "apps", "desktop")
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestItemOverrideSuite(t *testing.T) {
+	suite.Run(t, new(ItemOverrideSuite))
+}
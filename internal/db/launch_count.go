@@ -2,159 +2,260 @@ package db
 
 import (
 	"context"
-	"errors"
+	"time"
 
-	"go.uber.org/zap"
 	"gorm.io/gorm"
 	"gorm.io/gorm/clause"
 )
 
-var (
-	ErrMustNotBeEmpty          = errors.New("must not be empty")
-	ErrMustNotBeGreaterThan255 = errors.New("length must be <= 255")
-)
-
 type LaunchCountModel struct {
 	ListID      string `gorm:"primaryKey;size:255;not null;index:idx_plugin_list,priority:2"`
 	PluginID    string `gorm:"primaryKey;size:255;not null;index:idx_plugin;index:idx_plugin_list,priority:1"`
 	ItemID      string `gorm:"primaryKey;size:255;not null"`
 	LaunchCount uint   `gorm:"not null;default:0"`
+	// Unix time when Reconcile first noticed that the item is gone, nil for live items
+	MissingSince *int64 `gorm:"default:null"`
 }
 
 func (LaunchCountModel) TableName() string {
 	return "launch_counts"
 }
 
+// ListKey identifies the items list of a plugin
+type ListKey struct {
+	ListID   string
+	PluginID string
+}
+
+const setManyBatchSize = 500
+
 type LaunchCountRepo struct {
-	db     *gorm.DB
-	logger *zap.Logger
+	conn *conn
+	now  func() time.Time
 }
 
-func (r *LaunchCountRepo) Get(ctx context.Context, listID string, pluginID string) (map[string]uint, bool) {
-	const method = "Get"
-	if !r.validateListID(listID, method) ||
-		!r.validatePluginID(pluginID, method) {
-		return nil, false
+func newLaunchCountRepo(conn *conn) *LaunchCountRepo {
+	return &LaunchCountRepo{
+		conn: conn,
+		now:  time.Now,
+	}
+}
+
+func (r *LaunchCountRepo) Get(ctx context.Context, listID string, pluginID string) (map[string]uint, error) {
+	if err := r.validateListID(listID); err != nil {
+		return nil, err
+	}
+	if err := r.validatePluginID(pluginID); err != nil {
+		return nil, err
 	}
 
 	var rows []LaunchCountModel
-	err := r.db.WithContext(ctx).
-		Where("plugin_id = ? AND list_id = ?", pluginID, listID).
-		Find(&rows).Error
+	err := r.conn.read(ctx, func(db *gorm.DB) error {
+		return db.
+			Where("plugin_id = ? AND list_id = ?", pluginID, listID).
+			Find(&rows).Error
+	})
 	if err != nil {
-		r.logger.Info("Failed to get launch counts",
-			zap.String("method", method),
-			zap.String("listID", listID),
-			zap.String("pluginID", pluginID),
-			zap.Error(err),
-		)
-		return nil, false
+		return nil, err
 	}
 
 	result := make(map[string]uint, len(rows))
 	for _, row := range rows {
 		result[row.ItemID] = row.LaunchCount
 	}
-	return result, true
-}
-
-func (r *LaunchCountRepo) Increment(ctx context.Context, listID string, pluginID string, itemID string) (uint, bool) {
-	const method = "Increment"
-	if !r.validateListID(listID, method) ||
-		!r.validatePluginID(pluginID, method) ||
-		!r.validateItemID(itemID, method) {
-		return 0, false
-	}
-
-	row := LaunchCountModel{
-		PluginID:    pluginID,
-		ListID:      listID,
-		ItemID:      itemID,
-		LaunchCount: 1,
-	}
-
-	// ON CONFLICT (plugin_id, list_id, item_id) DO UPDATE SET launch_count=launch_count+1, updated_at=CURRENT_TIMESTAMP
-	err := r.db.WithContext(ctx).
-		Clauses(clause.OnConflict{
-			Columns: []clause.Column{
-				{Name: "plugin_id"},
-				{Name: "list_id"},
-				{Name: "item_id"},
-			},
-			DoUpdates: clause.Assignments(map[string]interface{}{
-				"launch_count": gorm.Expr("launch_count + 1"),
-			}),
-		}).
-		Create(&row).Error
+	return result, nil
+}
+
+// GetItem returns ErrNotFound if the item was never launched
+func (r *LaunchCountRepo) GetItem(ctx context.Context, listID string, pluginID string, itemID string) (uint, error) {
+	if err := r.validateIDs(listID, pluginID, itemID); err != nil {
+		return 0, err
+	}
+
+	var row LaunchCountModel
+	err := r.conn.read(ctx, func(db *gorm.DB) error {
+		return db.
+			Where("plugin_id = ? AND list_id = ? AND item_id = ?", pluginID, listID, itemID).
+			First(&row).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return row.LaunchCount, nil
+}
+
+// Increment atomically increments the counter and returns its new value
+func (r *LaunchCountRepo) Increment(ctx context.Context, listID string, pluginID string, itemID string) (uint, error) {
+	if err := r.validateIDs(listID, pluginID, itemID); err != nil {
+		return 0, err
+	}
+
+	var count uint
+	err := r.conn.write(ctx, func(db *gorm.DB) error {
+		return r.increment(db, listID, pluginID, itemID, &count)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// IncrementMany increments the counters of all items in one transaction
+// and returns itemID => new value
+func (r *LaunchCountRepo) IncrementMany(
+	ctx context.Context,
+	listID string,
+	pluginID string,
+	itemIDs []string,
+) (map[string]uint, error) {
+	if err := r.validateListID(listID); err != nil {
+		return nil, err
+	}
+	if err := r.validatePluginID(pluginID); err != nil {
+		return nil, err
+	}
+	for _, itemID := range itemIDs {
+		if err := r.validateItemID(itemID); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[string]uint, len(itemIDs))
+	if len(itemIDs) == 0 {
+		return result, nil
+	}
+
+	err := r.conn.transaction(ctx, func(tx *gorm.DB) error {
+		for _, itemID := range itemIDs {
+			var count uint
+			if err := r.increment(tx, listID, pluginID, itemID, &count); err != nil {
+				return err
+			}
+			result[itemID] = count
+		}
+		return nil
+	})
 	if err != nil {
-		r.logger.Info("Failed to increment launch count",
-			zap.String("method", method),
-			zap.String("listID", listID),
-			zap.String("pluginID", pluginID),
-			zap.String("itemID", itemID),
-			zap.Error(err),
-		)
-		return 0, false
-	}
-
-	var result LaunchCountModel
-	err = r.db.WithContext(ctx).
-		Where("plugin_id = ? AND list_id = ? AND item_id = ?", pluginID, listID, itemID).
-		First(&result).Error
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// GetMany returns the counters of several lists at once
+func (r *LaunchCountRepo) GetMany(ctx context.Context, keys []ListKey) (map[ListKey]map[string]uint, error) {
+	for _, key := range keys {
+		if err := r.validateListID(key.ListID); err != nil {
+			return nil, err
+		}
+		if err := r.validatePluginID(key.PluginID); err != nil {
+			return nil, err
+		}
+	}
+
+	result := make(map[ListKey]map[string]uint, len(keys))
+	if len(keys) == 0 {
+		return result, nil
+	}
+
+	pairs := make([][]interface{}, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, []interface{}{key.PluginID, key.ListID})
+		result[key] = map[string]uint{}
+	}
+
+	var rows []LaunchCountModel
+	err := r.conn.read(ctx, func(db *gorm.DB) error {
+		return db.
+			Where("(plugin_id, list_id) IN ?", pairs).
+			Find(&rows).Error
+	})
 	if err != nil {
-		r.logger.Info("Failed to get launch count after increment",
-			zap.String("method", method),
-			zap.String("listID", listID),
-			zap.String("pluginID", pluginID),
-			zap.String("itemID", itemID),
-			zap.Error(err),
-		)
-		return 0, false
+		return nil, err
 	}
 
-	return result.LaunchCount, true
+	for _, row := range rows {
+		key := ListKey{ListID: row.ListID, PluginID: row.PluginID}
+		result[key][row.ItemID] = row.LaunchCount
+	}
+	return result, nil
 }
 
-func (r *LaunchCountRepo) DeleteByPlugin(ctx context.Context, pluginID string) (int64, bool) {
-	const method = "DeleteByPlugin"
-	if !r.validatePluginID(pluginID, method) {
-		return 0, false
+// SetMany overwrites the counters of the given items in one transaction, e.g. for imports
+func (r *LaunchCountRepo) SetMany(ctx context.Context, rows []LaunchCountModel) error {
+	for _, row := range rows {
+		if err := r.validateIDs(row.ListID, row.PluginID, row.ItemID); err != nil {
+			return err
+		}
 	}
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return r.conn.transaction(ctx, func(tx *gorm.DB) error {
+		return tx.
+			Clauses(clause.OnConflict{
+				Columns: []clause.Column{
+					{Name: "plugin_id"},
+					{Name: "list_id"},
+					{Name: "item_id"},
+				},
+				DoUpdates: clause.AssignmentColumns([]string{"launch_count"}),
+			}).
+			CreateInBatches(rows, setManyBatchSize).Error
+	})
+}
 
-	res := r.db.WithContext(ctx).
-		Where("plugin_id = ?", pluginID).
-		Delete(&LaunchCountModel{})
-	if res.Error != nil {
-		r.logger.Info("Failed to delete items by plugin",
-			zap.String("method", method),
-			zap.String("pluginID", pluginID),
-			zap.Error(res.Error),
-		)
-		return 0, false
+func (r *LaunchCountRepo) increment(db *gorm.DB, listID string, pluginID string, itemID string, count *uint) error {
+	// Single statement, safe under concurrent increments (SQLite >= 3.35)
+	return db.
+		Raw("INSERT INTO `launch_counts` (`list_id`, `plugin_id`, `item_id`, `launch_count`) VALUES (?, ?, ?, 1) "+
+			"ON CONFLICT (`plugin_id`, `list_id`, `item_id`) "+
+			"DO UPDATE SET `launch_count` = `launch_count` + 1, `missing_since` = NULL "+
+			"RETURNING `launch_count`", listID, pluginID, itemID).
+		Scan(count).Error
+}
+
+func (r *LaunchCountRepo) DeleteByPlugin(ctx context.Context, pluginID string) (int64, error) {
+	if err := r.validatePluginID(pluginID); err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	err := r.conn.write(ctx, func(db *gorm.DB) error {
+		res := db.
+			Where("plugin_id = ?", pluginID).
+			Delete(&LaunchCountModel{})
+		affected = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return res.RowsAffected, true
+	return affected, nil
 }
 
-func (r *LaunchCountRepo) DeleteByList(ctx context.Context, listID string) (int64, bool) {
-	const method = "DeleteByList"
-	if !r.validateListID(listID, method) {
-		return 0, false
+func (r *LaunchCountRepo) DeleteByList(ctx context.Context, listID string) (int64, error) {
+	if err := r.validateListID(listID); err != nil {
+		return 0, err
 	}
 
-	res := r.db.WithContext(ctx).
-		Where("list_id = ?", listID).
-		Delete(&LaunchCountModel{})
-	if res.Error != nil {
-		r.logger.Info("Failed to delete items by list",
-			zap.String("method", method),
-			zap.String("listID", listID),
-			zap.Error(res.Error),
-		)
-		return 0, false
+	var affected int64
+	err := r.conn.write(ctx, func(db *gorm.DB) error {
+		res := db.
+			Where("list_id = ?", listID).
+			Delete(&LaunchCountModel{})
+		affected = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	return res.RowsAffected, true
+	return affected, nil
 }
 
 func (r *LaunchCountRepo) DeleteItems(
@@ -162,67 +263,199 @@ func (r *LaunchCountRepo) DeleteItems(
 	listID string,
 	pluginID string,
 	itemIDs []string,
-) (int64, bool) {
-	const method = "DeleteItems"
-	if !r.validateListID(listID, method) ||
-		!r.validatePluginID(pluginID, method) {
-		return 0, false
+) (int64, error) {
+	if err := r.validateListID(listID); err != nil {
+		return 0, err
+	}
+	if err := r.validatePluginID(pluginID); err != nil {
+		return 0, err
 	}
 	for _, itemID := range itemIDs {
-		if !r.validateItemID(itemID, method) {
-			return 0, false
+		if err := r.validateItemID(itemID); err != nil {
+			return 0, err
 		}
 	}
 	if len(itemIDs) == 0 {
-		return 0, true
+		return 0, nil
+	}
+
+	var affected int64
+	err := r.conn.write(ctx, func(db *gorm.DB) error {
+		res := db.
+			Where("plugin_id = ? AND list_id = ? AND item_id IN ?", pluginID, listID, itemIDs).
+			Delete(&LaunchCountModel{})
+		affected = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// Reconcile prunes the counters of items that are not in liveIDs.
+// With a positive grace period an item is only marked as missing and is deleted
+// if it is still missing after grace, so a temporarily unavailable source keeps its history.
+// The query selections and overrides of missing items are removed with their counters,
+// or at once if the item was never launched, since it has no counter to track its grace period.
+// Returns the number of deleted counters.
+func (r *LaunchCountRepo) Reconcile(
+	ctx context.Context,
+	listID string,
+	pluginID string,
+	liveIDs []string,
+	grace time.Duration,
+) (int64, error) {
+	if err := r.validateListID(listID); err != nil {
+		return 0, err
+	}
+	if err := r.validatePluginID(pluginID); err != nil {
+		return 0, err
+	}
+	live := make(map[string]struct{}, len(liveIDs))
+	for _, itemID := range liveIDs {
+		if err := r.validateItemID(itemID); err != nil {
+			return 0, err
+		}
+		live[itemID] = struct{}{}
+	}
+
+	now := r.now()
+	var deleted int64
+	err := r.conn.transaction(ctx, func(tx *gorm.DB) error {
+		deleted = 0
+
+		var rows []LaunchCountModel
+		if err := tx.
+			Select("item_id", "missing_since").
+			Where("plugin_id = ? AND list_id = ?", pluginID, listID).
+			Find(&rows).Error; err != nil {
+			return err
+		}
+
+		var revived, missing, expired []string
+		for _, row := range rows {
+			_, isLive := live[row.ItemID]
+			switch {
+			case isLive && row.MissingSince != nil:
+				revived = append(revived, row.ItemID)
+			case isLive:
+				// pass
+			case grace <= 0 || (row.MissingSince != nil && now.Sub(time.Unix(*row.MissingSince, 0)) >= grace):
+				expired = append(expired, row.ItemID)
+			case row.MissingSince == nil:
+				missing = append(missing, row.ItemID)
+			}
+		}
+
+		scope := tx.Model(&LaunchCountModel{}).Where("plugin_id = ? AND list_id = ?", pluginID, listID)
+		for _, ids := range chunkStrings(revived, setManyBatchSize) {
+			if err := scope.Session(&gorm.Session{}).
+				Where("item_id IN ?", ids).
+				Update("missing_since", nil).Error; err != nil {
+				return err
+			}
+		}
+		for _, ids := range chunkStrings(missing, setManyBatchSize) {
+			if err := scope.Session(&gorm.Session{}).
+				Where("item_id IN ?", ids).
+				Update("missing_since", now.Unix()).Error; err != nil {
+				return err
+			}
+		}
+		for _, ids := range chunkStrings(expired, setManyBatchSize) {
+			res := scope.Session(&gorm.Session{}).
+				Where("item_id IN ?", ids).
+				Delete(&LaunchCountModel{})
+			if res.Error != nil {
+				return res.Error
+			}
+			deleted += res.RowsAffected
+		}
+
+		// items kept by a counter still in its grace period keep their selections and overrides too
+		kept := make(map[string]struct{}, len(rows))
+		for _, row := range rows {
+			kept[row.ItemID] = struct{}{}
+		}
+		for _, itemID := range expired {
+			delete(kept, itemID)
+		}
+
+		// the selections and overrides of a pruned item would never be used again,
+		// an item that was never launched has no counter but may have them
+		for _, model := range []any{&QuerySelectionModel{}, &ItemOverrideModel{}} {
+			var itemIDs []string
+			if err := tx.
+				Model(model).
+				Distinct("item_id").
+				Where("plugin_id = ? AND list_id = ?", pluginID, listID).
+				Pluck("item_id", &itemIDs).Error; err != nil {
+				return err
+			}
+
+			var stale []string
+			for _, itemID := range itemIDs {
+				_, isLive := live[itemID]
+				_, isKept := kept[itemID]
+				if !isLive && !isKept {
+					stale = append(stale, itemID)
+				}
+			}
+			for _, ids := range chunkStrings(stale, setManyBatchSize) {
+				if err := tx.
+					Where("plugin_id = ? AND list_id = ? AND item_id IN ?", pluginID, listID, ids).
+					Delete(model).Error; err != nil {
+					return err
+				}
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
 	}
 
-	res := r.db.WithContext(ctx).
-		Where("plugin_id = ? AND list_id = ? AND item_id IN ?", pluginID, listID, itemIDs).
-		Delete(&LaunchCountModel{})
-	if res.Error != nil {
-		r.logger.Info("Failed to delete items",
-			zap.String("method", method),
-			zap.String("listID", listID),
-			zap.String("pluginID", pluginID),
-			zap.Strings("itemIDs", itemIDs),
-			zap.Error(res.Error),
-		)
+	return deleted, nil
+}
 
-		return 0, false
+func chunkStrings(values []string, size int) [][]string {
+	chunks := make([][]string, 0, (len(values)+size-1)/size)
+	for len(values) > size {
+		chunks = append(chunks, values[:size])
+		values = values[size:]
+	}
+	if len(values) != 0 {
+		chunks = append(chunks, values)
 	}
 
-	return res.RowsAffected, true
+	return chunks
 }
 
-func (r *LaunchCountRepo) validateListID(v string, method string) bool {
-	return r.validateField("listID", v, method)
+func (r *LaunchCountRepo) validateIDs(listID string, pluginID string, itemID string) error {
+	if err := r.validateListID(listID); err != nil {
+		return err
+	}
+	if err := r.validatePluginID(pluginID); err != nil {
+		return err
+	}
+	return r.validateItemID(itemID)
 }
 
-func (r *LaunchCountRepo) validatePluginID(v string, method string) bool {
-	return r.validateField("pluginID", v, method)
+func (r *LaunchCountRepo) validateListID(v string) error {
+	return r.validateField("listID", v)
 }
 
-func (r *LaunchCountRepo) validateItemID(v string, method string) bool {
-	return r.validateField("itemID", v, method)
+func (r *LaunchCountRepo) validatePluginID(v string) error {
+	return r.validateField("pluginID", v)
 }
 
-func (r *LaunchCountRepo) validateField(fieldName string, v string, method string) bool {
-	var err error
-	if v == "" {
-		err = ErrMustNotBeEmpty
-	} else if len(v) > 255 {
-		err = ErrMustNotBeGreaterThan255
-	}
+func (r *LaunchCountRepo) validateItemID(v string) error {
+	return r.validateField("itemID", v)
+}
 
-	if err != nil {
-		r.logger.Warn("Validation failed",
-			zap.String("method", method),
-			zap.String("field", fieldName),
-			zap.String("value", v),
-			zap.Error(err),
-		)
-		return false
-	}
-	return true
+func (r *LaunchCountRepo) validateField(fieldName string, v string) error {
+	return validateField(fieldName, v)
 }
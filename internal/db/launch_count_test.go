@@ -0,0 +1,399 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type LaunchCountSuite struct {
+	suite.Suite
+	cfg *DBConfig
+	db  *DB
+}
+
+func (s *LaunchCountSuite) SetupTest() {
+	t := s.T()
+
+	s.cfg = newTestConfig(t)
+	s.db = newTestDB(t, s.cfg)
+}
+
+// reopenWithoutBusyWait makes SQLite report SQLITE_BUSY almost immediately
+func (s *LaunchCountSuite) reopenWithoutBusyWait() {
+	s.db.Close()
+	s.cfg.BusyTimeout = time.Millisecond
+	s.db = newTestDB(s.T(), s.cfg)
+}
+
+func (s *LaunchCountSuite) TearDownTest() {
+	s.db.Close()
+}
+
+// lockWriter holds the write lock of the database until the returned func is called
+func (s *LaunchCountSuite) lockWriter() func() {
+	t := s.T()
+	ctx := context.Background()
+
+	other, err := sql.Open("sqlite3", s.cfg.Path)
+	require.NoError(t, err)
+	conn, err := other.Conn(ctx)
+	require.NoError(t, err)
+	_, err = conn.ExecContext(ctx, "BEGIN IMMEDIATE")
+	require.NoError(t, err)
+
+	return func() {
+		_, err := conn.ExecContext(ctx, "COMMIT")
+		require.NoError(t, err)
+		require.NoError(t, conn.Close())
+		require.NoError(t, other.Close())
+	}
+}
+
+func (s *LaunchCountSuite) TestIncrementAndGet() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+
+	for i := uint(1); i <= 3; i++ {
+		n, err := repo.Increment(ctx, "list", "plugin", "firefox")
+		require.NoError(t, err)
+		require.Equal(t, i, n)
+	}
+	_, err := repo.Increment(ctx, "list", "plugin", "gimp")
+	require.NoError(t, err)
+
+	counts, err := repo.Get(ctx, "list", "plugin")
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint{"firefox": 3, "gimp": 1}, counts)
+
+	n, err := repo.GetItem(ctx, "list", "plugin", "firefox")
+	require.NoError(t, err)
+	require.EqualValues(t, 3, n)
+
+	_, err = repo.GetItem(ctx, "list", "plugin", "unknown")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func (s *LaunchCountSuite) TestDelete() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+
+	for _, id := range []string{"a", "b", "c"} {
+		_, err := repo.Increment(ctx, "list", "plugin", id)
+		require.NoError(t, err)
+	}
+	_, err := repo.Increment(ctx, "list2", "plugin2", "a")
+	require.NoError(t, err)
+
+	n, err := repo.DeleteItems(ctx, "list", "plugin", []string{"a", "x"})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	n, err = repo.DeleteItems(ctx, "list", "plugin", nil)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	n, err = repo.DeleteByList(ctx, "list")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+
+	n, err = repo.DeleteByPlugin(ctx, "plugin2")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+}
+
+func (s *LaunchCountSuite) TestConcurrentIncrement() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+
+	const workers = 8
+	const perWorker = 25
+
+	var wg sync.WaitGroup
+	errs := make(chan error, workers*perWorker)
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perWorker {
+				_, err := repo.Increment(ctx, "list", "plugin", "item")
+				errs <- err
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	n, err := repo.GetItem(ctx, "list", "plugin", "item")
+	require.NoError(t, err)
+	require.EqualValues(t, workers*perWorker, n)
+}
+
+func (s *LaunchCountSuite) TestIncrementMany() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+
+	_, err := repo.Increment(ctx, "list", "plugin", "a")
+	require.NoError(t, err)
+
+	counts, err := repo.IncrementMany(ctx, "list", "plugin", []string{"a", "b", "b"})
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint{"a": 2, "b": 2}, counts)
+
+	// nothing is written if one of the items is invalid
+	_, err = repo.IncrementMany(ctx, "list", "plugin", []string{"a", ""})
+	require.ErrorIs(t, err, ErrMustNotBeEmpty)
+
+	n, err := repo.GetItem(ctx, "list", "plugin", "a")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+}
+
+func (s *LaunchCountSuite) TestGetMany() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+
+	require.NoError(t, repo.SetMany(ctx, []LaunchCountModel{
+		{ListID: "apps", PluginID: "desktop", ItemID: "firefox", LaunchCount: 5},
+		{ListID: "apps", PluginID: "desktop", ItemID: "gimp", LaunchCount: 2},
+		{ListID: "files", PluginID: "desktop", ItemID: "doc", LaunchCount: 1},
+		{ListID: "apps", PluginID: "flatpak", ItemID: "org.gimp.GIMP", LaunchCount: 7},
+	}))
+
+	apps := ListKey{ListID: "apps", PluginID: "desktop"}
+	flatpak := ListKey{ListID: "apps", PluginID: "flatpak"}
+	empty := ListKey{ListID: "empty", PluginID: "desktop"}
+
+	counts, err := repo.GetMany(ctx, []ListKey{apps, flatpak, empty})
+	require.NoError(t, err)
+	require.Equal(t, map[ListKey]map[string]uint{
+		apps:    {"firefox": 5, "gimp": 2},
+		flatpak: {"org.gimp.GIMP": 7},
+		empty:   {},
+	}, counts)
+}
+
+func (s *LaunchCountSuite) TestSetMany() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+
+	_, err := repo.IncrementMany(ctx, "list", "plugin", []string{"a", "a", "a"})
+	require.NoError(t, err)
+
+	require.NoError(t, repo.SetMany(ctx, []LaunchCountModel{
+		{ListID: "list", PluginID: "plugin", ItemID: "a", LaunchCount: 1},
+		{ListID: "list", PluginID: "plugin", ItemID: "b", LaunchCount: 10},
+	}))
+
+	counts, err := repo.Get(ctx, "list", "plugin")
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint{"a": 1, "b": 10}, counts)
+
+	err = repo.SetMany(ctx, []LaunchCountModel{{ListID: "list", PluginID: "", ItemID: "c"}})
+	require.ErrorIs(t, err, ErrMustNotBeEmpty)
+}
+
+func (s *LaunchCountSuite) TestReconcile() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+
+	now := time.Unix(1_700_000_000, 0)
+	repo.now = func() time.Time { return now }
+
+	_, err := repo.IncrementMany(ctx, "list", "plugin", []string{"a", "b", "c"})
+	require.NoError(t, err)
+	_, err = repo.Increment(ctx, "list2", "plugin", "b")
+	require.NoError(t, err)
+
+	selections := s.db.QuerySelection()
+	selections.now = repo.now
+	overrides := s.db.ItemOverride()
+	for _, itemID := range []string{"a", "b"} {
+		require.NoError(t, selections.Record(ctx, "list", "plugin", "fire", itemID))
+		require.NoError(t, overrides.SetHidden(ctx, "list", "plugin", itemID, true))
+	}
+	require.NoError(t, selections.Record(ctx, "list2", "plugin", "fire", "b"))
+	require.NoError(t, overrides.SetHidden(ctx, "list2", "plugin", "b", true))
+
+	// b and c are gone: only marked
+	n, err := repo.Reconcile(ctx, "list", "plugin", []string{"a", "new"}, time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// c came back, b is still gone but grace is not over
+	now = now.Add(30 * time.Minute)
+	n, err = repo.Reconcile(ctx, "list", "plugin", []string{"a", "c"}, time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	now = now.Add(30 * time.Minute)
+	n, err = repo.Reconcile(ctx, "list", "plugin", []string{"a", "c"}, time.Hour)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+
+	counts, err := repo.Get(ctx, "list", "plugin")
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint{"a": 1, "c": 1}, counts)
+
+	// selections and overrides of b are gone with its counter
+	boosts, err := selections.Lookup(ctx, "list", "plugin", "fire")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, slices.Sorted(maps.Keys(boosts)))
+	hidden, err := overrides.Get(ctx, "list", "plugin")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, slices.Sorted(maps.Keys(hidden)))
+
+	// without grace period missing items are deleted at once
+	n, err = repo.Reconcile(ctx, "list", "plugin", nil, 0)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+
+	counts, err = repo.Get(ctx, "list2", "plugin")
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint{"b": 1}, counts)
+	boosts, err = selections.Lookup(ctx, "list2", "plugin", "fire")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, slices.Sorted(maps.Keys(boosts)))
+	hidden, err = overrides.Get(ctx, "list2", "plugin")
+	require.NoError(t, err)
+	require.Equal(t, []string{"b"}, slices.Sorted(maps.Keys(hidden)))
+}
+
+func (s *LaunchCountSuite) TestReconcileNeverLaunched() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+	overrides := s.db.ItemOverride()
+	selections := s.db.QuerySelection()
+
+	// hidden, pinned and picked by a query, but never launched
+	require.NoError(t, overrides.SetHidden(ctx, "list", "plugin", "hidden", true))
+	require.NoError(t, overrides.Pin(ctx, "list", "plugin", "pinned"))
+	require.NoError(t, overrides.Pin(ctx, "list", "plugin", "live"))
+	require.NoError(t, selections.Record(ctx, "list", "plugin", "pi", "pinned"))
+	require.NoError(t, overrides.SetHidden(ctx, "list2", "plugin", "hidden", true))
+	// launched, so its grace period applies
+	_, err := repo.Increment(ctx, "list", "plugin", "launched")
+	require.NoError(t, err)
+	require.NoError(t, overrides.SetHidden(ctx, "list", "plugin", "launched", true))
+
+	n, err := repo.Reconcile(ctx, "list", "plugin", []string{"live"}, time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	current, err := overrides.Get(ctx, "list", "plugin")
+	require.NoError(t, err)
+	require.Equal(t, []string{"launched", "live"}, slices.Sorted(maps.Keys(current)))
+	boosts, err := selections.Lookup(ctx, "list", "plugin", "pi")
+	require.NoError(t, err)
+	require.Empty(t, boosts)
+	current, err = overrides.Get(ctx, "list2", "plugin")
+	require.NoError(t, err)
+	require.Equal(t, []string{"hidden"}, slices.Sorted(maps.Keys(current)))
+}
+
+func (s *LaunchCountSuite) TestReconcileRevivedByIncrement() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+
+	now := time.Unix(1_700_000_000, 0)
+	repo.now = func() time.Time { return now }
+
+	_, err := repo.Increment(ctx, "list", "plugin", "a")
+	require.NoError(t, err)
+	_, err = repo.Reconcile(ctx, "list", "plugin", nil, time.Hour)
+	require.NoError(t, err)
+
+	// launched again, so it is live even if the next scan misses it
+	_, err = repo.Increment(ctx, "list", "plugin", "a")
+	require.NoError(t, err)
+
+	now = now.Add(2 * time.Hour)
+	n, err := repo.Reconcile(ctx, "list", "plugin", nil, time.Hour)
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
+func (s *LaunchCountSuite) TestValidationError() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+
+	_, err := repo.Increment(ctx, "list", "", "item")
+	var verr *ValidationError
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, "pluginID", verr.Field)
+	require.ErrorIs(t, err, ErrMustNotBeEmpty)
+
+	_, err = repo.DeleteItems(ctx, "list", "plugin", []string{"ok", strings.Repeat("x", 256)})
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, "itemID", verr.Field)
+	require.ErrorIs(t, err, ErrMustNotBeGreaterThan255)
+}
+
+func (s *LaunchCountSuite) TestBusyRetry() {
+	t := s.T()
+	ctx := context.Background()
+	s.reopenWithoutBusyWait()
+	repo := s.db.LaunchCount()
+
+	unlock := s.lockWriter()
+	go func() {
+		time.Sleep(2 * busyRetryDelay)
+		unlock()
+	}()
+
+	n, err := repo.Increment(ctx, "list", "plugin", "item")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, n)
+}
+
+func (s *LaunchCountSuite) TestBusy() {
+	t := s.T()
+	ctx := context.Background()
+	s.reopenWithoutBusyWait()
+	repo := s.db.LaunchCount()
+
+	unlock := s.lockWriter()
+	defer unlock()
+
+	_, err := repo.Increment(ctx, "list", "plugin", "item")
+	require.ErrorIs(t, err, ErrBusy)
+}
+
+func (s *LaunchCountSuite) TestClosed() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.LaunchCount()
+
+	s.db.Close()
+
+	_, err := repo.Get(ctx, "list", "plugin")
+	require.ErrorIs(t, err, ErrClosed)
+	_, err = repo.Increment(ctx, "list", "plugin", "item")
+	require.ErrorIs(t, err, ErrClosed)
+}
+
+func TestLaunchCountSuite(t *testing.T) {
+	suite.Run(t, new(LaunchCountSuite))
+}
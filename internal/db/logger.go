@@ -14,13 +14,21 @@ type DBLogger struct {
 	log           *zap.Logger
 	level         gormlogger.LogLevel
 	slowThreshold time.Duration
+	observers     []QueryObserver
 }
 
-func NewDBLogger(log *zap.Logger, level gormlogger.LogLevel, slowThreshold time.Duration) gormlogger.Interface {
+// NewDBLogger creates the GORM logger, observers get every statement regardless of the log level
+func NewDBLogger(
+	log *zap.Logger,
+	level gormlogger.LogLevel,
+	slowThreshold time.Duration,
+	observers ...QueryObserver,
+) gormlogger.Interface {
 	return &DBLogger{
 		log:           log,
 		level:         level,
 		slowThreshold: slowThreshold,
+		observers:     observers,
 	}
 }
 
@@ -31,32 +39,47 @@ func (l *DBLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
 }
 
 func (l *DBLogger) Info(ctx context.Context, s string, args ...interface{}) {
-	if l.level <= gormlogger.Info {
+	if l.level >= gormlogger.Info {
 		l.log.Sugar().Infow(fmt.Sprintf(s, args...), "caller", utils.FileWithLineNum())
 	}
 }
 
 func (l *DBLogger) Warn(ctx context.Context, s string, args ...interface{}) {
-	if l.level <= gormlogger.Warn {
+	if l.level >= gormlogger.Warn {
 		l.log.Sugar().Warnw(fmt.Sprintf(s, args...), "caller", utils.FileWithLineNum())
 	}
 }
 
 func (l *DBLogger) Error(ctx context.Context, s string, args ...interface{}) {
-	if l.level <= gormlogger.Error {
+	if l.level >= gormlogger.Error {
 		l.log.Sugar().Errorw(fmt.Sprintf(s, args...), "caller", utils.FileWithLineNum())
 	}
 }
 
 func (l *DBLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
-	if l.level == gormlogger.Silent {
+	if l.level == gormlogger.Silent && len(l.observers) == 0 {
 		return
 	}
 	elapsed := time.Since(begin)
 	sqlStr, rows := fc()
 
+	if len(l.observers) != 0 {
+		rec := QueryRecord{
+			Op:        queryOp(ctx),
+			Statement: statementKind(sqlStr),
+			SQL:       sqlStr,
+			Rows:      rows,
+			Begin:     begin,
+			Elapsed:   elapsed,
+			Err:       err,
+		}
+		for _, o := range l.observers {
+			o.ObserveQuery(ctx, rec)
+		}
+	}
+
 	switch {
-	case err != nil && l.level <= gormlogger.Error:
+	case err != nil && l.level >= gormlogger.Error:
 		l.log.Error("gorm",
 			zap.Error(err),
 			zap.String("sql", sqlStr),
@@ -64,14 +87,14 @@ func (l *DBLogger) Trace(ctx context.Context, begin time.Time, fc func() (string
 			zap.Duration("elapsed", elapsed),
 			zap.String("caller", utils.FileWithLineNum()),
 		)
-	case l.slowThreshold != 0 && elapsed > l.slowThreshold && l.level <= gormlogger.Warn:
+	case l.slowThreshold != 0 && elapsed > l.slowThreshold && l.level >= gormlogger.Warn:
 		l.log.Warn("gorm slow",
 			zap.String("sql", sqlStr),
 			zap.Int64("rows", rows),
 			zap.Duration("elapsed", elapsed),
 			zap.String("caller", utils.FileWithLineNum()),
 		)
-	case l.level <= gormlogger.Info:
+	case l.level >= gormlogger.Info:
 		l.log.Info("gorm",
 			zap.String("sql", sqlStr),
 			zap.Int64("rows", rows),
@@ -0,0 +1,48 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// TestLoggerLevels pins the GORM semantics: a level logs its own messages and the more severe ones
+func TestLoggerLevels(t *testing.T) {
+	ctx := context.Background()
+	sql := func() (string, int64) { return "SELECT 1", 1 }
+	slow := time.Now().Add(-time.Second)
+
+	tests := []struct {
+		level gormlogger.LogLevel
+		// messages logged by Info, Warn, Error, Trace with an error, slow Trace and Trace
+		logged []string
+	}{
+		{gormlogger.Silent, nil},
+		{gormlogger.Error, []string{"error", "gorm"}},
+		{gormlogger.Warn, []string{"warn", "error", "gorm", "gorm slow"}},
+		{gormlogger.Info, []string{"info", "warn", "error", "gorm", "gorm slow", "gorm"}},
+	}
+	for _, tt := range tests {
+		core, logs := observer.New(zap.DebugLevel)
+		l := NewDBLogger(zap.New(core), tt.level, time.Millisecond)
+
+		l.Info(ctx, "info")
+		l.Warn(ctx, "warn")
+		l.Error(ctx, "error")
+		l.Trace(ctx, time.Now(), sql, errors.New("failed"))
+		l.Trace(ctx, slow, sql, nil)
+		l.Trace(ctx, time.Now(), sql, nil)
+
+		var logged []string
+		for _, entry := range logs.All() {
+			logged = append(logged, entry.Message)
+		}
+		require.Equal(t, tt.logged, logged, "level %d", tt.level)
+	}
+}
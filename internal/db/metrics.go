@@ -0,0 +1,307 @@
+package db
+
+import (
+	"context"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Number of slow queries kept by QueryMetrics
+const slowQueryLogSize = 100
+
+// Upper bounds of the latency histogram buckets, the last bucket has no bound
+var latencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// QueryRecord describes a single executed SQL statement
+type QueryRecord struct {
+	// Repository call that executed the statement, e.g. "LaunchCountRepo.Increment".
+	// Empty for statements executed outside of repositories (migrations, maintenance).
+	Op string
+	// First keyword of the statement: SELECT, INSERT, ...
+	Statement string
+	SQL       string
+	Rows      int64
+	Begin     time.Time
+	Elapsed   time.Duration
+	Err       error
+}
+
+// QueryObserver receives every statement executed by the database.
+// ObserveQuery is called synchronously on the goroutine that ran the query, so it must be fast.
+type QueryObserver interface {
+	ObserveQuery(ctx context.Context, rec QueryRecord)
+}
+
+// QueryObserverFunc adapts a function to QueryObserver
+type QueryObserverFunc func(ctx context.Context, rec QueryRecord)
+
+func (f QueryObserverFunc) ObserveQuery(ctx context.Context, rec QueryRecord) {
+	f(ctx, rec)
+}
+
+// LatencyHistogram counts queries by latency, Counts[i] are queries with
+// latency <= Bounds[i], the last count is for queries slower than all bounds
+type LatencyHistogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+}
+
+// QueryStats aggregates the statements of one repository call
+type QueryStats struct {
+	Op         string
+	Count      uint64
+	Errors     uint64
+	Rows       int64
+	Total      time.Duration
+	Max        time.Duration
+	Histogram  LatencyHistogram
+	Statements map[string]uint64
+}
+
+type SlowQuery struct {
+	Op      string
+	SQL     string
+	Rows    int64
+	Begin   time.Time
+	Elapsed time.Duration
+	Err     error
+}
+
+// QueryMetrics is the built-in QueryObserver of DB.
+// It keeps aggregated stats per repository call and a ring buffer of slow queries.
+type QueryMetrics struct {
+	slowThreshold time.Duration
+
+	mu      sync.Mutex
+	stats   map[string]*QueryStats
+	slow    []SlowQuery
+	slowPos int
+}
+
+func newQueryMetrics(slowThreshold time.Duration) *QueryMetrics {
+	return &QueryMetrics{
+		slowThreshold: slowThreshold,
+		stats:         make(map[string]*QueryStats),
+		slow:          make([]SlowQuery, 0, slowQueryLogSize),
+	}
+}
+
+func (m *QueryMetrics) ObserveQuery(_ context.Context, rec QueryRecord) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	st, ok := m.stats[rec.Op]
+	if !ok {
+		st = &QueryStats{
+			Op: rec.Op,
+			Histogram: LatencyHistogram{
+				Bounds: latencyBuckets,
+				Counts: make([]uint64, len(latencyBuckets)+1),
+			},
+			Statements: make(map[string]uint64),
+		}
+		m.stats[rec.Op] = st
+	}
+
+	st.Count++
+	if rec.Err != nil {
+		st.Errors++
+	}
+	if rec.Rows > 0 {
+		st.Rows += rec.Rows
+	}
+	st.Total += rec.Elapsed
+	st.Max = max(st.Max, rec.Elapsed)
+	st.Histogram.Counts[sort.Search(len(latencyBuckets), func(i int) bool {
+		return rec.Elapsed <= latencyBuckets[i]
+	})]++
+	st.Statements[rec.Statement]++
+
+	if m.slowThreshold > 0 && rec.Elapsed > m.slowThreshold {
+		sq := SlowQuery{
+			Op:      rec.Op,
+			SQL:     rec.SQL,
+			Rows:    rec.Rows,
+			Begin:   rec.Begin,
+			Elapsed: rec.Elapsed,
+			Err:     rec.Err,
+		}
+		if len(m.slow) < slowQueryLogSize {
+			m.slow = append(m.slow, sq)
+		} else {
+			m.slow[m.slowPos] = sq
+		}
+		m.slowPos = (m.slowPos + 1) % slowQueryLogSize
+	}
+}
+
+// Stats returns a copy of the stats sorted by Op
+func (m *QueryMetrics) Stats() []QueryStats {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]QueryStats, 0, len(m.stats))
+	for _, st := range m.stats {
+		cp := *st
+		cp.Histogram.Counts = append([]uint64(nil), st.Histogram.Counts...)
+		cp.Statements = make(map[string]uint64, len(st.Statements))
+		for k, v := range st.Statements {
+			cp.Statements[k] = v
+		}
+		res = append(res, cp)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Op < res[j].Op
+	})
+	return res
+}
+
+// SlowQueries returns the last slow queries, newest first
+func (m *QueryMetrics) SlowQueries() []SlowQuery {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	res := make([]SlowQuery, 0, len(m.slow))
+	for i := 1; i <= len(m.slow); i++ {
+		res = append(res, m.slow[(m.slowPos-i+len(m.slow))%len(m.slow)])
+	}
+	return res
+}
+
+func (m *QueryMetrics) Reset() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.stats = make(map[string]*QueryStats)
+	m.slow = m.slow[:0]
+	m.slowPos = 0
+}
+
+// MemoryCollector keeps every observed query, for tests
+type MemoryCollector struct {
+	mu      sync.Mutex
+	records []QueryRecord
+}
+
+func NewMemoryCollector() *MemoryCollector {
+	return &MemoryCollector{}
+}
+
+func (c *MemoryCollector) ObserveQuery(_ context.Context, rec QueryRecord) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.records = append(c.records, rec)
+}
+
+func (c *MemoryCollector) Records() []QueryRecord {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]QueryRecord(nil), c.records...)
+}
+
+func (c *MemoryCollector) Reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.records = nil
+}
+
+// Span is a finished query in the shape of an OpenTelemetry span.
+// Attributes follow the OpenTelemetry database semantic conventions.
+type Span struct {
+	Name       string
+	StartTime  time.Time
+	EndTime    time.Time
+	Attributes map[string]any
+	Err        error
+}
+
+type SpanExporter interface {
+	ExportSpan(ctx context.Context, span Span)
+}
+
+// NewSpanObserver converts queries to spans for exporter
+func NewSpanObserver(exporter SpanExporter) QueryObserver {
+	return QueryObserverFunc(func(ctx context.Context, rec QueryRecord) {
+		name := rec.Op
+		if name == "" {
+			name = rec.Statement
+		}
+
+		exporter.ExportSpan(ctx, Span{
+			Name:      name,
+			StartTime: rec.Begin,
+			EndTime:   rec.Begin.Add(rec.Elapsed),
+			Attributes: map[string]any{
+				"db.system":                 "sqlite",
+				"db.operation.name":         rec.Statement,
+				"db.query.text":             rec.SQL,
+				"db.response.returned_rows": rec.Rows,
+			},
+			Err: rec.Err,
+		})
+	})
+}
+
+type queryOpKey struct{}
+
+// withCallerOp stores the name of the repository method that is skip frames above in ctx.
+// An op already stored in ctx is kept.
+func withCallerOp(ctx context.Context, skip int) context.Context {
+	if _, ok := ctx.Value(queryOpKey{}).(string); ok {
+		return ctx
+	}
+
+	pc, _, _, ok := runtime.Caller(skip + 1)
+	if !ok {
+		return ctx
+	}
+	fn := runtime.FuncForPC(pc)
+	if fn == nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, queryOpKey{}, opName(fn.Name()))
+}
+
+func queryOp(ctx context.Context) string {
+	op, _ := ctx.Value(queryOpKey{}).(string)
+	return op
+}
+
+var closureSuffix = regexp.MustCompile(`\.func\d+(\.\d+)*$`)
+
+// opName turns "github.com/x/db.(*LaunchCountRepo).Increment.func1" into "LaunchCountRepo.Increment"
+func opName(funcName string) string {
+	name := funcName[strings.LastIndex(funcName, "/")+1:]
+	if i := strings.Index(name, "."); i >= 0 {
+		name = name[i+1:]
+	}
+	name = closureSuffix.ReplaceAllString(name, "")
+	return strings.NewReplacer("(*", "", ")", "").Replace(name)
+}
+
+// statementKind returns the first keyword of the statement in upper case
+func statementKind(sql string) string {
+	sql = strings.TrimSpace(sql)
+	if i := strings.IndexAny(sql, " \t\n("); i >= 0 {
+		sql = sql[:i]
+	}
+	return strings.ToUpper(sql)
+}
@@ -0,0 +1,173 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"gorm.io/gorm"
+)
+
+type MetricsSuite struct {
+	suite.Suite
+	collector *MemoryCollector
+	db        *DB
+}
+
+func (s *MetricsSuite) SetupTest() {
+	t := s.T()
+
+	s.collector = NewMemoryCollector()
+	cfg := newTestConfig(t)
+	// every query is slow
+	cfg.SlowThreshold = time.Nanosecond
+	cfg.QueryObservers = []QueryObserver{s.collector}
+	s.db = newTestDB(t, cfg)
+	s.db.Metrics().Reset()
+	s.collector.Reset()
+}
+
+func (s *MetricsSuite) TearDownTest() {
+	s.db.Close()
+}
+
+func (s *MetricsSuite) stats(op string) QueryStats {
+	for _, st := range s.db.Metrics().Stats() {
+		if st.Op == op {
+			return st
+		}
+	}
+	s.T().Fatalf("no stats for %s", op)
+	return QueryStats{}
+}
+
+func (s *MetricsSuite) TestRepoCalls() {
+	t := s.T()
+	ctx := context.Background()
+
+	for range 3 {
+		_, err := s.db.LaunchCount().Increment(ctx, "apps", "desktop", "firefox")
+		require.NoError(t, err)
+	}
+	_, err := s.db.LaunchCount().Get(ctx, "apps", "desktop")
+	require.NoError(t, err)
+	require.NoError(t, s.db.ItemOverride().Pin(ctx, "apps", "desktop", "firefox"))
+
+	inc := s.stats("LaunchCountRepo.Increment")
+	require.EqualValues(t, 3, inc.Count)
+	require.EqualValues(t, 0, inc.Errors)
+	require.EqualValues(t, 3, inc.Statements["INSERT"])
+	var histTotal uint64
+	for _, c := range inc.Histogram.Counts {
+		histTotal += c
+	}
+	require.EqualValues(t, 3, histTotal)
+	require.LessOrEqual(t, inc.Max, inc.Total)
+
+	get := s.stats("LaunchCountRepo.Get")
+	require.EqualValues(t, 1, get.Count)
+	require.EqualValues(t, 1, get.Rows)
+
+	pin := s.stats("ItemOverrideRepo.Pin")
+	require.Positive(t, pin.Statements["SELECT"])
+	require.Positive(t, pin.Statements["INSERT"])
+
+	records := s.collector.Records()
+	require.NotEmpty(t, records)
+	require.Equal(t, "LaunchCountRepo.Increment", records[0].Op)
+	require.Contains(t, records[0].SQL, "launch_counts")
+
+	slow := s.db.Metrics().SlowQueries()
+	require.Equal(t, "ItemOverrideRepo.Pin", slow[0].Op)
+	require.Equal(t, "LaunchCountRepo.Increment", slow[len(slow)-1].Op)
+}
+
+func (s *MetricsSuite) TestErrors() {
+	t := s.T()
+
+	err := s.db.conn.read(context.Background(), func(db *gorm.DB) error {
+		return db.Exec("SELECT * FROM missing_table").Error
+	})
+	require.Error(t, err)
+
+	st := s.stats("MetricsSuite.TestErrors")
+	require.EqualValues(t, 1, st.Errors)
+	records := s.collector.Records()
+	require.Error(t, records[len(records)-1].Err)
+}
+
+func (s *MetricsSuite) TestSlowQueryRing() {
+	t := s.T()
+
+	m := newQueryMetrics(time.Millisecond)
+	m.ObserveQuery(context.Background(), QueryRecord{Op: "fast", Elapsed: time.Microsecond})
+	for i := range slowQueryLogSize + 10 {
+		m.ObserveQuery(context.Background(), QueryRecord{
+			Op:      "slow",
+			SQL:     fmt.Sprint(i),
+			Elapsed: time.Second,
+			Err:     errors.New("failed"),
+		})
+	}
+
+	slow := m.SlowQueries()
+	require.Len(t, slow, slowQueryLogSize)
+	require.Equal(t, fmt.Sprint(slowQueryLogSize+9), slow[0].SQL)
+	require.Equal(t, "10", slow[len(slow)-1].SQL)
+
+	stats := m.Stats()
+	require.Len(t, stats, 2)
+	require.Equal(t, "fast", stats[0].Op)
+	require.EqualValues(t, 1, stats[0].Histogram.Counts[0])
+	require.Equal(t, "slow", stats[1].Op)
+	require.EqualValues(t, slowQueryLogSize+10, stats[1].Errors)
+	require.EqualValues(t, slowQueryLogSize+10, stats[1].Histogram.Counts[len(latencyBuckets)-1])
+}
+
+type spanRecorder []Span
+
+func (r *spanRecorder) ExportSpan(_ context.Context, span Span) {
+	*r = append(*r, span)
+}
+
+func (s *MetricsSuite) TestSpans() {
+	t := s.T()
+
+	var spans spanRecorder
+	begin := time.Unix(1_700_000_000, 0)
+	NewSpanObserver(&spans).ObserveQuery(context.Background(), QueryRecord{
+		Op:        "LaunchCountRepo.Get",
+		Statement: "SELECT",
+		SQL:       "SELECT 1",
+		Rows:      1,
+		Begin:     begin,
+		Elapsed:   time.Millisecond,
+	})
+
+	require.Equal(t, spanRecorder{{
+		Name:      "LaunchCountRepo.Get",
+		StartTime: begin,
+		EndTime:   begin.Add(time.Millisecond),
+		Attributes: map[string]any{
+			"db.system":                 "sqlite",
+			"db.operation.name":         "SELECT",
+			"db.query.text":             "SELECT 1",
+			"db.response.returned_rows": int64(1),
+		},
+	}}, spans)
+}
+
+func TestOpName(t *testing.T) {
+	require.Equal(t, "LaunchCountRepo.Increment",
+		opName("github.com/Runix-Org/runix/internal/db.(*LaunchCountRepo).Increment.func1.2"))
+	require.Equal(t, "DB.Export", opName("github.com/Runix-Org/runix/internal/db.(*DB).Export"))
+	require.Equal(t, "SELECT", statementKind("  select * from t"))
+}
+
+func TestMetricsSuite(t *testing.T) {
+	suite.Run(t, new(MetricsSuite))
+}
@@ -0,0 +1,275 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSchemaTooNew         = errors.New("db schema is newer than supported")
+	ErrUnknownSchemaVersion = errors.New("unknown schema version")
+)
+
+type migration struct {
+	version int
+	name    string
+	up      []string
+	down    []string
+}
+
+// Append only. Never change a released migration, add a new one instead.
+// Statements of migrations that existed before versioning use IF NOT EXISTS,
+// because the tables could have been created by AutoMigrate.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "create launch_counts",
+		up: []string{
+			"CREATE TABLE IF NOT EXISTS `launch_counts` (" +
+				"`list_id` text NOT NULL," +
+				"`plugin_id` text NOT NULL," +
+				"`item_id` text NOT NULL," +
+				"`launch_count` integer NOT NULL DEFAULT 0," +
+				"PRIMARY KEY (`list_id`,`plugin_id`,`item_id`))",
+			"CREATE INDEX IF NOT EXISTS `idx_plugin` ON `launch_counts`(`plugin_id`)",
+			"CREATE INDEX IF NOT EXISTS `idx_plugin_list` ON `launch_counts`(`plugin_id`,`list_id`)",
+		},
+		down: []string{
+			"DROP TABLE `launch_counts`",
+		},
+	},
+	{
+		version: 2,
+		name:    "create query_selections",
+		up: []string{
+			"CREATE TABLE IF NOT EXISTS `query_selections` (" +
+				"`list_id` text NOT NULL," +
+				"`plugin_id` text NOT NULL," +
+				"`prefix` text NOT NULL," +
+				"`item_id` text NOT NULL," +
+				"`score` real NOT NULL DEFAULT 0," +
+				"`updated_at` integer NOT NULL DEFAULT 0," +
+				"PRIMARY KEY (`list_id`,`plugin_id`,`prefix`,`item_id`))",
+			"CREATE INDEX IF NOT EXISTS `idx_qs_plugin` ON `query_selections`(`plugin_id`)",
+			"CREATE INDEX IF NOT EXISTS `idx_qs_plugin_list` ON `query_selections`(`plugin_id`,`list_id`)",
+		},
+		down: []string{
+			"DROP TABLE `query_selections`",
+		},
+	},
+	{
+		version: 3,
+		name:    "add launch_counts.missing_since",
+		up: []string{
+			"ALTER TABLE `launch_counts` ADD COLUMN `missing_since` integer DEFAULT NULL",
+		},
+		down: []string{
+			"ALTER TABLE `launch_counts` DROP COLUMN `missing_since`",
+		},
+	},
+	{
+		version: 4,
+		name:    "create item_overrides",
+		up: []string{
+			"CREATE TABLE `item_overrides` (" +
+				"`list_id` text NOT NULL," +
+				"`plugin_id` text NOT NULL," +
+				"`item_id` text NOT NULL," +
+				"`pinned` numeric NOT NULL DEFAULT false," +
+				"`pin_order` integer NOT NULL DEFAULT 0," +
+				"`hidden` numeric NOT NULL DEFAULT false," +
+				"`title` text DEFAULT NULL," +
+				"`keywords` text NOT NULL DEFAULT '[]'," +
+				"PRIMARY KEY (`list_id`,`plugin_id`,`item_id`))",
+			"CREATE INDEX `idx_io_plugin` ON `item_overrides`(`plugin_id`)",
+			"CREATE INDEX `idx_io_plugin_list` ON `item_overrides`(`plugin_id`,`list_id`)",
+		},
+		down: []string{
+			"DROP TABLE `item_overrides`",
+		},
+	},
+	{
+		version: 5,
+		name:    "create plugin_kv",
+		up: []string{
+			"CREATE TABLE `plugin_kv` (" +
+				"`plugin_id` text NOT NULL," +
+				"`key` text NOT NULL," +
+				"`value` blob NOT NULL," +
+				"`size` integer NOT NULL," +
+				"`expires_at` integer DEFAULT NULL," +
+				"`updated_at` integer NOT NULL," +
+				"PRIMARY KEY (`plugin_id`,`key`))",
+			"CREATE INDEX `idx_kv_expires_at` ON `plugin_kv`(`expires_at`) WHERE `expires_at` IS NOT NULL",
+		},
+		down: []string{
+			"DROP TABLE `plugin_kv`",
+		},
+	},
+}
+
+func latestSchemaVersion() int {
+	return migrations[len(migrations)-1].version
+}
+
+type SchemaMigrationModel struct {
+	Version   int    `gorm:"primaryKey;autoIncrement:false"`
+	Name      string `gorm:"not null"`
+	AppliedAt int64  `gorm:"not null"`
+}
+
+func (SchemaMigrationModel) TableName() string {
+	return "schema_migrations"
+}
+
+type migrator struct {
+	db     *gorm.DB
+	cfg    *DBConfig
+	logger *zap.Logger
+}
+
+func newMigrator(db *gorm.DB, cfg *DBConfig, logger *zap.Logger) *migrator {
+	return &migrator{
+		db:     db,
+		cfg:    cfg,
+		logger: logger.With(zap.String("task", "migrate")),
+	}
+}
+
+func (m *migrator) currentVersion(ctx context.Context) (int, error) {
+	db := m.db.WithContext(ctx)
+	if err := db.Exec(
+		"CREATE TABLE IF NOT EXISTS `schema_migrations` (" +
+			"`version` integer NOT NULL PRIMARY KEY," +
+			"`name` text NOT NULL," +
+			"`applied_at` integer NOT NULL)",
+	).Error; err != nil {
+		return 0, fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	var version int
+	if err := db.Model(&SchemaMigrationModel{}).
+		Select("COALESCE(MAX(version), 0)").
+		Scan(&version).Error; err != nil {
+		return 0, fmt.Errorf("read schema version: %w", err)
+	}
+
+	return version, nil
+}
+
+func (m *migrator) migrate(ctx context.Context) error {
+	return m.migrateTo(ctx, latestSchemaVersion())
+}
+
+// migrateTo upgrades or downgrades the schema to the target version.
+// Version 0 is an empty database.
+func (m *migrator) migrateTo(ctx context.Context, target int) error {
+	if target < 0 || target > latestSchemaVersion() {
+		return fmt.Errorf("%w: %d", ErrUnknownSchemaVersion, target)
+	}
+
+	current, err := m.currentVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if current > latestSchemaVersion() {
+		return fmt.Errorf("%w: %d > %d", ErrSchemaTooNew, current, latestSchemaVersion())
+	}
+	if current == target {
+		return nil
+	}
+
+	if err := m.backup(ctx, current); err != nil {
+		return err
+	}
+
+	if current < target {
+		for _, mg := range migrations {
+			if mg.version <= current || mg.version > target {
+				continue
+			}
+			if err := m.apply(ctx, mg, true); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for i := len(migrations) - 1; i >= 0; i-- {
+		mg := migrations[i]
+		if mg.version > current || mg.version <= target {
+			continue
+		}
+		if err := m.apply(ctx, mg, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *migrator) apply(ctx context.Context, mg migration, up bool) error {
+	logger := m.logger.With(zap.Int("version", mg.version), zap.String("name", mg.name), zap.Bool("up", up))
+	logger.Info("Applying migration")
+
+	err := m.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		stmts := mg.down
+		if up {
+			stmts = mg.up
+		}
+		for _, stmt := range stmts {
+			if err := tx.Exec(stmt).Error; err != nil {
+				return err
+			}
+		}
+
+		if !up {
+			return tx.Delete(&SchemaMigrationModel{}, mg.version).Error
+		}
+		return tx.Create(&SchemaMigrationModel{
+			Version:   mg.version,
+			Name:      mg.name,
+			AppliedAt: time.Now().Unix(),
+		}).Error
+	})
+	if err != nil {
+		return fmt.Errorf("migration %d (%s): %w", mg.version, mg.name, err)
+	}
+
+	return nil
+}
+
+// backup copies the database before changing the schema.
+// Empty and in-memory databases are skipped.
+func (m *migrator) backup(ctx context.Context, version int) error {
+	if m.cfg.MemoryDB {
+		return nil
+	}
+
+	var tables int64
+	if err := m.db.WithContext(ctx).
+		Raw("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name NOT IN ('schema_migrations', 'sqlite_sequence')").
+		Scan(&tables).Error; err != nil {
+		return fmt.Errorf("count tables: %w", err)
+	}
+	if tables == 0 {
+		return nil
+	}
+
+	sqlDB, err := m.db.DB()
+	if err != nil {
+		return fmt.Errorf("get db: %w", err)
+	}
+
+	path := migrationBackupPath(m.cfg, version, time.Now())
+	if err := backupDatabase(ctx, sqlDB, path); err != nil {
+		return fmt.Errorf("backup before migration: %w", err)
+	}
+
+	m.logger.Info("Backup created before migration", zap.String("path", path), zap.Int("version", version))
+	return nil
+}
@@ -0,0 +1,257 @@
+package db
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// Schemas created by AutoMigrate before versioned migrations
+var (
+	legacyLaunchCountsSchema = []string{
+		"CREATE TABLE `launch_counts` (`list_id` text NOT NULL,`plugin_id` text NOT NULL,`item_id` text NOT NULL," +
+			"`launch_count` integer NOT NULL DEFAULT 0,PRIMARY KEY (`list_id`,`plugin_id`,`item_id`))",
+		"CREATE INDEX `idx_plugin` ON `launch_counts`(`plugin_id`)",
+		"CREATE INDEX `idx_plugin_list` ON `launch_counts`(`plugin_id`,`list_id`)",
+	}
+	legacyQuerySelectionsSchema = []string{
+		"CREATE TABLE `query_selections` (`list_id` text NOT NULL,`plugin_id` text NOT NULL,`prefix` text NOT NULL," +
+			"`item_id` text NOT NULL,`score` real NOT NULL DEFAULT 0,`updated_at` integer NOT NULL DEFAULT 0," +
+			"PRIMARY KEY (`list_id`,`plugin_id`,`prefix`,`item_id`))",
+		"CREATE INDEX `idx_qs_plugin` ON `query_selections`(`plugin_id`)",
+		"CREATE INDEX `idx_qs_plugin_list` ON `query_selections`(`plugin_id`,`list_id`)",
+	}
+)
+
+// Data that must survive every upgrade, by the version that introduced the table
+var fixtureSeeds = map[int][]string{
+	1: {
+		"INSERT INTO `launch_counts` (`list_id`, `plugin_id`, `item_id`, `launch_count`) " +
+			"VALUES ('list', 'plugin', 'firefox', 3)",
+	},
+	2: {
+		"INSERT INTO `query_selections` (`list_id`, `plugin_id`, `prefix`, `item_id`, `score`, `updated_at`) " +
+			"VALUES ('list', 'plugin', 'fi', 'firefox', 1, strftime('%s', 'now'))",
+	},
+	3: {
+		"INSERT INTO `launch_counts` (`list_id`, `plugin_id`, `item_id`, `launch_count`, `missing_since`) " +
+			"VALUES ('removed', 'plugin', 'gimp', 2, 1700000000)",
+	},
+	4: {
+		"INSERT INTO `item_overrides` (`list_id`, `plugin_id`, `item_id`, `pinned`, `pin_order`, `hidden`, `title`, `keywords`) " +
+			"VALUES ('list', 'plugin', 'firefox', true, 0, false, 'Browser', '[\"web\"]')",
+	},
+	5: {
+		"INSERT INTO `plugin_kv` (`plugin_id`, `key`, `value`, `size`, `expires_at`, `updated_at`) " +
+			"VALUES ('plugin', 'token', '\"secret\"', 13, NULL, 1700000000)",
+	},
+}
+
+type schemaFixture struct {
+	name string
+	// Schema of a database created before versioned migrations, nil for versioned ones
+	legacy [][]string
+	// Schema version the fixture is created with (for legacy: tables it contains)
+	version int
+}
+
+var schemaFixtures = []schemaFixture{
+	{name: "legacy launch_counts", legacy: [][]string{legacyLaunchCountsSchema}, version: 1},
+	{name: "legacy query_selections", legacy: [][]string{legacyLaunchCountsSchema, legacyQuerySelectionsSchema}, version: 2},
+	{name: "v1", version: 1},
+	{name: "v2", version: 2},
+	{name: "v3", version: 3},
+	{name: "v4", version: 4},
+	{name: "v5", version: 5},
+}
+
+type MigrateSuite struct {
+	suite.Suite
+}
+
+func (s *MigrateSuite) openRaw(cfg *DBConfig) *gorm.DB {
+	t := s.T()
+
+	require.NoError(t, cfg.validate())
+	gdb, err := gorm.Open(sqlite.Open(cfg.BuildDSN()), &gorm.Config{
+		Logger: NewDBLogger(zap.NewNop(), cfg.LogLevel, cfg.SlowThreshold),
+	})
+	require.NoError(t, err)
+	return gdb
+}
+
+func (s *MigrateSuite) closeRaw(gdb *gorm.DB) {
+	sqlDB, err := gdb.DB()
+	require.NoError(s.T(), err)
+	require.NoError(s.T(), sqlDB.Close())
+}
+
+func (s *MigrateSuite) createFixture(cfg *DBConfig, fx schemaFixture) {
+	t := s.T()
+	ctx := context.Background()
+
+	gdb := s.openRaw(cfg)
+	defer s.closeRaw(gdb)
+
+	if fx.legacy != nil {
+		for _, schema := range fx.legacy {
+			for _, stmt := range schema {
+				require.NoError(t, gdb.Exec(stmt).Error)
+			}
+		}
+	} else {
+		require.NoError(t, newMigrator(gdb, cfg, zap.NewNop()).migrateTo(ctx, fx.version))
+	}
+
+	for v := 1; v <= fx.version; v++ {
+		for _, stmt := range fixtureSeeds[v] {
+			require.NoError(t, gdb.Exec(stmt).Error)
+		}
+	}
+}
+
+func (s *MigrateSuite) checkFixtureData(db *DB, fx schemaFixture) {
+	t := s.T()
+	ctx := context.Background()
+
+	counts, err := db.LaunchCount().Get(ctx, "list", "plugin")
+	require.NoError(t, err)
+	require.Equal(t, map[string]uint{"firefox": 3}, counts)
+
+	boosts, err := db.QuerySelection().Lookup(ctx, "list", "plugin", "fi")
+	require.NoError(t, err)
+	if fx.version >= 2 {
+		require.Contains(t, boosts, "firefox")
+	} else {
+		require.Empty(t, boosts)
+	}
+
+	_, err = db.LaunchCount().GetItem(ctx, "removed", "plugin", "gimp")
+	if fx.version >= 3 {
+		require.NoError(t, err)
+	} else {
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+
+	overrides, err := db.ItemOverride().Get(ctx, "list", "plugin")
+	require.NoError(t, err)
+	if fx.version >= 4 {
+		title := "Browser"
+		require.Equal(t, map[string]ItemOverride{
+			"firefox": {Pinned: true, Title: &title, Keywords: []string{"web"}},
+		}, overrides)
+	} else {
+		require.Empty(t, overrides)
+	}
+
+	token, err := GetJSON[string](ctx, db.PluginKV(), "plugin", "token")
+	if fx.version >= 5 {
+		require.NoError(t, err)
+		require.Equal(t, "secret", token)
+	} else {
+		require.ErrorIs(t, err, ErrNotFound)
+	}
+}
+
+func (s *MigrateSuite) TestUpgradeFixtures() {
+	for _, fx := range schemaFixtures {
+		s.Run(fx.name, func() {
+			t := s.T()
+			ctx := context.Background()
+			cfg := newTestConfig(t)
+
+			s.createFixture(cfg, fx)
+
+			db := newTestDB(t, cfg)
+			defer db.Close()
+
+			version, err := newMigrator(db.writer, cfg, zap.NewNop()).currentVersion(ctx)
+			require.NoError(t, err)
+			require.Equal(t, latestSchemaVersion(), version)
+			s.checkFixtureData(db, fx)
+
+			backups, err := os.ReadDir(cfg.BackupDir)
+			if fx.legacy == nil && fx.version == latestSchemaVersion() {
+				require.True(t, os.IsNotExist(err))
+			} else {
+				require.NoError(t, err)
+				require.Len(t, backups, 1)
+			}
+		})
+	}
+}
+
+func (s *MigrateSuite) TestDowngrade() {
+	t := s.T()
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+
+	gdb := s.openRaw(cfg)
+	defer s.closeRaw(gdb)
+
+	m := newMigrator(gdb, cfg, zap.NewNop())
+	require.NoError(t, m.migrate(ctx))
+	for v := latestSchemaVersion() - 1; v >= 0; v-- {
+		require.NoError(t, m.migrateTo(ctx, v))
+		version, err := m.currentVersion(ctx)
+		require.NoError(t, err)
+		require.Equal(t, v, version)
+	}
+
+	var tables []string
+	require.NoError(t, gdb.Raw("SELECT name FROM sqlite_master WHERE type = 'table'").Scan(&tables).Error)
+	require.Equal(t, []string{"schema_migrations"}, tables)
+
+	require.ErrorIs(t, m.migrateTo(ctx, latestSchemaVersion()+1), ErrUnknownSchemaVersion)
+}
+
+func (s *MigrateSuite) TestRejectNewerSchema() {
+	t := s.T()
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+
+	gdb := s.openRaw(cfg)
+	m := newMigrator(gdb, cfg, zap.NewNop())
+	require.NoError(t, m.migrate(ctx))
+	require.NoError(t, gdb.Create(&SchemaMigrationModel{Version: latestSchemaVersion() + 1, Name: "future"}).Error)
+	require.ErrorIs(t, m.migrate(ctx), ErrSchemaTooNew)
+	s.closeRaw(gdb)
+
+	_, err := New(ctx, cfg, zap.NewNop())
+	require.ErrorIs(t, err, ErrSchemaTooNew)
+}
+
+func (s *MigrateSuite) TestFailedMigrationRollsBack() {
+	t := s.T()
+	ctx := context.Background()
+	cfg := newTestConfig(t)
+
+	gdb := s.openRaw(cfg)
+	defer s.closeRaw(gdb)
+
+	m := newMigrator(gdb, cfg, zap.NewNop())
+	err := m.apply(ctx, migration{
+		version: latestSchemaVersion() + 1,
+		name:    "broken",
+		up:      []string{"CREATE TABLE `tmp` (`id` integer)", "NOT SQL"},
+	}, true)
+	require.Error(t, err)
+
+	var tables int64
+	require.NoError(t, gdb.Raw("SELECT COUNT(*) FROM sqlite_master WHERE name = 'tmp'").Scan(&tables).Error)
+	require.Zero(t, tables)
+
+	version, err := m.currentVersion(ctx)
+	require.NoError(t, err)
+	require.Zero(t, version)
+}
+
+func TestMigrateSuite(t *testing.T) {
+	suite.Run(t, new(MigrateSuite))
+}
@@ -0,0 +1,285 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrInvalidJSON   = errors.New("value is not valid JSON")
+	ErrQuotaExceeded = errors.New("plugin storage quota exceeded")
+)
+
+type PluginKVModel struct {
+	PluginID string `gorm:"primaryKey;size:255;not null"`
+	Key      string `gorm:"primaryKey;size:255;not null"`
+	Value    []byte `gorm:"not null"`
+	// Size of key and value in bytes, counted against the quota
+	Size int64 `gorm:"not null"`
+	// Unix time, nil if the value does not expire
+	ExpiresAt *int64 `gorm:"default:null"`
+	UpdatedAt int64  `gorm:"not null;autoUpdateTime:false"`
+}
+
+func (PluginKVModel) TableName() string {
+	return "plugin_kv"
+}
+
+// PluginKVRepo stores JSON values of plugins, namespaced by plugin ID
+type PluginKVRepo struct {
+	conn *conn
+	// Max size of all keys and values of a plugin in bytes
+	quota int64
+	now   func() time.Time
+}
+
+func newPluginKVRepo(conn *conn, quota int64) *PluginKVRepo {
+	return &PluginKVRepo{
+		conn:  conn,
+		quota: quota,
+		now:   time.Now,
+	}
+}
+
+// Get returns the raw JSON value, ErrNotFound if the key is missing or expired
+func (r *PluginKVRepo) Get(ctx context.Context, pluginID string, key string) (json.RawMessage, error) {
+	if err := r.validateKey(pluginID, key); err != nil {
+		return nil, err
+	}
+
+	var row PluginKVModel
+	err := r.conn.read(ctx, func(db *gorm.DB) error {
+		return db.
+			Where("plugin_id = ? AND key = ?", pluginID, key).
+			Where("expires_at IS NULL OR expires_at > ?", r.now().Unix()).
+			Take(&row).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return row.Value, nil
+}
+
+// Set stores the raw JSON value, a value with ttl > 0 expires after ttl.
+// ErrQuotaExceeded is returned if the plugin would use more than its quota.
+func (r *PluginKVRepo) Set(
+	ctx context.Context,
+	pluginID string,
+	key string,
+	value json.RawMessage,
+	ttl time.Duration,
+) error {
+	if err := r.validateKey(pluginID, key); err != nil {
+		return err
+	}
+	if !json.Valid(value) {
+		return &ValidationError{Field: "value", Value: key, Reason: ErrInvalidJSON}
+	}
+
+	now := r.now()
+	row := PluginKVModel{
+		PluginID:  pluginID,
+		Key:       key,
+		Value:     value,
+		Size:      int64(len(key) + len(value)),
+		UpdatedAt: now.Unix(),
+	}
+	if ttl > 0 {
+		expiresAt := now.Add(ttl).Unix()
+		row.ExpiresAt = &expiresAt
+	}
+
+	return r.conn.transaction(ctx, func(tx *gorm.DB) error {
+		var used int64
+		err := tx.Model(&PluginKVModel{}).
+			Where("plugin_id = ? AND key <> ?", pluginID, key).
+			Where("expires_at IS NULL OR expires_at > ?", now.Unix()).
+			Select("COALESCE(SUM(size), 0)").
+			Scan(&used).Error
+		if err != nil {
+			return err
+		}
+		if used+row.Size > r.quota {
+			return fmt.Errorf("%w: %s uses %d of %d bytes, %d more requested",
+				ErrQuotaExceeded, pluginID, used, r.quota, row.Size)
+		}
+
+		return tx.
+			Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "plugin_id"}, {Name: "key"}},
+				DoUpdates: clause.AssignmentColumns([]string{"value", "size", "expires_at", "updated_at"}),
+			}).
+			Create(&row).Error
+	})
+}
+
+// Usage returns the number of bytes used by the live keys of the plugin
+func (r *PluginKVRepo) Usage(ctx context.Context, pluginID string) (int64, error) {
+	if err := validateField("pluginID", pluginID); err != nil {
+		return 0, err
+	}
+
+	var used int64
+	err := r.conn.read(ctx, func(db *gorm.DB) error {
+		return db.Model(&PluginKVModel{}).
+			Where("plugin_id = ?", pluginID).
+			Where("expires_at IS NULL OR expires_at > ?", r.now().Unix()).
+			Select("COALESCE(SUM(size), 0)").
+			Scan(&used).Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return used, nil
+}
+
+// Keys returns the live keys of the plugin, sorted
+func (r *PluginKVRepo) Keys(ctx context.Context, pluginID string) ([]string, error) {
+	if err := validateField("pluginID", pluginID); err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	err := r.conn.read(ctx, func(db *gorm.DB) error {
+		return db.Model(&PluginKVModel{}).
+			Where("plugin_id = ?", pluginID).
+			Where("expires_at IS NULL OR expires_at > ?", r.now().Unix()).
+			Order("key").
+			Pluck("key", &keys).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+func (r *PluginKVRepo) Delete(ctx context.Context, pluginID string, key string) error {
+	if err := r.validateKey(pluginID, key); err != nil {
+		return err
+	}
+
+	return r.conn.write(ctx, func(db *gorm.DB) error {
+		return db.
+			Where("plugin_id = ? AND key = ?", pluginID, key).
+			Delete(&PluginKVModel{}).Error
+	})
+}
+
+func (r *PluginKVRepo) DeleteByPlugin(ctx context.Context, pluginID string) (int64, error) {
+	if err := validateField("pluginID", pluginID); err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	err := r.conn.write(ctx, func(db *gorm.DB) error {
+		res := db.
+			Where("plugin_id = ?", pluginID).
+			Delete(&PluginKVModel{})
+		affected = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// DeleteExpired removes the expired keys of all plugins
+func (r *PluginKVRepo) DeleteExpired(ctx context.Context) (int64, error) {
+	var affected int64
+	err := r.conn.write(ctx, func(db *gorm.DB) error {
+		res := db.
+			Where("expires_at IS NOT NULL AND expires_at <= ?", r.now().Unix()).
+			Delete(&PluginKVModel{})
+		affected = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+func (r *PluginKVRepo) validateKey(pluginID string, key string) error {
+	if err := validateField("pluginID", pluginID); err != nil {
+		return err
+	}
+	return validateField("key", key)
+}
+
+// GetJSON decodes the value of the key into T
+func GetJSON[T any](ctx context.Context, r *PluginKVRepo, pluginID string, key string) (T, error) {
+	var v T
+	raw, err := r.Get(ctx, pluginID, key)
+	if err != nil {
+		return v, err
+	}
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return v, fmt.Errorf("decode %s/%s: %w", pluginID, key, err)
+	}
+
+	return v, nil
+}
+
+// SetJSON encodes v and stores it, see PluginKVRepo.Set
+func SetJSON[T any](
+	ctx context.Context,
+	r *PluginKVRepo,
+	pluginID string,
+	key string,
+	v T,
+	ttl time.Duration,
+) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("encode %s/%s: %w", pluginID, key, err)
+	}
+
+	return r.Set(ctx, pluginID, key, raw, ttl)
+}
+
+// runCleanup removes expired plugin keys and forgotten query selections every interval until ctx is done
+func (db *DB) runCleanup(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := db.pluginKV.DeleteExpired(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					db.logger.Warn("Failed removing expired plugin keys", zap.Error(err))
+				}
+				continue
+			}
+			if deleted != 0 {
+				db.logger.Debug("Expired plugin keys removed", zap.Int64("count", deleted))
+			}
+
+			deleted, err = db.querySel.DeleteForgotten(ctx)
+			if err != nil {
+				if ctx.Err() == nil {
+					db.logger.Warn("Failed removing forgotten query selections", zap.Error(err))
+				}
+				continue
+			}
+			if deleted != 0 {
+				db.logger.Debug("Forgotten query selections removed", zap.Int64("count", deleted))
+			}
+		}
+	}
+}
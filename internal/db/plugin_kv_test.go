@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type PluginKVSuite struct {
+	suite.Suite
+	db  *DB
+	now time.Time
+}
+
+func (s *PluginKVSuite) SetupTest() {
+	t := s.T()
+
+	cfg := newTestConfig(t)
+	cfg.PluginKVQuota = 64
+	s.db = newTestDB(t, cfg)
+	s.now = time.Unix(1_700_000_000, 0)
+	s.db.PluginKV().now = func() time.Time { return s.now }
+}
+
+func (s *PluginKVSuite) TearDownTest() {
+	s.db.Close()
+}
+
+type searchState struct {
+	Query string `json:"query"`
+	Page  int    `json:"page"`
+}
+
+func (s *PluginKVSuite) TestSetAndGet() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.PluginKV()
+
+	require.NoError(t, SetJSON(ctx, repo, "web", "state", searchState{Query: "go", Page: 2}, 0))
+	state, err := GetJSON[searchState](ctx, repo, "web", "state")
+	require.NoError(t, err)
+	require.Equal(t, searchState{Query: "go", Page: 2}, state)
+
+	require.NoError(t, repo.Set(ctx, "web", "state", json.RawMessage(`{"query":"rust"}`), 0))
+	raw, err := repo.Get(ctx, "web", "state")
+	require.NoError(t, err)
+	require.JSONEq(t, `{"query":"rust"}`, string(raw))
+
+	// keys are namespaced by plugin
+	_, err = repo.Get(ctx, "files", "state")
+	require.ErrorIs(t, err, ErrNotFound)
+
+	require.NoError(t, repo.Delete(ctx, "web", "state"))
+	_, err = GetJSON[searchState](ctx, repo, "web", "state")
+	require.ErrorIs(t, err, ErrNotFound)
+}
+
+func (s *PluginKVSuite) TestTTL() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.PluginKV()
+
+	require.NoError(t, SetJSON(ctx, repo, "web", "cache", []string{"a", "b"}, time.Minute))
+	require.NoError(t, SetJSON(ctx, repo, "web", "token", "secret", 0))
+
+	keys, err := repo.Keys(ctx, "web")
+	require.NoError(t, err)
+	require.Equal(t, []string{"cache", "token"}, keys)
+
+	s.now = s.now.Add(time.Minute)
+	_, err = repo.Get(ctx, "web", "cache")
+	require.ErrorIs(t, err, ErrNotFound)
+	keys, err = repo.Keys(ctx, "web")
+	require.NoError(t, err)
+	require.Equal(t, []string{"token"}, keys)
+
+	deleted, err := repo.DeleteExpired(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 1, deleted)
+}
+
+func (s *PluginKVSuite) TestQuota() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.PluginKV()
+
+	value := `"` + strings.Repeat("x", 27) + `"`
+	require.NoError(t, repo.Set(ctx, "web", "k1", json.RawMessage(value), 0))
+	require.NoError(t, repo.Set(ctx, "web", "k2", json.RawMessage(value), time.Minute))
+	used, err := repo.Usage(ctx, "web")
+	require.NoError(t, err)
+	require.EqualValues(t, 62, used)
+
+	err = repo.Set(ctx, "web", "k3", json.RawMessage(`1`), 0)
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+
+	// other plugins have their own quota, overwriting a key does not count its old value
+	require.NoError(t, repo.Set(ctx, "files", "k3", json.RawMessage(`1`), 0))
+	require.NoError(t, repo.Set(ctx, "web", "k2", json.RawMessage(value), 0))
+
+	// expired keys do not count
+	require.NoError(t, repo.Set(ctx, "web", "k2", json.RawMessage(value), time.Minute))
+	s.now = s.now.Add(time.Minute)
+	require.NoError(t, repo.Set(ctx, "web", "k3", json.RawMessage(`1`), 0))
+}
+
+func (s *PluginKVSuite) TestDeleteByPlugin() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.PluginKV()
+
+	require.NoError(t, SetJSON(ctx, repo, "web", "a", 1, 0))
+	require.NoError(t, SetJSON(ctx, repo, "web", "b", 2, time.Hour))
+	require.NoError(t, SetJSON(ctx, repo, "files", "a", 3, 0))
+
+	deleted, err := repo.DeleteByPlugin(ctx, "web")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, deleted)
+
+	keys, err := repo.Keys(ctx, "files")
+	require.NoError(t, err)
+	require.Equal(t, []string{"a"}, keys)
+}
+
+func (s *PluginKVSuite) TestValidationError() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.PluginKV()
+
+	var verr *ValidationError
+	err := repo.Set(ctx, "web", "", json.RawMessage(`1`), 0)
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, "key", verr.Field)
+
+	err = repo.Set(ctx, "web", "state", json.RawMessage(`{`), 0)
+	require.ErrorIs(t, err, ErrInvalidJSON)
+
+	_, err = repo.DeleteByPlugin(ctx, "")
+	require.ErrorAs(t, err, &verr)
+	require.Equal(t, "pluginID", verr.Field)
+}
+
+func TestPluginKVSuite(t *testing.T) {
+	suite.Run(t, new(PluginKVSuite))
+}
@@ -0,0 +1,281 @@
+package db
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	// Time after which the weight of a selection is halved
+	querySelectionHalfLife = 14 * 24 * time.Hour
+	// Longer queries are truncated, the tail rarely changes the choice
+	querySelectionMaxPrefix = 32
+	// Boosts below this value are considered forgotten
+	querySelectionMinBoost = 0.01
+)
+
+type QuerySelectionModel struct {
+	ListID   string  `gorm:"primaryKey;size:255;not null;index:idx_qs_plugin_list,priority:2"`
+	PluginID string  `gorm:"primaryKey;size:255;not null;index:idx_qs_plugin;index:idx_qs_plugin_list,priority:1"`
+	Prefix   string  `gorm:"primaryKey;size:255;not null"`
+	ItemID   string  `gorm:"primaryKey;size:255;not null"`
+	Score    float64 `gorm:"not null;default:0"`
+	// Unix time of the last score update
+	UpdatedAt int64 `gorm:"not null;default:0;autoUpdateTime:false"`
+}
+
+func (QuerySelectionModel) TableName() string {
+	return "query_selections"
+}
+
+// QuerySelectionRepo remembers which item the user picks for a given query prefix.
+// Scores decay exponentially, so recent choices outweigh old ones.
+type QuerySelectionRepo struct {
+	conn     *conn
+	halfLife time.Duration
+	now      func() time.Time
+}
+
+func newQuerySelectionRepo(conn *conn) *QuerySelectionRepo {
+	return &QuerySelectionRepo{
+		conn:     conn,
+		halfLife: querySelectionHalfLife,
+		now:      time.Now,
+	}
+}
+
+// Record stores the selection of itemID for every prefix of query
+func (r *QuerySelectionRepo) Record(
+	ctx context.Context,
+	listID string,
+	pluginID string,
+	query string,
+	itemID string,
+) error {
+	if err := r.validateIDs(listID, pluginID, itemID); err != nil {
+		return err
+	}
+
+	prefixes := queryPrefixes(query)
+	if len(prefixes) == 0 {
+		return nil
+	}
+
+	now := r.now().Unix()
+	return r.conn.transaction(ctx, func(tx *gorm.DB) error {
+		var rows []QuerySelectionModel
+		err := tx.
+			Where("plugin_id = ? AND list_id = ? AND item_id = ? AND prefix IN ?", pluginID, listID, itemID, prefixes).
+			Find(&rows).Error
+		if err != nil {
+			return err
+		}
+
+		scores := make(map[string]float64, len(rows))
+		for _, row := range rows {
+			scores[row.Prefix] = r.decay(row.Score, row.UpdatedAt, now)
+		}
+
+		upd := make([]QuerySelectionModel, 0, len(prefixes))
+		for _, prefix := range prefixes {
+			upd = append(upd, QuerySelectionModel{
+				ListID:    listID,
+				PluginID:  pluginID,
+				Prefix:    prefix,
+				ItemID:    itemID,
+				Score:     scores[prefix] + 1,
+				UpdatedAt: now,
+			})
+		}
+
+		return tx.
+			Clauses(clause.OnConflict{
+				Columns: []clause.Column{
+					{Name: "plugin_id"},
+					{Name: "list_id"},
+					{Name: "prefix"},
+					{Name: "item_id"},
+				},
+				DoUpdates: clause.AssignmentColumns([]string{"score", "updated_at"}),
+			}).
+			Create(&upd).Error
+	})
+}
+
+// Lookup returns itemID => boost for the query, already decayed to the current time.
+// Forgotten selections are omitted.
+func (r *QuerySelectionRepo) Lookup(
+	ctx context.Context,
+	listID string,
+	pluginID string,
+	query string,
+) (map[string]float64, error) {
+	if err := r.validateListID(listID); err != nil {
+		return nil, err
+	}
+	if err := r.validatePluginID(pluginID); err != nil {
+		return nil, err
+	}
+
+	prefixes := queryPrefixes(query)
+	if len(prefixes) == 0 {
+		return map[string]float64{}, nil
+	}
+
+	var rows []QuerySelectionModel
+	err := r.conn.read(ctx, func(db *gorm.DB) error {
+		return db.
+			Where("plugin_id = ? AND list_id = ? AND prefix = ?", pluginID, listID, prefixes[len(prefixes)-1]).
+			Find(&rows).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	now := r.now().Unix()
+	result := make(map[string]float64, len(rows))
+	for _, row := range rows {
+		if boost := r.decay(row.Score, row.UpdatedAt, now); boost >= querySelectionMinBoost {
+			result[row.ItemID] = boost
+		}
+	}
+	return result, nil
+}
+
+func (r *QuerySelectionRepo) DeleteByPlugin(ctx context.Context, pluginID string) (int64, error) {
+	if err := r.validatePluginID(pluginID); err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	err := r.conn.write(ctx, func(db *gorm.DB) error {
+		res := db.
+			Where("plugin_id = ?", pluginID).
+			Delete(&QuerySelectionModel{})
+		affected = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+func (r *QuerySelectionRepo) DeleteByList(ctx context.Context, listID string) (int64, error) {
+	if err := r.validateListID(listID); err != nil {
+		return 0, err
+	}
+
+	var affected int64
+	err := r.conn.write(ctx, func(db *gorm.DB) error {
+		res := db.
+			Where("list_id = ?", listID).
+			Delete(&QuerySelectionModel{})
+		affected = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// DeleteForgotten removes the selections of all lists whose boost decayed below querySelectionMinBoost
+func (r *QuerySelectionRepo) DeleteForgotten(ctx context.Context) (int64, error) {
+	now := r.now().Unix()
+	// scores are at least 1, so younger rows can't be forgotten yet
+	minAge := time.Duration(float64(r.halfLife) * math.Log2(1/querySelectionMinBoost))
+
+	var deleted int64
+	err := r.conn.transaction(ctx, func(tx *gorm.DB) error {
+		deleted = 0
+
+		var rows []QuerySelectionModel
+		if err := tx.
+			Where("updated_at <= ?", now-int64(minAge/time.Second)).
+			Find(&rows).Error; err != nil {
+			return err
+		}
+
+		var forgotten [][]any
+		for _, row := range rows {
+			if r.decay(row.Score, row.UpdatedAt, now) < querySelectionMinBoost {
+				forgotten = append(forgotten, []any{row.PluginID, row.ListID, row.Prefix, row.ItemID})
+			}
+		}
+		for len(forgotten) != 0 {
+			keys := forgotten[:min(len(forgotten), setManyBatchSize)]
+			forgotten = forgotten[len(keys):]
+			res := tx.
+				Where("(plugin_id, list_id, prefix, item_id) IN ?", keys).
+				Delete(&QuerySelectionModel{})
+			if res.Error != nil {
+				return res.Error
+			}
+			deleted += res.RowsAffected
+		}
+
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, nil
+}
+
+func (r *QuerySelectionRepo) decay(score float64, updatedAt int64, now int64) float64 {
+	elapsed := time.Duration(now-updatedAt) * time.Second
+	if elapsed <= 0 {
+		return score
+	}
+
+	return score * math.Exp2(-float64(elapsed)/float64(r.halfLife))
+}
+
+func (r *QuerySelectionRepo) validateIDs(listID string, pluginID string, itemID string) error {
+	if err := r.validateListID(listID); err != nil {
+		return err
+	}
+	if err := r.validatePluginID(pluginID); err != nil {
+		return err
+	}
+	return validateField("itemID", itemID)
+}
+
+func (r *QuerySelectionRepo) validateListID(v string) error {
+	return validateField("listID", v)
+}
+
+func (r *QuerySelectionRepo) validatePluginID(v string) error {
+	return validateField("pluginID", v)
+}
+
+// queryPrefixes returns all prefixes of the normalized query, from shortest to longest
+func queryPrefixes(query string) []string {
+	query = strings.ToLower(strings.Join(strings.Fields(query), " "))
+
+	prefixes := make([]string, 0, min(utf8.RuneCountInString(query), querySelectionMaxPrefix))
+	for i := range query {
+		if i == 0 {
+			continue
+		}
+		prefixes = append(prefixes, query[:i])
+		if len(prefixes) == querySelectionMaxPrefix {
+			return prefixes
+		}
+	}
+	if query != "" {
+		prefixes = append(prefixes, query)
+	}
+
+	return prefixes
+}
@@ -0,0 +1,152 @@
+package db
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type QuerySelectionSuite struct {
+	suite.Suite
+	db  *DB
+	now time.Time
+}
+
+func (s *QuerySelectionSuite) SetupTest() {
+	t := s.T()
+
+	s.db = newTestDB(t, newTestConfig(t))
+
+	s.now = time.Unix(1_700_000_000, 0)
+	s.db.QuerySelection().now = func() time.Time { return s.now }
+}
+
+func (s *QuerySelectionSuite) TearDownTest() {
+	s.db.Close()
+}
+
+func (s *QuerySelectionSuite) TestQueryPrefixes() {
+	t := s.T()
+
+	require.Empty(t, queryPrefixes(""))
+	require.Empty(t, queryPrefixes("   "))
+	require.Equal(t, []string{"t", "te"}, queryPrefixes(" TE "))
+	require.Equal(t, []string{"g", "gi", "gim", "gimp", "gimp ", "gimp 2"}, queryPrefixes("gimp   2"))
+	require.Equal(t, []string{"п", "пр"}, queryPrefixes("Пр"))
+	require.Len(t, queryPrefixes("abcdefghijklmnopqrstuvwxyzabcdefghijklmnopqrstuvwxyz"), querySelectionMaxPrefix)
+}
+
+func (s *QuerySelectionSuite) TestLookupByPrefix() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.QuerySelection()
+
+	require.NoError(t, repo.Record(ctx, "list", "plugin", "ter", "terminal"))
+	require.NoError(t, repo.Record(ctx, "list", "plugin", "te", "terminal"))
+	require.NoError(t, repo.Record(ctx, "list", "plugin", "tel", "telegram"))
+
+	boosts, err := repo.Lookup(ctx, "list", "plugin", "te")
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"terminal": 2, "telegram": 1}, boosts)
+
+	boosts, err = repo.Lookup(ctx, "list", "plugin", "TER")
+	require.NoError(t, err)
+	require.Equal(t, map[string]float64{"terminal": 1}, boosts)
+
+	boosts, err = repo.Lookup(ctx, "list", "other", "te")
+	require.NoError(t, err)
+	require.Empty(t, boosts)
+
+	boosts, err = repo.Lookup(ctx, "list", "plugin", "")
+	require.NoError(t, err)
+	require.Empty(t, boosts)
+}
+
+func (s *QuerySelectionSuite) TestDecay() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.QuerySelection()
+
+	require.NoError(t, repo.Record(ctx, "list", "plugin", "t", "telegram"))
+	require.NoError(t, repo.Record(ctx, "list", "plugin", "t", "telegram"))
+
+	s.now = s.now.Add(querySelectionHalfLife)
+	require.NoError(t, repo.Record(ctx, "list", "plugin", "t", "terminal"))
+
+	boosts, err := repo.Lookup(ctx, "list", "plugin", "t")
+	require.NoError(t, err)
+	require.InDelta(t, 1.0, boosts["telegram"], 1e-9)
+	require.InDelta(t, 1.0, boosts["terminal"], 1e-9)
+
+	// decayed score is the base for the next selection
+	require.NoError(t, repo.Record(ctx, "list", "plugin", "t", "telegram"))
+	boosts, err = repo.Lookup(ctx, "list", "plugin", "t")
+	require.NoError(t, err)
+	require.InDelta(t, 2.0, boosts["telegram"], 1e-9)
+
+	s.now = s.now.Add(20 * querySelectionHalfLife)
+	boosts, err = repo.Lookup(ctx, "list", "plugin", "t")
+	require.NoError(t, err)
+	require.Empty(t, boosts)
+}
+
+func (s *QuerySelectionSuite) TestDeleteForgotten() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.QuerySelection()
+
+	require.NoError(t, repo.Record(ctx, "list", "plugin", "te", "telegram"))
+	for range 4 {
+		require.NoError(t, repo.Record(ctx, "list2", "plugin", "t", "terminal"))
+	}
+
+	n, err := repo.DeleteForgotten(ctx)
+	require.NoError(t, err)
+	require.Zero(t, n)
+
+	// 1 decayed below the min boost, 4 did not yet
+	s.now = s.now.Add(8 * querySelectionHalfLife)
+	n, err = repo.DeleteForgotten(ctx)
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+
+	var rows []QuerySelectionModel
+	require.NoError(t, s.db.writer.Find(&rows).Error)
+	require.Len(t, rows, 1)
+	require.Equal(t, "terminal", rows[0].ItemID)
+}
+
+func (s *QuerySelectionSuite) TestValidation() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.QuerySelection()
+
+	require.Error(t, repo.Record(ctx, "", "plugin", "t", "item"))
+	require.Error(t, repo.Record(ctx, "list", "plugin", "t", ""))
+	_, err := repo.Lookup(ctx, "list", "", "t")
+	require.Error(t, err)
+}
+
+func (s *QuerySelectionSuite) TestDelete() {
+	t := s.T()
+	ctx := context.Background()
+	repo := s.db.QuerySelection()
+
+	require.NoError(t, repo.Record(ctx, "list", "plugin", "te", "terminal"))
+	require.NoError(t, repo.Record(ctx, "list2", "plugin", "te", "terminal"))
+
+	n, err := repo.DeleteByList(ctx, "list")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+
+	n, err = repo.DeleteByPlugin(ctx, "plugin")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, n)
+}
+
+func TestQuerySelectionSuite(t *testing.T) {
+	suite.Run(t, new(QuerySelectionSuite))
+}
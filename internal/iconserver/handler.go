@@ -0,0 +1,293 @@
+package iconserver
+
+import (
+	"bytes"
+	_ "embed"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Runix-Org/runix/platform/xdg/base"
+	"github.com/Runix-Org/runix/platform/xdg/icons"
+	"go.uber.org/zap"
+)
+
+const (
+	// PathPrefix of the icon URLs, see common.EmptyToOptionalIcon
+	PathPrefix = "/icons/"
+
+	DefaultSize = 48
+	MaxSize     = 1024
+	MaxScale    = 4
+	// Limit of the alt names of a request, an application has at most its desktop ID and WM class
+	MaxAltNames = 4
+
+	// The icon behind a URL changes with the theme, the client revalidates with the ETag
+	cacheControl = "no-cache"
+	// SVG may contain scripts, they must not run in the frontend
+	svgCSP = "default-src 'none'; style-src 'unsafe-inline'"
+)
+
+var (
+	ErrInvalidName  = errors.New("invalid icon name")
+	ErrInvalidSize  = errors.New("invalid icon size")
+	ErrInvalidScale = errors.New("invalid icon scale")
+	ErrUnknownType  = errors.New("unknown icon type")
+)
+
+var contentTypes = map[string]string{
+	".png": "image/png",
+	".svg": "image/svg+xml",
+}
+
+// Icons of the theme served when the requested one is not found, in order of preference.
+// They are looked up without generic fallbacks, "image" is not a placeholder.
+var placeholderNames = []string{"image-missing", "application-x-executable"}
+
+// Served when the theme has no placeholder either
+//
+//go:embed placeholder.svg
+var builtinPlaceholder []byte
+
+// Resolver finds the icon file, implemented by icons.IconResolver
+type Resolver interface {
+	ResolveAny(iconSize int, iconScale int, iconNames ...string) (string, bool)
+	ResolveExact(iconName string, iconSize int, iconScale int) (string, bool)
+}
+
+var _ Resolver = (*icons.IconResolver)(nil)
+
+// Handler serves the icons of /icons/<name>?size=N&scale=M&fg=RRGGBB&alt=<name>.
+// The name is an icon name of the theme or an escaped absolute path, served from the icon search dirs only,
+// fg is the color of symbolic icons, alt are the icon names tried when name is not found.
+type Handler struct {
+	resolver Resolver
+	renderer *Renderer
+	// Last-Modified of the builtin placeholder
+	started time.Time
+	logger  *zap.Logger
+}
+
+// NewHandlerDefault creates the handler with the renderer of NewRendererDefault
+func NewHandlerDefault(resolver Resolver, logger *zap.Logger) (*Handler, error) {
+	renderer, err := NewRendererDefault(logger)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewHandler(resolver, renderer, logger), nil
+}
+
+func NewHandler(resolver Resolver, renderer *Renderer, logger *zap.Logger) *Handler {
+	return &Handler{
+		resolver: resolver,
+		renderer: renderer,
+		started:  time.Now(),
+		logger:   logger.With(zap.String("task", "IconServer")),
+	}
+}
+
+type iconRequest struct {
+	name string
+	// names of the theme tried after name, before the generic fallbacks of name
+	alts  []string
+	size  int
+	scale int
+	// "#rrggbb" or empty
+	fg string
+}
+
+// parseRequest reads the escaped path, the unescaped one of an absolute icon contains "//",
+// which http.ServeMux would redirect to a cleaned path
+func parseRequest(u *url.URL) (iconRequest, error) {
+	req := iconRequest{size: DefaultSize, scale: 1}
+
+	escaped, ok := strings.CutPrefix(u.EscapedPath(), PathPrefix)
+	if !ok {
+		return req, fmt.Errorf("%w: path is outside %s", ErrInvalidName, PathPrefix)
+	}
+	name, err := url.PathUnescape(escaped)
+	if err != nil {
+		return req, fmt.Errorf("%w: %w", ErrInvalidName, err)
+	}
+	if err := validateName(name); err != nil {
+		return req, err
+	}
+	req.name = name
+
+	query := u.Query()
+	if v := query.Get("size"); v != "" {
+		if req.size, err = strconv.Atoi(v); err != nil || req.size < 1 || req.size > MaxSize {
+			return req, fmt.Errorf("%w: %q", ErrInvalidSize, v)
+		}
+	}
+	if v := query.Get("scale"); v != "" {
+		if req.scale, err = strconv.Atoi(v); err != nil || req.scale < 1 || req.scale > MaxScale {
+			return req, fmt.Errorf("%w: %q", ErrInvalidScale, v)
+		}
+	}
+	if v := query.Get("fg"); v != "" {
+		if req.fg, err = parseColor(v); err != nil {
+			return req, err
+		}
+	}
+	if alts := query["alt"]; len(alts) > MaxAltNames {
+		return req, fmt.Errorf("%w: more than %d alt names", ErrInvalidName, MaxAltNames)
+	}
+	for _, alt := range query["alt"] {
+		if err := validateName(alt); err != nil {
+			return req, err
+		}
+		if filepath.IsAbs(alt) {
+			return req, fmt.Errorf("%w: alt %q is not a name", ErrInvalidName, alt)
+		}
+		req.alts = append(req.alts, alt)
+	}
+
+	return req, nil
+}
+
+// validateName accepts theme icon names and absolute paths of icon files without traversal,
+// see inIconDirs for the paths that are served
+func validateName(name string) error {
+	if name == "" || strings.ContainsRune(name, 0) {
+		return fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+
+	if !filepath.IsAbs(name) {
+		if strings.ContainsRune(name, '/') {
+			return fmt.Errorf("%w: %q is neither a name nor an absolute path", ErrInvalidName, name)
+		}
+		return nil
+	}
+
+	if filepath.Clean(name) != name || strings.Contains(name, "/../") {
+		return fmt.Errorf("%w: %q is not a clean path", ErrInvalidName, name)
+	}
+	if _, ok := sourceExts[strings.ToLower(filepath.Ext(name))]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownType, name)
+	}
+
+	return nil
+}
+
+// inIconDirs reports whether iconPath is in one of the icon search dirs,
+// other files of the user must not be readable through the server, so the alts or the placeholder are served instead
+func inIconDirs(iconPath string) bool {
+	for _, dir := range base.GetIconSearchDirs() {
+		if strings.HasPrefix(iconPath, filepath.Clean(dir)+string(filepath.Separator)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	req, err := parseRequest(r.URL)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	names := req.alts
+	if !filepath.IsAbs(req.name) || inIconDirs(req.name) {
+		names = append([]string{req.name}, req.alts...)
+	} else {
+		h.logger.Debug("Icon path is outside the icon dirs", zap.String("path", req.name))
+	}
+	if iconPath, ok := h.resolver.ResolveAny(req.size, req.scale, names...); ok {
+		err := h.serveIcon(w, r, iconPath, req)
+		if err == nil {
+			return
+		}
+		h.logger.Info("Failed serving icon", zap.String("path", iconPath), zap.Error(err))
+	}
+
+	w.Header().Set("X-Icon-Placeholder", "1")
+	h.servePlaceholder(w, r, req)
+}
+
+func (h *Handler) servePlaceholder(w http.ResponseWriter, r *http.Request, req iconRequest) {
+	for _, name := range placeholderNames {
+		if iconPath, ok := h.resolver.ResolveExact(name, req.size, req.scale); ok {
+			if err := h.serveIcon(w, r, iconPath, req); err == nil {
+				return
+			}
+		}
+	}
+
+	h.setHeaders(w, contentTypes[".svg"], etag("builtin", int64(len(builtinPlaceholder)), h.started))
+	http.ServeContent(w, r, "", h.started, bytes.NewReader(builtinPlaceholder))
+}
+
+// serveIcon serves the rendered PNG, or the source file if it can be served as-is
+func (h *Handler) serveIcon(w http.ResponseWriter, r *http.Request, iconPath string, req iconRequest) error {
+	rendered, err := h.renderer.Render(iconPath, req.size, req.scale, req.fg)
+	if err != nil {
+		h.logger.Info("Failed render icon", zap.String("path", iconPath), zap.Error(err))
+		rendered = iconPath
+	}
+
+	return h.serveFile(w, r, rendered)
+}
+
+// serveFile handles conditional and range requests, nothing is written on error
+func (h *Handler) serveFile(w http.ResponseWriter, r *http.Request, iconPath string) error {
+	contentType, ok := contentTypes[strings.ToLower(filepath.Ext(iconPath))]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownType, iconPath)
+	}
+
+	f, err := os.Open(iconPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", iconPath)
+	}
+
+	h.setHeaders(w, contentType, etag(iconPath, info.Size(), info.ModTime()))
+	http.ServeContent(w, r, "", info.ModTime(), f)
+	return nil
+}
+
+func (h *Handler) setHeaders(w http.ResponseWriter, contentType string, etag string) {
+	header := w.Header()
+	header.Set("Content-Type", contentType)
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", cacheControl)
+	header.Set("X-Content-Type-Options", "nosniff")
+	if contentType == contentTypes[".svg"] {
+		header.Set("Content-Security-Policy", svgCSP)
+	}
+}
+
+// etag changes with the file behind the URL and with its content
+func etag(iconPath string, size int64, modTime time.Time) string {
+	hash := fnv.New64a()
+	_, _ = io.WriteString(hash, iconPath)
+	_, _ = fmt.Fprintf(hash, "|%d|%d", size, modTime.UnixNano())
+
+	return fmt.Sprintf(`"%016x"`, hash.Sum64())
+}
@@ -0,0 +1,365 @@
+package iconserver
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Runix-Org/runix/internal/provider/common"
+	"github.com/Runix-Org/runix/platform/fs"
+	"github.com/Runix-Org/runix/platform/xdg/base"
+	"github.com/Runix-Org/runix/platform/xdg/icons"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+var (
+	themeDir string
+	// icon search dir of the user, the tests add their icons here
+	userIconDir string
+)
+
+// TestMain points the XDG dirs to testdata, the platform modules can be initialized only once
+func TestMain(m *testing.M) {
+	os.Exit(runWithFixture(m))
+}
+
+func runWithFixture(m *testing.M) int {
+	home, err := os.MkdirTemp("", "iconserver")
+	if err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(home)
+
+	share, err := filepath.Abs(filepath.Join("testdata", "share"))
+	if err != nil {
+		panic(err)
+	}
+	themeDir = filepath.Join(share, "icons", "Fixture")
+
+	gtkDir := filepath.Join(home, ".config", "gtk-3.0")
+	userIconDir = filepath.Join(home, ".local", "share", "icons")
+	for _, dir := range []string{gtkDir, userIconDir} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			panic(err)
+		}
+	}
+	settings := "[Settings]\ngtk-icon-theme-name=Fixture\n"
+	if err := os.WriteFile(filepath.Join(gtkDir, "settings.ini"), []byte(settings), 0o644); err != nil {
+		panic(err)
+	}
+
+	for key, value := range map[string]string{
+		"HOME":            home,
+		"XDG_DATA_HOME":   filepath.Join(home, ".local", "share"),
+		"XDG_CONFIG_HOME": filepath.Join(home, ".config"),
+		"XDG_CACHE_HOME":  filepath.Join(home, ".cache"),
+		"XDG_DATA_DIRS":   share,
+		// neither KDE nor GNOME, the theme is read from the GTK settings
+		"XDG_CURRENT_DESKTOP": "Fixture",
+	} {
+		os.Setenv(key, value)
+	}
+	if err := fs.InitFS(); err != nil {
+		panic(err)
+	}
+	if err := base.InitBase("runix"); err != nil {
+		panic(err)
+	}
+
+	return m.Run()
+}
+
+type noResolver struct{}
+
+func (noResolver) ResolveAny(iconSize int, iconScale int, iconNames ...string) (string, bool) {
+	return "", false
+}
+
+func (noResolver) ResolveExact(iconName string, iconSize int, iconScale int) (string, bool) {
+	return "", false
+}
+
+// genericResolver finds name => path, ResolveAny falls back to the part before the first dash
+type genericResolver map[string]string
+
+func (r genericResolver) ResolveAny(iconSize int, iconScale int, iconNames ...string) (string, bool) {
+	for _, name := range iconNames {
+		generic, _, _ := strings.Cut(name, "-")
+		for _, candidate := range []string{name, generic} {
+			if iconPath, ok := r[candidate]; ok {
+				return iconPath, true
+			}
+		}
+	}
+	return "", false
+}
+
+func (r genericResolver) ResolveExact(iconName string, iconSize int, iconScale int) (string, bool) {
+	iconPath, ok := r[iconName]
+	return iconPath, ok
+}
+
+type HandlerSuite struct {
+	suite.Suite
+	renderer *Renderer
+	mux      *http.ServeMux
+}
+
+func (s *HandlerSuite) SetupTest() {
+	var err error
+	s.renderer, err = NewRendererDefault(zap.NewNop())
+	require.NoError(s.T(), err)
+
+	s.mux = http.NewServeMux()
+	s.mux.Handle(PathPrefix, NewHandler(icons.NewIconFinder(zap.NewNop()), s.renderer, zap.NewNop()))
+}
+
+func (s *HandlerSuite) get(target string, header ...string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	return rec
+}
+
+func (s *HandlerSuite) fixture(name string) string {
+	data, err := os.ReadFile(filepath.Join(themeDir, name))
+	require.NoError(s.T(), err)
+	return string(data)
+}
+
+// decodePNG checks the rendered response
+func (s *HandlerSuite) decodePNG(rec *httptest.ResponseRecorder) image.Image {
+	require.Equal(s.T(), "image/png", rec.Header().Get("Content-Type"))
+	img, err := png.Decode(rec.Body)
+	require.NoError(s.T(), err)
+	return img
+}
+
+func (s *HandlerSuite) TestThemeIcon() {
+	t := s.T()
+
+	rec := s.get(*common.EmptyToOptionalIcon("firefox", 48))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "image/png", rec.Header().Get("Content-Type"))
+	require.Equal(t, "no-cache", rec.Header().Get("Cache-Control"))
+	lastModified := rec.Header().Get("Last-Modified")
+	require.NotEmpty(t, lastModified)
+	require.Empty(t, rec.Header().Get("X-Icon-Placeholder"))
+	require.Equal(t, s.fixture("48x48/apps/firefox.png"), rec.Body.String())
+
+	etag := rec.Header().Get("ETag")
+	require.NotEmpty(t, etag)
+	rec = s.get("/icons/firefox?size=48", "If-None-Match", etag)
+	require.Equal(t, http.StatusNotModified, rec.Code)
+	require.Empty(t, rec.Body.String())
+
+	rec = s.get("/icons/firefox?size=48", "If-Modified-Since", lastModified)
+	require.Equal(t, http.StatusNotModified, rec.Code)
+
+	req := httptest.NewRequest(http.MethodHead, "/icons/firefox", nil)
+	rec = httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Body.String())
+}
+
+func (s *HandlerSuite) TestSVG() {
+	t := s.T()
+
+	rec := s.get("/icons/gimp?size=64&scale=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("Content-Security-Policy"))
+	img := s.decodePNG(rec)
+	require.Equal(t, image.Rect(0, 0, 128, 128), img.Bounds())
+	require.Equal(t, color.NRGBA{0x5c, 0x55, 0x43, 0xff}, color.NRGBAModel.Convert(img.At(64, 64)))
+	require.Equal(t, color.NRGBA{}, color.NRGBAModel.Convert(img.At(0, 0)))
+
+	entries, err := os.ReadDir(filepath.Join(base.GetAppCacheDir(), "icons"))
+	require.NoError(t, err)
+	require.NotEmpty(t, entries)
+}
+
+func (s *HandlerSuite) TestXPM() {
+	t := s.T()
+
+	// loose file in the icons dir, outside of any theme
+	rec := s.get("/icons/xterm?size=16")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("X-Icon-Placeholder"))
+	img := s.decodePNG(rec)
+	require.Equal(t, image.Rect(0, 0, 4, 3), img.Bounds())
+	require.Equal(t, color.NRGBA{0xff, 0xff, 0xff, 0xff}, color.NRGBAModel.Convert(img.At(0, 0)))
+	require.Equal(t, color.NRGBA{}, color.NRGBAModel.Convert(img.At(1, 1)))
+}
+
+func (s *HandlerSuite) TestSymbolic() {
+	t := s.T()
+
+	red := color.NRGBA{0xff, 0x00, 0x00, 0xff}
+	orange := color.NRGBA{0xf5, 0x79, 0x00, 0xff}
+
+	// the generic fallback finds the symbolic icon
+	rec := s.get("/icons/network-wireless-signal-good-symbolic?size=16&fg=%23ff0000")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("X-Icon-Placeholder"))
+	img := s.decodePNG(rec)
+	require.Equal(t, red, color.NRGBAModel.Convert(img.At(4, 8)))
+	require.Equal(t, orange, color.NRGBAModel.Convert(img.At(12, 8)), "state colors are kept")
+
+	rec = s.get("/icons/network-wireless-symbolic?size=16")
+	require.Equal(t, http.StatusOK, rec.Code)
+	img = s.decodePNG(rec)
+	require.Equal(t, color.NRGBA{0x2e, 0x34, 0x36, 0xff}, color.NRGBAModel.Convert(img.At(4, 8)))
+
+	// the color is ignored for other icons
+	rec = s.get("/icons/gimp?size=16&fg=f00")
+	require.Equal(t, http.StatusOK, rec.Code)
+	img = s.decodePNG(rec)
+	require.Equal(t, color.NRGBA{0x5c, 0x55, 0x43, 0xff}, color.NRGBAModel.Convert(img.At(8, 8)))
+}
+
+func (s *HandlerSuite) TestDownscale() {
+	t := s.T()
+
+	large := image.NewNRGBA(image.Rect(0, 0, 256, 128))
+	for y := range 128 {
+		for x := range 256 {
+			large.SetNRGBA(x, y, color.NRGBA{0x20, 0x40, 0x80, 0xff})
+		}
+	}
+	iconPath := filepath.Join(userIconDir, "large.png")
+	defer os.Remove(iconPath)
+	f, err := os.Create(iconPath)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, large))
+	require.NoError(t, f.Close())
+
+	rec := s.get(*common.EmptyToOptionalIcon(iconPath, 32) + "&scale=2")
+	require.Equal(t, http.StatusOK, rec.Code)
+	img := s.decodePNG(rec)
+	require.Equal(t, image.Rect(0, 0, 64, 32), img.Bounds())
+	require.Equal(t, color.NRGBA{0x20, 0x40, 0x80, 0xff}, color.NRGBAModel.Convert(img.At(32, 16)))
+}
+
+func (s *HandlerSuite) TestAbsolutePath() {
+	t := s.T()
+
+	iconPath := filepath.Join(themeDir, "scalable", "apps", "gimp.svg")
+	rec := s.get(*common.EmptyToOptionalIcon(iconPath, 48))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, image.Rect(0, 0, 48, 48), s.decodePNG(rec).Bounds())
+
+	// an existing image outside the icon search dirs is never read, the alts and placeholder are served instead
+	private := filepath.Join(t.TempDir(), "private.png")
+	f, err := os.Create(private)
+	require.NoError(t, err)
+	require.NoError(t, png.Encode(f, image.NewNRGBA(image.Rect(0, 0, 10, 10))))
+	require.NoError(t, f.Close())
+
+	rec = s.get(*common.EmptyToOptionalIcon(private, 48, "firefox"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("X-Icon-Placeholder"))
+	require.Equal(t, s.fixture("48x48/apps/firefox.png"), rec.Body.String())
+
+	for _, name := range []string{private, "/home/user/private.png", filepath.Dir(themeDir) + "-other/gimp.svg"} {
+		rec := s.get(*common.EmptyToOptionalIcon(name, 32))
+		require.Equal(t, http.StatusOK, rec.Code, name)
+		require.Equal(t, "1", rec.Header().Get("X-Icon-Placeholder"), name)
+		require.Equal(t, image.Rect(0, 0, 32, 32), s.decodePNG(rec).Bounds(), name)
+	}
+
+	for _, name := range []string{
+		themeDir + "/scalable/apps/../../index.theme",
+		themeDir + "/scalable/apps/../apps/gimp.svg",
+		themeDir + "/index.theme",
+		"apps/gimp",
+		"",
+	} {
+		rec := s.get(PathPrefix + url.PathEscape(name))
+		require.Equal(t, http.StatusBadRequest, rec.Code, name)
+	}
+	// the unescaped form is redirected to the cleaned path by http.ServeMux
+	rec = s.get(PathPrefix + themeDir + "/scalable/apps/../../index.theme")
+	require.NotEqual(t, http.StatusOK, rec.Code)
+}
+
+func (s *HandlerSuite) TestAltNames() {
+	t := s.T()
+
+	// e.g. the Icon of a flatpak application is missing, its desktop ID or WM class is found
+	rec := s.get(*common.EmptyToOptionalIcon("not-installed", 48, "org.example.Missing", "firefox"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Empty(t, rec.Header().Get("X-Icon-Placeholder"))
+	require.Equal(t, s.fixture("48x48/apps/firefox.png"), rec.Body.String())
+
+	rec = s.get(*common.EmptyToOptionalIcon("not-installed", 48, "org.example.Missing"))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("X-Icon-Placeholder"))
+}
+
+func (s *HandlerSuite) TestInvalidRequest() {
+	t := s.T()
+
+	for _, query := range []string{
+		"size=0", "size=abc", fmt.Sprintf("size=%d", MaxSize+1), "scale=0", "scale=5", "fg=red",
+		"alt=apps%2Fgimp", "alt=" + url.QueryEscape(filepath.Join(themeDir, "48x48", "apps", "firefox.png")), "alt=",
+		"alt=a&alt=b&alt=c&alt=d&alt=e",
+	} {
+		rec := s.get("/icons/firefox?" + query)
+		require.Equal(t, http.StatusBadRequest, rec.Code, query)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/icons/firefox", nil)
+	rec := httptest.NewRecorder()
+	s.mux.ServeHTTP(rec, req)
+	require.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	require.Equal(t, "GET, HEAD", rec.Header().Get("Allow"))
+}
+
+func (s *HandlerSuite) TestPlaceholder() {
+	t := s.T()
+
+	rec := s.get("/icons/not-installed?size=32")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("X-Icon-Placeholder"))
+	require.Equal(t, image.Rect(0, 0, 32, 32), s.decodePNG(rec).Bounds())
+
+	handler := NewHandler(noResolver{}, s.renderer, zap.NewNop())
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/icons/firefox", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("X-Icon-Placeholder"))
+	require.Equal(t, "image/svg+xml", rec.Header().Get("Content-Type"))
+	require.Equal(t, string(builtinPlaceholder), rec.Body.String())
+
+	// "image" is a generic name of "image-missing", not a placeholder
+	handler = NewHandler(genericResolver{"image": filepath.Join(themeDir, "scalable", "apps", "gimp.svg")}, s.renderer, zap.NewNop())
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/icons/firefox", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.Equal(t, "1", rec.Header().Get("X-Icon-Placeholder"))
+	require.Equal(t, string(builtinPlaceholder), rec.Body.String())
+}
+
+func TestHandlerDefault(t *testing.T) {
+	handler, err := NewHandlerDefault(noResolver{}, zap.NewNop())
+	require.NoError(t, err)
+	require.Equal(t, filepath.Join(base.GetAppCacheDir(), "icons"), handler.renderer.dir)
+}
+
+func TestHandler(t *testing.T) {
+	suite.Run(t, new(HandlerSuite))
+}
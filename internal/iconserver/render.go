@@ -0,0 +1,265 @@
+package iconserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"image"
+	"image/png"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Runix-Org/runix/platform/fs"
+	"github.com/Runix-Org/runix/platform/xdg/base"
+	"github.com/srwiley/oksvg"
+	"github.com/srwiley/rasterx"
+	"go.uber.org/zap"
+	"golang.org/x/image/draw"
+)
+
+var ErrRender = errors.New("failed render icon")
+
+const (
+	// Limits of the render cache applied at startup, a pruned entry is rendered again on request
+	cacheMaxAge  = 30 * 24 * time.Hour
+	cacheMaxSize = 64 << 20
+)
+
+// Icon files accepted as a source, everything is served as PNG after rendering
+var sourceExts = map[string]struct{}{".png": {}, ".svg": {}, ".xpm": {}}
+
+// Renderer converts the icon files to PNG of the requested size.
+// The results are cached in dir, a changed source file gets a new cache entry.
+type Renderer struct {
+	dir string
+	// entries older than maxAge are removed, then the oldest ones above maxSize bytes in total
+	maxAge  time.Duration
+	maxSize int64
+	logger  *zap.Logger
+}
+
+// NewRendererDefault caches the rendered icons in the icons dir of the app cache dir
+func NewRendererDefault(logger *zap.Logger) (*Renderer, error) {
+	return NewRenderer(filepath.Join(base.GetAppCacheDir(), "icons"), logger)
+}
+
+// NewRenderer creates dir and prunes the stale entries of the previous runs
+func NewRenderer(dir string, logger *zap.Logger) (*Renderer, error) {
+	if _, err := fs.CreateDir(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed create icon cache dir(%s): %w", dir, err)
+	}
+
+	r := &Renderer{
+		dir:     dir,
+		maxAge:  cacheMaxAge,
+		maxSize: cacheMaxSize,
+		logger:  logger.With(zap.String("task", "IconRenderer")),
+	}
+	r.prune(time.Now())
+
+	return r, nil
+}
+
+// Render returns the path of the PNG at most size*scale pixels on the longest side.
+// Symbolic SVGs are painted with fg, a "#rrggbb" color, if it is not empty.
+// PNG files that are small enough are returned unchanged.
+func (r *Renderer) Render(iconPath string, size int, scale int, fg string) (string, error) {
+	ext := strings.ToLower(filepath.Ext(iconPath))
+	if _, ok := sourceExts[ext]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownType, iconPath)
+	}
+
+	info, err := os.Stat(iconPath)
+	if err != nil {
+		return "", err
+	}
+	px := size * scale
+	if ext != ".svg" || !isSymbolicSVG(iconPath) {
+		fg = ""
+	}
+
+	if ext == ".png" {
+		fits, err := pngFits(iconPath, px)
+		if err != nil {
+			return "", err
+		}
+		if fits {
+			return iconPath, nil
+		}
+	}
+
+	cachePath := filepath.Join(r.dir, cacheKey(iconPath, info, px, fg)+".png")
+	if fs.ExistsFile(cachePath) {
+		return cachePath, nil
+	}
+
+	img, err := decodeIcon(iconPath, ext, px, fg)
+	if err != nil {
+		return "", fmt.Errorf("%w %s: %w", ErrRender, iconPath, err)
+	}
+	if err := writePNG(cachePath, fit(img, px)); err != nil {
+		return "", err
+	}
+	r.logger.Debug("Rendered icon", zap.String("path", iconPath), zap.Int("px", px))
+
+	return cachePath, nil
+}
+
+// prune removes the entries rendered before now-maxAge, then the oldest entries while
+// the cache is larger than maxSize. Every entry is a new file, a changed source or color
+// leaves the previous one behind.
+func (r *Renderer) prune(now time.Time) {
+	entries, err := os.ReadDir(r.dir)
+	if err != nil {
+		r.logger.Info("Failed read icon cache dir", zap.String("path", r.dir), zap.Error(err))
+		return
+	}
+
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if info, err := entry.Info(); err == nil {
+			infos = append(infos, info)
+		}
+	}
+	// newest first
+	slices.SortFunc(infos, func(a, b os.FileInfo) int {
+		return b.ModTime().Compare(a.ModTime())
+	})
+
+	var total int64
+	removed := 0
+	for _, info := range infos {
+		total += info.Size()
+		if now.Sub(info.ModTime()) <= r.maxAge && total <= r.maxSize {
+			continue
+		}
+		if err := os.Remove(filepath.Join(r.dir, info.Name())); err != nil && !errors.Is(err, os.ErrNotExist) {
+			r.logger.Info("Failed remove icon cache entry", zap.String("name", info.Name()), zap.Error(err))
+			continue
+		}
+		total -= info.Size()
+		removed++
+	}
+	if removed != 0 {
+		r.logger.Debug("Pruned icon cache", zap.Int("removed", removed), zap.Int64("size", total))
+	}
+}
+
+// cacheKey changes with the source file, the target size and the color
+func cacheKey(iconPath string, info os.FileInfo, px int, fg string) string {
+	hash := fnv.New64a()
+	_, _ = fmt.Fprintf(hash, "%s|%d|%d|%d|%s", iconPath, info.ModTime().UnixNano(), info.Size(), px, fg)
+
+	return fmt.Sprintf("%016x-%d", hash.Sum64(), px)
+}
+
+func pngFits(iconPath string, px int) (bool, error) {
+	f, err := os.Open(iconPath)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+
+	cfg, err := png.DecodeConfig(f)
+	if err != nil {
+		return false, fmt.Errorf("%w %s: %w", ErrRender, iconPath, err)
+	}
+
+	return cfg.Width <= px && cfg.Height <= px, nil
+}
+
+func decodeIcon(iconPath string, ext string, px int, fg string) (image.Image, error) {
+	if fg != "" {
+		data, err := os.ReadFile(iconPath)
+		if err != nil {
+			return nil, err
+		}
+		return rasterizeSVG(bytes.NewReader(recolorSymbolic(data, fg)), px)
+	}
+
+	f, err := os.Open(iconPath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	switch ext {
+	case ".svg":
+		return rasterizeSVG(f, px)
+	case ".xpm":
+		return decodeXPM(f)
+	default:
+		return png.Decode(f)
+	}
+}
+
+// rasterizeSVG draws the view box into px*px keeping the aspect ratio
+func rasterizeSVG(r io.Reader, px int) (image.Image, error) {
+	icon, err := oksvg.ReadIconStream(r, oksvg.IgnoreErrorMode)
+	if err != nil {
+		return nil, err
+	}
+
+	w, h := float64(px), float64(px)
+	if vw, vh := icon.ViewBox.W, icon.ViewBox.H; vw > 0 && vh > 0 {
+		if vw > vh {
+			h = w * vh / vw
+		} else {
+			w = h * vw / vh
+		}
+	}
+	width, height := max(1, int(w+0.5)), max(1, int(h+0.5))
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	icon.SetTarget(0, 0, float64(width), float64(height))
+	scanner := rasterx.NewScannerGV(width, height, img, img.Bounds())
+	icon.Draw(rasterx.NewDasher(width, height, scanner), 1)
+
+	return img, nil
+}
+
+// fit downscales img to at most px on the longest side, smaller images are not upscaled
+func fit(img image.Image, px int) image.Image {
+	b := img.Bounds()
+	if b.Dx() <= px && b.Dy() <= px {
+		return img
+	}
+
+	w, h := px, px
+	if b.Dx() > b.Dy() {
+		h = max(1, b.Dy()*px/b.Dx())
+	} else {
+		w = max(1, b.Dx()*px/b.Dy())
+	}
+	dst := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Src, nil)
+
+	return dst
+}
+
+// writePNG renames a temporary file, concurrent renders of the same icon never see a partial file
+func writePNG(path string, img image.Image) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".render-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if err := png.Encode(tmp, img); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
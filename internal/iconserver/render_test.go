@@ -0,0 +1,87 @@
+package iconserver
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestRenderCache(t *testing.T) {
+	renderer, err := NewRenderer(filepath.Join(t.TempDir(), "icons"), zap.NewNop())
+	require.NoError(t, err)
+
+	iconPath := filepath.Join(t.TempDir(), "icon.svg")
+	svg := `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 10 10"><rect width="10" height="10"/></svg>`
+	require.NoError(t, os.WriteFile(iconPath, []byte(svg), 0o644))
+
+	first, err := renderer.Render(iconPath, 24, 1, "")
+	require.NoError(t, err)
+	require.Equal(t, renderer.dir, filepath.Dir(first))
+	info, err := os.Stat(first)
+	require.NoError(t, err)
+
+	again, err := renderer.Render(iconPath, 24, 1, "")
+	require.NoError(t, err)
+	require.Equal(t, first, again)
+	againInfo, err := os.Stat(again)
+	require.NoError(t, err)
+	require.Equal(t, info.ModTime(), againInfo.ModTime(), "cache hit must not render again")
+
+	scaled, err := renderer.Render(iconPath, 24, 2, "")
+	require.NoError(t, err)
+	require.NotEqual(t, first, scaled)
+
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(iconPath, later, later))
+	changed, err := renderer.Render(iconPath, 24, 1, "")
+	require.NoError(t, err)
+	require.NotEqual(t, first, changed)
+
+	_, err = renderer.Render(filepath.Join(filepath.Dir(iconPath), "icon.bmp"), 24, 1, "")
+	require.ErrorIs(t, err, ErrUnknownType)
+
+	broken := filepath.Join(filepath.Dir(iconPath), "broken.xpm")
+	require.NoError(t, os.WriteFile(broken, []byte("not an image"), 0o644))
+	_, err = renderer.Render(broken, 24, 1, "")
+	require.ErrorIs(t, err, ErrRender)
+}
+
+func TestRenderCachePrune(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "icons")
+	renderer, err := NewRenderer(dir, zap.NewNop())
+	require.NoError(t, err)
+
+	now := time.Now()
+	write := func(name string, size int, age time.Duration) {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, make([]byte, size), 0o644))
+		require.NoError(t, os.Chtimes(path, now.Add(-age), now.Add(-age)))
+	}
+	write("new.png", 100, time.Minute)
+	write("recent.png", 100, time.Hour)
+	write("older.png", 100, 2*time.Hour)
+	write("stale.png", 1, cacheMaxAge+time.Hour)
+
+	renderer.maxSize = 250
+	renderer.prune(now)
+
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	// stale.png is too old, older.png is the oldest above the size limit
+	require.ElementsMatch(t, []string{"new.png", "recent.png"}, names)
+
+	// NewRenderer prunes the entries of the previous runs
+	write("stale.png", 1, cacheMaxAge+time.Hour)
+	_, err = NewRenderer(dir, zap.NewNop())
+	require.NoError(t, err)
+	require.NoFileExists(t, filepath.Join(dir, "stale.png"))
+	require.FileExists(t, filepath.Join(dir, "new.png"))
+}
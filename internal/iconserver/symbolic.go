@@ -0,0 +1,108 @@
+package iconserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var ErrInvalidColor = errors.New("invalid color")
+
+// Symbolic icons of the Icon Naming spec are single-color SVGs recolored by the toolkit
+const symbolicSVGSuffix = "-symbolic.svg"
+
+var (
+	hexColorRe = regexp.MustCompile(`^#?([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+	svgTagRe   = regexp.MustCompile(`<[a-zA-Z][^>]*>`)
+	// fill="..." and stroke="...", not fill-opacity
+	paintAttrRe = regexp.MustCompile(`\b(fill|stroke)="([^"]*)"`)
+	// fill:... and stroke:... inside a style attribute
+	paintStyleRe = regexp.MustCompile(`\b(fill|stroke)\s*:\s*([^;"]+)`)
+	classAttrRe  = regexp.MustCompile(`\bclass="([^"]*)"`)
+	svgRootRe    = regexp.MustCompile(`<svg\b`)
+	rootFillRe   = regexp.MustCompile(`\bfill\s*[=:]`)
+)
+
+// GTK keeps the colors of the elements with these classes
+var symbolicStateClasses = []string{"success", "warning", "error"}
+
+// isSymbolicSVG reports whether iconPath is recolored with the foreground color
+func isSymbolicSVG(iconPath string) bool {
+	return strings.HasSuffix(strings.ToLower(filepath.Base(iconPath)), symbolicSVGSuffix)
+}
+
+// parseColor reads the "rgb" or "rrggbb" hex color of a request, with or without '#'
+func parseColor(v string) (string, error) {
+	m := hexColorRe.FindStringSubmatch(v)
+	if m == nil {
+		return "", fmt.Errorf("%w: %q", ErrInvalidColor, v)
+	}
+
+	hex := strings.ToLower(m[1])
+	if len(hex) == 3 {
+		hex = string([]byte{hex[0], hex[0], hex[1], hex[1], hex[2], hex[2]})
+	}
+
+	return "#" + hex, nil
+}
+
+// recolorSymbolic paints a symbolic SVG with fg, a "#rrggbb" color.
+// The colors of fill and stroke are replaced in the attributes and the style attributes,
+// elements without them inherit the fill of the root. CSS of <style> elements is not changed.
+func recolorSymbolic(data []byte, fg string) []byte {
+	data = svgTagRe.ReplaceAllFunc(data, func(tag []byte) []byte {
+		if m := classAttrRe.FindSubmatch(tag); m != nil {
+			for _, class := range strings.Fields(string(m[1])) {
+				for _, state := range symbolicStateClasses {
+					if class == state {
+						return tag
+					}
+				}
+			}
+		}
+
+		tag = paintAttrRe.ReplaceAllFunc(tag, func(attr []byte) []byte {
+			m := paintAttrRe.FindSubmatch(attr)
+			if !isPaintColor(string(m[2])) {
+				return attr
+			}
+			return fmt.Appendf(nil, `%s="%s"`, m[1], fg)
+		})
+		return paintStyleRe.ReplaceAllFunc(tag, func(decl []byte) []byte {
+			m := paintStyleRe.FindSubmatch(decl)
+			if !isPaintColor(string(m[2])) {
+				return decl
+			}
+			return fmt.Appendf(nil, "%s:%s", m[1], fg)
+		})
+	})
+
+	// the root fill is the default of the elements without one
+	if loc := svgRootRe.FindIndex(data); loc != nil {
+		root := data[loc[0]:]
+		if end := bytes.IndexByte(root, '>'); end >= 0 && !rootFillRe.Match(root[:end]) {
+			res := make([]byte, 0, len(data)+len(fg)+8)
+			res = append(res, data[:loc[1]]...)
+			res = fmt.Appendf(res, ` fill="%s"`, fg)
+			data = append(res, data[loc[1]:]...)
+		}
+	}
+
+	return data
+}
+
+// isPaintColor reports whether the paint value is a color, not none or a gradient
+func isPaintColor(v string) bool {
+	v = strings.ToLower(strings.TrimSpace(v))
+	switch {
+	case v == "", v == "none", v == "transparent", v == "inherit":
+		return false
+	case strings.HasPrefix(v, "url("):
+		return false
+	}
+
+	return true
+}
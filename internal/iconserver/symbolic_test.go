@@ -0,0 +1,42 @@
+package iconserver
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseColor(t *testing.T) {
+	for v, expected := range map[string]string{"#2E3436": "#2e3436", "2e3436": "#2e3436", "fff": "#ffffff", "#abc": "#aabbcc"} {
+		color, err := parseColor(v)
+		require.NoError(t, err, v)
+		require.Equal(t, expected, color, v)
+	}
+	for _, v := range []string{"", "#", "red", "#12345", "#1234567", "ggg"} {
+		_, err := parseColor(v)
+		require.ErrorIs(t, err, ErrInvalidColor, v)
+	}
+}
+
+func TestRecolorSymbolic(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected string
+	}{
+		{
+			`<svg xmlns="http://www.w3.org/2000/svg"><path fill="#2e3436" fill-opacity="0.5" d="M0 0"/></svg>`,
+			`<svg fill="#ff0000" xmlns="http://www.w3.org/2000/svg"><path fill="#ff0000" fill-opacity="0.5" d="M0 0"/></svg>`,
+		},
+		{
+			`<svg fill="#000"><rect style="fill:#bebebe;stroke: red;fill-rule:evenodd"/></svg>`,
+			`<svg fill="#ff0000"><rect style="fill:#ff0000;stroke:#ff0000;fill-rule:evenodd"/></svg>`,
+		},
+		{
+			`<svg style="fill:#000"><rect fill="none" stroke="url(#g)"/><rect class="icon error" fill="#cc0000"/></svg>`,
+			`<svg style="fill:#ff0000"><rect fill="none" stroke="url(#g)"/><rect class="icon error" fill="#cc0000"/></svg>`,
+		},
+	}
+	for _, tt := range tests {
+		require.Equal(t, tt.expected, string(recolorSymbolic([]byte(tt.src), "#ff0000")))
+	}
+}
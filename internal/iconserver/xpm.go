@@ -0,0 +1,189 @@
+package iconserver
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"strconv"
+	"strings"
+)
+
+var ErrInvalidXPM = errors.New("invalid XPM image")
+
+// Limits of the decoded image, XPM icons in pixmaps are small
+const (
+	maxXPMSide   = 1024
+	maxXPMColors = 1 << 16
+)
+
+// Color names used by the icons in pixmaps, other X11 names are rejected
+var xpmColorNames = map[string]color.NRGBA{
+	"black":   {0x00, 0x00, 0x00, 0xff},
+	"white":   {0xff, 0xff, 0xff, 0xff},
+	"red":     {0xff, 0x00, 0x00, 0xff},
+	"green":   {0x00, 0xff, 0x00, 0xff},
+	"blue":    {0x00, 0x00, 0xff, 0xff},
+	"yellow":  {0xff, 0xff, 0x00, 0xff},
+	"cyan":    {0x00, 0xff, 0xff, 0xff},
+	"magenta": {0xff, 0x00, 0xff, 0xff},
+	"gray":    {0xbe, 0xbe, 0xbe, 0xff},
+	"grey":    {0xbe, 0xbe, 0xbe, 0xff},
+	"orange":  {0xff, 0xa5, 0x00, 0xff},
+}
+
+// decodeXPM reads an XPM3 image, the C source form written by most tools
+func decodeXPM(r io.Reader) (image.Image, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(data, []byte("XPM")) {
+		return nil, fmt.Errorf("%w: missing XPM header", ErrInvalidXPM)
+	}
+
+	lines := xpmStrings(data)
+	if len(lines) == 0 {
+		return nil, fmt.Errorf("%w: no values", ErrInvalidXPM)
+	}
+
+	var width, height, numColors, cpp int
+	values := strings.Fields(lines[0])
+	if len(values) < 4 {
+		return nil, fmt.Errorf("%w: values %q", ErrInvalidXPM, lines[0])
+	}
+	for i, v := range []*int{&width, &height, &numColors, &cpp} {
+		if *v, err = strconv.Atoi(values[i]); err != nil || *v < 1 {
+			return nil, fmt.Errorf("%w: values %q", ErrInvalidXPM, lines[0])
+		}
+	}
+	if width > maxXPMSide || height > maxXPMSide || numColors > maxXPMColors || cpp > 4 {
+		return nil, fmt.Errorf("%w: %dx%d with %d colors is too large", ErrInvalidXPM, width, height, numColors)
+	}
+	if len(lines) < 1+numColors+height {
+		return nil, fmt.Errorf("%w: expected %d colors and %d rows", ErrInvalidXPM, numColors, height)
+	}
+
+	colors := make(map[string]color.NRGBA, numColors)
+	for _, line := range lines[1 : 1+numColors] {
+		if len(line) < cpp {
+			return nil, fmt.Errorf("%w: color %q", ErrInvalidXPM, line)
+		}
+		c, err := parseXPMColor(line[cpp:])
+		if err != nil {
+			return nil, err
+		}
+		colors[line[:cpp]] = c
+	}
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y, row := range lines[1+numColors : 1+numColors+height] {
+		if len(row) < width*cpp {
+			return nil, fmt.Errorf("%w: row %d is too short", ErrInvalidXPM, y)
+		}
+		for x := range width {
+			key := row[x*cpp : (x+1)*cpp]
+			c, ok := colors[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: undefined pixel %q", ErrInvalidXPM, key)
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	return img, nil
+}
+
+// xpmStrings returns the quoted strings outside of comments
+func xpmStrings(data []byte) []string {
+	var res []string
+	for len(data) > 0 {
+		switch {
+		case bytes.HasPrefix(data, []byte("/*")):
+			end := bytes.Index(data[2:], []byte("*/"))
+			if end < 0 {
+				return res
+			}
+			data = data[end+4:]
+		case data[0] == '"':
+			end := bytes.IndexByte(data[1:], '"')
+			if end < 0 {
+				return res
+			}
+			res = append(res, string(data[1:end+1]))
+			data = data[end+2:]
+		default:
+			data = data[1:]
+		}
+	}
+
+	return res
+}
+
+// parseXPMColor reads the color of the keys "c", "g", "g4" or "m", in order of preference
+func parseXPMColor(spec string) (color.NRGBA, error) {
+	fields := strings.Fields(spec)
+	byKey := make(map[string]string)
+	for i := 0; i < len(fields); {
+		key := fields[i]
+		// the value is every word up to the next key, e.g. "c light gray"
+		j := i + 1
+		for j < len(fields) && !isXPMKey(fields[j]) {
+			j++
+		}
+		byKey[key] = strings.Join(fields[i+1:j], " ")
+		i = j
+	}
+
+	for _, key := range []string{"c", "g", "g4", "m"} {
+		if value, ok := byKey[key]; ok && value != "" {
+			return parseColorValue(value)
+		}
+	}
+
+	return color.NRGBA{}, fmt.Errorf("%w: color %q", ErrInvalidXPM, spec)
+}
+
+func isXPMKey(field string) bool {
+	switch field {
+	case "c", "g", "g4", "m", "s":
+		return true
+	}
+	return false
+}
+
+func parseColorValue(value string) (color.NRGBA, error) {
+	lower := strings.ToLower(value)
+	if lower == "none" {
+		return color.NRGBA{}, nil
+	}
+	if c, ok := xpmColorNames[strings.ReplaceAll(lower, " ", "")]; ok {
+		return c, nil
+	}
+
+	hex, ok := strings.CutPrefix(lower, "#")
+	if !ok || len(hex) == 0 || len(hex)%3 != 0 || len(hex) > 12 {
+		return color.NRGBA{}, fmt.Errorf("%w: unsupported color %q", ErrInvalidXPM, value)
+	}
+	// each channel keeps its most significant byte
+	digits := len(hex) / 3
+	var rgb [3]uint8
+	for i := range rgb {
+		v, err := strconv.ParseUint(hex[i*digits:(i+1)*digits], 16, 16)
+		if err != nil {
+			return color.NRGBA{}, fmt.Errorf("%w: color %q", ErrInvalidXPM, value)
+		}
+		switch digits {
+		case 1:
+			rgb[i] = uint8(v * 0x11)
+		case 2:
+			rgb[i] = uint8(v)
+		default:
+			rgb[i] = uint8(v >> (4 * (digits - 2)))
+		}
+	}
+
+	return color.NRGBA{rgb[0], rgb[1], rgb[2], 0xff}, nil
+}
@@ -0,0 +1,45 @@
+package iconserver
+
+import (
+	"image"
+	"image/color"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeXPM(t *testing.T) {
+	src := `/* XPM */
+static char * test_xpm[] = {
+"3 2 4 2",
+"   c None",
+".. c #F00 m black",
+"++ g4 #00ff00",
+"@@ s border c #00000000FFFF",
+"  ..++", /* rows */
+"@@@@  "};`
+	img, err := decodeXPM(strings.NewReader(src))
+	require.NoError(t, err)
+	require.Equal(t, image.Rect(0, 0, 3, 2), img.Bounds())
+	require.Equal(t, color.NRGBA{}, img.At(0, 0))
+	require.Equal(t, color.NRGBA{0xff, 0x00, 0x00, 0xff}, img.At(1, 0))
+	require.Equal(t, color.NRGBA{0x00, 0xff, 0x00, 0xff}, img.At(2, 0))
+	require.Equal(t, color.NRGBA{0x00, 0x00, 0xff, 0xff}, img.At(0, 1))
+	require.Equal(t, color.NRGBA{0x00, 0x00, 0xff, 0xff}, img.At(1, 1))
+	require.Equal(t, color.NRGBA{}, img.At(2, 1))
+
+	for _, src := range []string{
+		`"1 1 1 1", ". c #000", "."`,
+		`/* XPM */ "1 1"`,
+		`/* XPM */ "0 1 1 1", ". c #000", ""`,
+		`/* XPM */ "2000 1 1 1", ". c #000", "."`,
+		`/* XPM */ "1 2 1 1", ". c #000", "."`,
+		`/* XPM */ "1 1 1 1", ". c papayawhip", "."`,
+		`/* XPM */ "1 1 1 1", ". c #0000", "."`,
+		`/* XPM */ "2 1 1 1", ". c #000", ".x"`,
+	} {
+		_, err := decodeXPM(strings.NewReader(src))
+		require.ErrorIs(t, err, ErrInvalidXPM, src)
+	}
+}
@@ -0,0 +1,321 @@
+package applications
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Runix-Org/runix/internal/db"
+	"github.com/Runix-Org/runix/internal/provider/common"
+	"github.com/Runix-Org/runix/platform/wlx"
+	"github.com/Runix-Org/runix/platform/xdg/desktop"
+	"github.com/Runix-Org/runix/platform/xdg/icons"
+	"go.uber.org/zap"
+)
+
+const (
+	ProviderID = "applications"
+	// List of the launch history
+	ListID   = "main"
+	IconSize = 48
+
+	// Launch counts of uninstalled applications are kept for this time,
+	// so a reinstalled application keeps its history
+	launchCountGrace   = 30 * 24 * time.Hour
+	reconcileTimeout   = 10 * time.Second
+	launchCountTimeout = 2 * time.Second
+)
+
+var ErrUnknownApplication = errors.New("unknown application")
+
+// EntrySource loads the desktop entries, implemented by desktop.DesktopEntryLoader
+type EntrySource interface {
+	Update()
+	GetAll() []*desktop.DesktopEntry
+	SetUpdateHandler(onUpdate desktop.UpdateHandler)
+}
+
+// Launcher starts applications, implemented by desktop.DesktopEntryLauncher
+type Launcher interface {
+	Launch(de *desktop.DesktopEntry) error
+	LaunchAction(de *desktop.DesktopEntry, actionID string) error
+}
+
+// Clipboard copies text, implemented by wlx.Clipboard
+type Clipboard interface {
+	Copy(mimeType string, data []byte) error
+	CopyText(text string) error
+}
+
+var (
+	_ EntrySource     = (*desktop.DesktopEntryLoader)(nil)
+	_ Launcher        = (*desktop.DesktopEntryLauncher)(nil)
+	_ Clipboard       = (*wlx.Clipboard)(nil)
+	_ common.Provider = (*Provider)(nil)
+)
+
+// Provider returns installed applications
+type Provider struct {
+	source      EntrySource
+	launcher    Launcher
+	clipboard   Clipboard
+	launchCount *db.LaunchCountRepo
+
+	mu      sync.RWMutex
+	items   []common.BaseItem
+	entries map[string]*desktop.DesktopEntry
+
+	logger *zap.Logger
+}
+
+func NewProvider(
+	source EntrySource,
+	launcher Launcher,
+	clipboard Clipboard,
+	launchCount *db.LaunchCountRepo,
+	logger *zap.Logger,
+) *Provider {
+	return &Provider{
+		source:      source,
+		launcher:    launcher,
+		clipboard:   clipboard,
+		launchCount: launchCount,
+		items:       []common.BaseItem{},
+		entries:     map[string]*desktop.DesktopEntry{},
+		logger:      logger.With(zap.String("provider", ProviderID)),
+	}
+}
+
+func (p *Provider) ID() string {
+	return ProviderID
+}
+
+// Init loads the desktop entries, they are reloaded on every Update of the source
+func (p *Provider) Init(ctx context.Context) error {
+	p.source.SetUpdateHandler(p.onUpdate)
+	p.source.Update()
+	return nil
+}
+
+func (p *Provider) onUpdate(ids []string) {
+	entries := p.source.GetAll()
+	items := make([]common.BaseItem, 0, len(entries))
+	index := make(map[string]*desktop.DesktopEntry, len(entries))
+	for _, de := range entries {
+		items = append(items, newItem(de))
+		index[de.ID] = de
+	}
+
+	p.mu.Lock()
+	p.items = items
+	p.entries = index
+	p.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), reconcileTimeout)
+	defer cancel()
+	deleted, err := p.launchCount.Reconcile(ctx, ListID, ProviderID, ids, launchCountGrace)
+	if err != nil {
+		p.logger.Warn("Failed reconciling launch counts", zap.Error(err))
+	} else if deleted != 0 {
+		p.logger.Info("Launch counts of uninstalled applications removed", zap.Int64("count", deleted))
+	}
+}
+
+// Query returns the applications matching query, better matches and frequently launched first
+func (p *Provider) Query(ctx context.Context, query string) ([]common.BaseItem, error) {
+	counts, err := p.launchCount.Get(ctx, ListID, ProviderID)
+	if err != nil {
+		return nil, fmt.Errorf("get launch counts: %w", err)
+	}
+
+	p.mu.RLock()
+	all := p.items
+	p.mu.RUnlock()
+
+	query = strings.ToLower(strings.TrimSpace(query))
+	type match struct {
+		item  common.BaseItem
+		score int
+	}
+	matches := make([]match, 0, len(all))
+	for _, item := range all {
+		score, ok := matchScore(&item, query)
+		if !ok {
+			continue
+		}
+		item.LaunchCount = counts[item.ID]
+		matches = append(matches, match{item: item, score: score})
+	}
+
+	slices.SortStableFunc(matches, func(a, b match) int {
+		return cmp.Or(
+			cmp.Compare(a.score, b.score),
+			cmp.Compare(b.item.LaunchCount, a.item.LaunchCount),
+			strings.Compare(strings.ToLower(a.item.Title), strings.ToLower(b.item.Title)),
+		)
+	})
+
+	res := make([]common.BaseItem, 0, len(matches))
+	for _, m := range matches {
+		res = append(res, m.item)
+	}
+	return res, nil
+}
+
+// matchScore returns the rank of the match, lower is better
+func matchScore(item *common.BaseItem, query string) (int, bool) {
+	if query == "" {
+		return 0, true
+	}
+
+	title := strings.ToLower(item.Title)
+	switch {
+	case strings.HasPrefix(title, query):
+		return 0, true
+	case strings.Contains(title, " "+query):
+		return 1, true
+	case strings.Contains(title, query):
+		return 2, true
+	}
+
+	if item.SubTitle != nil && strings.Contains(strings.ToLower(*item.SubTitle), query) {
+		return 3, true
+	}
+	for _, keyword := range item.Keywords {
+		if strings.HasPrefix(strings.ToLower(keyword), query) {
+			return 4, true
+		}
+	}
+
+	return 0, false
+}
+
+// Execute launches the application or its desktop action and counts the launch,
+// or copies the payload, the command line of the application without one
+func (p *Provider) Execute(ctx context.Context, itemID string, action common.ItemAction) error {
+	p.mu.RLock()
+	de, ok := p.entries[itemID]
+	p.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownApplication, itemID)
+	}
+
+	switch action.Action {
+	case common.ActionTypeLaunch:
+		return p.launch(ctx, de, action.ID)
+	case common.ActionTypeCopy:
+		payload, _ := common.PayloadAs[common.CopyPayload](action)
+		var err error
+		switch {
+		case len(payload.Data) != 0:
+			err = p.clipboard.Copy(payload.MimeType, payload.Data)
+		case payload.Text != "":
+			err = p.clipboard.CopyText(payload.Text)
+		default:
+			err = p.clipboard.CopyText(de.Exec)
+		}
+		if err != nil {
+			return fmt.Errorf("copy %s: %w", itemID, err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported action %s", action.Action)
+	}
+}
+
+func (p *Provider) launch(ctx context.Context, de *desktop.DesktopEntry, actionID string) error {
+	var err error
+	if actionID == "" {
+		err = p.launcher.Launch(de)
+	} else {
+		err = p.launcher.LaunchAction(de, actionID)
+	}
+	if err != nil {
+		return fmt.Errorf("launch %s: %w", de.ID, err)
+	}
+
+	// the application is running, a failed counter only affects sorting
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), launchCountTimeout)
+	defer cancel()
+	if _, err := p.launchCount.Increment(ctx, ListID, ProviderID, de.ID); err != nil {
+		p.logger.Warn("Failed incrementing launch count", zap.String("id", de.ID), zap.Error(err))
+	}
+
+	return nil
+}
+
+func (p *Provider) Close() error {
+	p.source.SetUpdateHandler(nil)
+	return nil
+}
+
+func newItem(de *desktop.DesktopEntry) common.BaseItem {
+	item := common.BaseItem{
+		ID:       de.ID,
+		PluginID: ProviderID,
+		Type:     common.ItemTypeApplication,
+		Title:    firstOrEmpty(de.Name),
+		SubTitle: common.EmptyToOptionalString(firstOrEmpty(de.GenericName)),
+		Icon:     common.EmptyToOptionalIcon("", IconSize, icons.AppIconNames(de.Icon, de.ID, de.StartupWMClass)...),
+		Keywords: keywords(de),
+		Actions:  make([]common.ItemAction, 0, len(de.Actions)+2),
+	}
+
+	item.Actions = append(item.Actions, common.ItemAction{
+		Title:  "Launch",
+		Action: common.ActionTypeLaunch,
+	})
+	for _, action := range de.Actions {
+		item.Actions = append(item.Actions, common.ItemAction{
+			ID:     action.ID,
+			Title:  firstOrEmpty(action.Name),
+			Icon:   common.EmptyToOptionalIcon(action.Icon, IconSize),
+			Action: common.ActionTypeLaunch,
+		})
+	}
+	// D-Bus activatable applications may have no command line
+	if de.Exec != "" {
+		item.Actions = append(item.Actions, common.ItemAction{
+			Title:   "Copy Command",
+			Action:  common.ActionTypeCopy,
+			Payload: common.CopyPayload{Text: de.Exec},
+		})
+	}
+
+	return item
+}
+
+// keywords of the preferred locale and the categories, without duplicates
+func keywords(de *desktop.DesktopEntry) []string {
+	var localized []string
+	if len(de.Keywords) != 0 {
+		localized = de.Keywords[0]
+	}
+
+	res := make([]string, 0, len(localized)+len(de.Categories))
+	seen := make(map[string]struct{}, cap(res))
+	for _, list := range [][]string{localized, de.Categories} {
+		for _, keyword := range list {
+			if _, ok := seen[keyword]; ok || keyword == "" {
+				continue
+			}
+			seen[keyword] = struct{}{}
+			res = append(res, keyword)
+		}
+	}
+
+	return res
+}
+
+// Localized values are ordered by locale preference
+func firstOrEmpty(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
@@ -0,0 +1,282 @@
+package applications
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/Runix-Org/runix/internal/db"
+	"github.com/Runix-Org/runix/internal/provider/common"
+	"github.com/Runix-Org/runix/platform/xdg/desktop"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type fakeSource struct {
+	entries  []*desktop.DesktopEntry
+	onUpdate desktop.UpdateHandler
+}
+
+func (s *fakeSource) Update() {
+	if s.onUpdate == nil {
+		return
+	}
+	ids := make([]string, 0, len(s.entries))
+	for _, de := range s.entries {
+		ids = append(ids, de.ID)
+	}
+	s.onUpdate(ids)
+}
+
+func (s *fakeSource) GetAll() []*desktop.DesktopEntry {
+	return s.entries
+}
+
+func (s *fakeSource) SetUpdateHandler(onUpdate desktop.UpdateHandler) {
+	s.onUpdate = onUpdate
+}
+
+type fakeClipboard struct {
+	text     string
+	mimeType string
+	data     []byte
+}
+
+func (c *fakeClipboard) Copy(mimeType string, data []byte) error {
+	c.mimeType = mimeType
+	c.data = data
+	return nil
+}
+
+func (c *fakeClipboard) CopyText(text string) error {
+	c.text = text
+	return nil
+}
+
+type fakeLauncher struct {
+	launched []string
+	err      error
+}
+
+func (l *fakeLauncher) Launch(de *desktop.DesktopEntry) error {
+	return l.LaunchAction(de, "")
+}
+
+func (l *fakeLauncher) LaunchAction(de *desktop.DesktopEntry, actionID string) error {
+	if l.err != nil {
+		return l.err
+	}
+	l.launched = append(l.launched, de.ID+":"+actionID)
+	return nil
+}
+
+var (
+	firefox = &desktop.DesktopEntry{
+		ID:          "firefox",
+		Name:        []string{"Firefox", "Firefox"},
+		GenericName: []string{"Webbrowser", "Web Browser"},
+		Icon:        "firefox",
+		Exec:        "firefox %u",
+		Categories:  []string{"Network", "WebBrowser"},
+		Keywords:    [][]string{{"Internet", "WWW", "Network"}},
+		Actions: []desktop.DesktopAction{
+			{ID: "new-private-window", Name: []string{"Neues privates Fenster"}, Icon: "private"},
+		},
+	}
+	gimp = &desktop.DesktopEntry{
+		ID:         "gimp",
+		Name:       []string{"GNU Image Manipulation Program"},
+		Categories: []string{"Graphics"},
+	}
+	files = &desktop.DesktopEntry{
+		ID:   "org.gnome.Nautilus",
+		Name: []string{"Files"},
+	}
+)
+
+type ProviderSuite struct {
+	suite.Suite
+	db        *db.DB
+	source    *fakeSource
+	launcher  *fakeLauncher
+	clipboard *fakeClipboard
+	provider  *Provider
+}
+
+func (s *ProviderSuite) SetupTest() {
+	t := s.T()
+
+	dir := t.TempDir()
+	var err error
+	s.db, err = db.New(context.Background(), &db.DBConfig{
+		Path:           filepath.Join(dir, "launch.db"),
+		LogLevel:       gormlogger.Silent,
+		DisableBackups: true,
+	}, zap.NewNop())
+	require.NoError(t, err)
+
+	s.source = &fakeSource{entries: []*desktop.DesktopEntry{firefox, gimp, files}}
+	s.launcher = &fakeLauncher{}
+	s.clipboard = &fakeClipboard{}
+	s.provider = NewProvider(s.source, s.launcher, s.clipboard, s.db.LaunchCount(), zap.NewNop())
+	require.NoError(t, s.provider.Init(context.Background()))
+}
+
+func (s *ProviderSuite) TearDownTest() {
+	require.NoError(s.T(), s.provider.Close())
+	s.db.Close()
+}
+
+func (s *ProviderSuite) query(query string) []common.BaseItem {
+	items, err := s.provider.Query(context.Background(), query)
+	require.NoError(s.T(), err)
+	return items
+}
+
+func ids(items []common.BaseItem) []string {
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.ID)
+	}
+	return res
+}
+
+func (s *ProviderSuite) TestItem() {
+	t := s.T()
+
+	items := s.query("fire")
+	require.Len(t, items, 1)
+
+	subtitle := "Webbrowser"
+	icon := "/icons/firefox?size=48"
+	actionIcon := "/icons/private?size=48"
+	require.Equal(t, common.BaseItem{
+		ID:       "firefox",
+		PluginID: ProviderID,
+		Type:     common.ItemTypeApplication,
+		Title:    "Firefox",
+		SubTitle: &subtitle,
+		Icon:     &icon,
+		Keywords: []string{"Internet", "WWW", "Network", "WebBrowser"},
+		Actions: []common.ItemAction{
+			{Title: "Launch", Action: common.ActionTypeLaunch},
+			{ID: "new-private-window", Title: "Neues privates Fenster", Icon: &actionIcon, Action: common.ActionTypeLaunch},
+			{Title: "Copy Command", Action: common.ActionTypeCopy, Payload: common.CopyPayload{Text: "firefox %u"}},
+		},
+	}, items[0])
+}
+
+func (s *ProviderSuite) TestItemIcon() {
+	t := s.T()
+
+	tests := []struct {
+		de   *desktop.DesktopEntry
+		icon string
+	}{
+		{firefox, "/icons/firefox?size=48"},
+		// the desktop ID is the icon of the entries without one
+		{gimp, "/icons/gimp?size=48"},
+		{&desktop.DesktopEntry{ID: "org.example.Viewer", Icon: "viewer", StartupWMClass: "Viewer"},
+			"/icons/viewer?alt=org.example.Viewer&alt=Viewer&size=48"},
+		{&desktop.DesktopEntry{ID: "app", Icon: "/opt/app/icon.png"},
+			"/icons/%2Fopt%2Fapp%2Ficon.png?alt=app&size=48"},
+	}
+	for _, tt := range tests {
+		item := newItem(tt.de)
+		require.NotNil(t, item.Icon, tt.de.ID)
+		require.Equal(t, tt.icon, *item.Icon, tt.de.ID)
+	}
+}
+
+func (s *ProviderSuite) TestCopyCommand() {
+	t := s.T()
+
+	require.NoError(t, s.provider.Execute(context.Background(), "firefox", common.ItemAction{Action: common.ActionTypeCopy}))
+	require.Equal(t, "firefox %u", s.clipboard.text)
+	require.NoError(t, s.provider.Execute(context.Background(), "firefox", common.ItemAction{
+		Action:  common.ActionTypeCopy,
+		Payload: common.CopyPayload{Text: "firefox --private-window"},
+	}))
+	require.Equal(t, "firefox --private-window", s.clipboard.text)
+	require.Empty(t, s.launcher.launched)
+
+	// only launches are counted
+	require.EqualValues(t, 0, s.query("fire")[0].LaunchCount)
+}
+
+func (s *ProviderSuite) TestCopyPayload() {
+	t := s.T()
+	ctx := context.Background()
+
+	// data of a MIME type goes to the clipboard as is, the text stays untouched
+	require.NoError(t, s.provider.Execute(ctx, "firefox", common.ItemAction{
+		Action:  common.ActionTypeCopy,
+		Payload: common.CopyPayload{MimeType: "image/png", Data: []byte{1, 2}},
+	}))
+	require.Equal(t, "image/png", s.clipboard.mimeType)
+	require.Equal(t, []byte{1, 2}, s.clipboard.data)
+	require.Empty(t, s.clipboard.text)
+
+	// an empty text is not copied over the command line
+	require.NoError(t, s.provider.Execute(ctx, "firefox", common.ItemAction{
+		Action:  common.ActionTypeCopy,
+		Payload: common.CopyPayload{MimeType: "text/plain"},
+	}))
+	require.Equal(t, "firefox %u", s.clipboard.text)
+}
+
+func (s *ProviderSuite) TestQueryOrder() {
+	t := s.T()
+
+	require.Equal(t, []string{"org.gnome.Nautilus", "firefox", "gimp"}, ids(s.query("")))
+	// title prefix, word in title, keyword
+	require.Equal(t, []string{"gimp"}, ids(s.query("image")))
+	require.Equal(t, []string{"gimp"}, ids(s.query("graph")))
+	require.Equal(t, []string{"firefox"}, ids(s.query("web")))
+	require.Empty(t, s.query("vim"))
+}
+
+func (s *ProviderSuite) TestExecuteCountsLaunches() {
+	t := s.T()
+	ctx := context.Background()
+
+	launch := common.ItemAction{Title: "Launch", Action: common.ActionTypeLaunch}
+	require.NoError(t, s.provider.Execute(ctx, "gimp", launch))
+	require.NoError(t, s.provider.Execute(ctx, "gimp", launch))
+	require.NoError(t, s.provider.Execute(ctx, "firefox", common.ItemAction{ID: "new-private-window", Action: common.ActionTypeLaunch}))
+	require.Equal(t, []string{"gimp:", "gimp:", "firefox:new-private-window"}, s.launcher.launched)
+
+	items := s.query("")
+	require.Equal(t, []string{"gimp", "firefox", "org.gnome.Nautilus"}, ids(items))
+	require.EqualValues(t, 2, items[0].LaunchCount)
+
+	// failed launches are not counted
+	s.launcher.err = errors.New("not found")
+	require.Error(t, s.provider.Execute(ctx, "org.gnome.Nautilus", launch))
+	require.ErrorIs(t, s.provider.Execute(ctx, "vim", launch), ErrUnknownApplication)
+	count, err := s.db.LaunchCount().GetItem(ctx, ListID, ProviderID, "org.gnome.Nautilus")
+	require.ErrorIs(t, err, db.ErrNotFound)
+	require.Zero(t, count)
+}
+
+func (s *ProviderSuite) TestUpdateReconciles() {
+	t := s.T()
+	ctx := context.Background()
+
+	require.NoError(t, s.provider.Execute(ctx, "gimp", common.ItemAction{Action: common.ActionTypeLaunch}))
+
+	s.source.entries = []*desktop.DesktopEntry{firefox}
+	s.source.Update()
+	require.Equal(t, []string{"firefox"}, ids(s.query("")))
+
+	// the history of the removed application is kept for the grace period
+	_, err := s.db.LaunchCount().GetItem(ctx, ListID, ProviderID, "gimp")
+	require.NoError(t, err)
+}
+
+func TestProviderSuite(t *testing.T) {
+	suite.Run(t, new(ProviderSuite))
+}
@@ -0,0 +1,177 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path/filepath"
+)
+
+var (
+	ErrUnknownActionType = errors.New("unknown action type")
+	ErrMissingPayload    = errors.New("action requires a payload")
+	ErrPayloadMismatch   = errors.New("payload does not match the action type")
+	ErrInvalidPayload    = errors.New("invalid action payload")
+)
+
+// ActionPayload is the typed data of an ItemAction, it is serialized as the "payload" field
+type ActionPayload interface {
+	ActionType() ActionType
+	Validate() error
+}
+
+type actionSpec struct {
+	// nil for actions without payload
+	decode   func(data json.RawMessage) (ActionPayload, error)
+	required bool
+}
+
+var actionSpecs = map[ActionType]actionSpec{
+	ActionTypeLaunch:         {},
+	ActionTypeCopy:           {decode: decodePayload[CopyPayload]},
+	ActionTypeOpenURL:        {decode: decodePayload[OpenURLPayload], required: true},
+	ActionTypeOpenFile:       {decode: decodePayload[OpenFilePayload], required: true},
+	ActionTypeRevealFile:     {decode: decodePayload[RevealFilePayload], required: true},
+	ActionTypeRunCommand:     {decode: decodePayload[RunCommandPayload], required: true},
+	ActionTypeActivateWindow: {decode: decodePayload[ActivateWindowPayload], required: true},
+}
+
+func decodePayload[T ActionPayload](data json.RawMessage) (ActionPayload, error) {
+	var payload T
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return nil, err
+	}
+
+	return payload, nil
+}
+
+// PayloadAs returns the payload of action if it has the type T
+func PayloadAs[T ActionPayload](action ItemAction) (T, bool) {
+	payload, ok := action.Payload.(T)
+	return payload, ok
+}
+
+// CopyPayload is the content for ActionTypeCopy, either Text or Data of MimeType.
+// Without a payload the provider decides what is copied.
+type CopyPayload struct {
+	Text     string `json:"text,omitempty"`
+	MimeType string `json:"mimeType,omitempty"`
+	// Base64 in JSON
+	Data []byte `json:"data,omitempty"`
+}
+
+func (CopyPayload) ActionType() ActionType {
+	return ActionTypeCopy
+}
+
+func (p CopyPayload) Validate() error {
+	switch {
+	case p.Text != "" && len(p.Data) != 0:
+		return fmt.Errorf("%w: copy has both text and data", ErrInvalidPayload)
+	case p.Text == "" && len(p.Data) == 0:
+		return fmt.Errorf("%w: copy has neither text nor data", ErrInvalidPayload)
+	case len(p.Data) != 0 && p.MimeType == "":
+		return fmt.Errorf("%w: copy data without MIME type", ErrInvalidPayload)
+	}
+
+	return nil
+}
+
+// OpenURLPayload is the absolute URL opened with the default handler of its scheme
+type OpenURLPayload struct {
+	URL string `json:"url"`
+}
+
+func (OpenURLPayload) ActionType() ActionType {
+	return ActionTypeOpenURL
+}
+
+func (p OpenURLPayload) Validate() error {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+	if !u.IsAbs() {
+		return fmt.Errorf("%w: URL %q has no scheme", ErrInvalidPayload, p.URL)
+	}
+
+	return nil
+}
+
+// OpenFilePayload is the file opened with the default application of its MIME type
+type OpenFilePayload struct {
+	Path string `json:"path"`
+}
+
+func (OpenFilePayload) ActionType() ActionType {
+	return ActionTypeOpenFile
+}
+
+func (p OpenFilePayload) Validate() error {
+	return validateAbsPath(p.Path)
+}
+
+// RevealFilePayload is the file shown selected in the file manager
+type RevealFilePayload struct {
+	Path string `json:"path"`
+}
+
+func (RevealFilePayload) ActionType() ActionType {
+	return ActionTypeRevealFile
+}
+
+func (p RevealFilePayload) Validate() error {
+	return validateAbsPath(p.Path)
+}
+
+// RunCommandPayload is a command run without a shell
+type RunCommandPayload struct {
+	// Program and its arguments
+	Args []string `json:"args"`
+	// Working directory, empty for the home directory
+	Dir string `json:"dir,omitempty"`
+	// Run in a terminal emulator
+	Terminal bool `json:"terminal,omitempty"`
+}
+
+func (RunCommandPayload) ActionType() ActionType {
+	return ActionTypeRunCommand
+}
+
+func (p RunCommandPayload) Validate() error {
+	if len(p.Args) == 0 || p.Args[0] == "" {
+		return fmt.Errorf("%w: command without program", ErrInvalidPayload)
+	}
+	if p.Dir != "" {
+		return validateAbsPath(p.Dir)
+	}
+
+	return nil
+}
+
+// ActivateWindowPayload is the window focused by ActionTypeActivateWindow
+type ActivateWindowPayload struct {
+	// Identifier of the window manager, e.g. the X11 window ID or a toplevel handle
+	WindowID string `json:"windowID"`
+}
+
+func (ActivateWindowPayload) ActionType() ActionType {
+	return ActionTypeActivateWindow
+}
+
+func (p ActivateWindowPayload) Validate() error {
+	if p.WindowID == "" {
+		return fmt.Errorf("%w: empty window ID", ErrInvalidPayload)
+	}
+
+	return nil
+}
+
+func validateAbsPath(path string) error {
+	if !filepath.IsAbs(path) {
+		return fmt.Errorf("%w: path %q is not absolute", ErrInvalidPayload, path)
+	}
+
+	return nil
+}
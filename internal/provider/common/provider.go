@@ -0,0 +1,28 @@
+package common
+
+import (
+	"context"
+	"time"
+)
+
+// Provider is a source of items, e.g. applications or files.
+// All methods except Init and Close can be called concurrently.
+type Provider interface {
+	// Unique ID, it is the PluginID of the returned items
+	ID() string
+	// Init is called once before the first query
+	Init(ctx context.Context) error
+	// Query returns items matching query, ordered by relevance.
+	// It must return when ctx is done.
+	Query(ctx context.Context, query string) ([]BaseItem, error)
+	// Execute runs the action of the item returned by Query
+	Execute(ctx context.Context, itemID string, action ItemAction) error
+	// Close releases the resources, no methods are called after it
+	Close() error
+}
+
+// QueryTimeouter can be implemented by providers that need a timeout
+// different from the registry default, e.g. network search
+type QueryTimeouter interface {
+	QueryTimeout() time.Duration
+}
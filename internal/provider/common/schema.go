@@ -0,0 +1,19 @@
+package common
+
+import (
+	"bytes"
+	_ "embed"
+)
+
+// SchemaVersion is the version of the item JSON sent to the frontend.
+// It is increased on incompatible changes of BaseItem, ItemAction or the payloads,
+// the schema of every version is kept in the schema directory.
+const SchemaVersion = 1
+
+//go:embed schema/items.v1.json
+var itemSchema []byte
+
+// ItemSchema returns the JSON schema of BaseItem for SchemaVersion
+func ItemSchema() []byte {
+	return bytes.Clone(itemSchema)
+}
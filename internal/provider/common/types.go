@@ -1,25 +1,132 @@
 package common
 
-import "fmt"
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+)
+
+var (
+	ErrUnknownItemType = errors.New("unknown item type")
+	ErrInvalidItem     = errors.New("invalid item")
+)
 
 type ItemType string
 
 const (
 	ItemTypeApplication ItemType = "Application"
+	ItemTypeFile        ItemType = "File"
+	ItemTypeURL         ItemType = "URL"
+	ItemTypeCommand     ItemType = "Command"
+	ItemTypeCalculation ItemType = "Calculation"
+	ItemTypeWindow      ItemType = "Window"
+	ItemTypeSetting     ItemType = "Setting"
 )
 
+var itemTypes = []ItemType{
+	ItemTypeApplication,
+	ItemTypeFile,
+	ItemTypeURL,
+	ItemTypeCommand,
+	ItemTypeCalculation,
+	ItemTypeWindow,
+	ItemTypeSetting,
+}
+
+func (t ItemType) Validate() error {
+	if !slices.Contains(itemTypes, t) {
+		return fmt.Errorf("%w: %q", ErrUnknownItemType, t)
+	}
+
+	return nil
+}
+
 type ActionType string
 
 const (
-	ActionTypeLaunch ActionType = "Launch"
-	ActionTypeCopy   ActionType = "Copy"
+	ActionTypeLaunch         ActionType = "Launch"
+	ActionTypeCopy           ActionType = "Copy"
+	ActionTypeOpenURL        ActionType = "OpenURL"
+	ActionTypeOpenFile       ActionType = "OpenFile"
+	ActionTypeRevealFile     ActionType = "RevealFile"
+	ActionTypeRunCommand     ActionType = "RunCommand"
+	ActionTypeActivateWindow ActionType = "ActivateWindow"
 )
 
+func (t ActionType) Validate() error {
+	if _, ok := actionSpecs[t]; !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownActionType, t)
+	}
+
+	return nil
+}
+
 type ItemAction struct {
+	// Identifies the action within the item, e.g. a desktop action ID.
+	// Empty for the default action of its type.
+	ID       string     `json:"id,omitempty"`
 	Title    string     `json:"title"`
 	Icon     *string    `json:"icon,omitempty"`
 	Shortcut *[]string  `json:"shortcut,omitempty"`
 	Action   ActionType `json:"action"`
+	// Typed data of the action, its type is given by Action
+	Payload ActionPayload `json:"payload,omitempty"`
+}
+
+// UnmarshalJSON decodes the payload into the type of the action
+func (a *ItemAction) UnmarshalJSON(data []byte) error {
+	type itemAction ItemAction
+	var raw struct {
+		itemAction
+		Payload json.RawMessage `json:"payload,omitempty"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	*a = ItemAction(raw.itemAction)
+	a.Payload = nil
+	if len(raw.Payload) == 0 || string(raw.Payload) == "null" {
+		return nil
+	}
+
+	spec, ok := actionSpecs[a.Action]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownActionType, a.Action)
+	}
+	if spec.decode == nil {
+		return fmt.Errorf("%w: %s has no payload", ErrPayloadMismatch, a.Action)
+	}
+	payload, err := spec.decode(raw.Payload)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidPayload, err)
+	}
+	a.Payload = payload
+
+	return nil
+}
+
+// Validate checks that the payload is present when required and matches the action type
+func (a *ItemAction) Validate() error {
+	spec, ok := actionSpecs[a.Action]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrUnknownActionType, a.Action)
+	}
+
+	if a.Payload == nil {
+		if spec.required {
+			return fmt.Errorf("%w: %s", ErrMissingPayload, a.Action)
+		}
+		return nil
+	}
+	if a.Payload.ActionType() != a.Action {
+		return fmt.Errorf("%w: %s payload for %s", ErrPayloadMismatch, a.Payload.ActionType(), a.Action)
+	}
+
+	return a.Payload.Validate()
 }
 
 type BaseItem struct {
@@ -34,6 +141,26 @@ type BaseItem struct {
 	LaunchCount uint         `json:"launchCount"`
 }
 
+// Validate checks the item and all its actions
+func (i *BaseItem) Validate() error {
+	if i.ID == "" {
+		return fmt.Errorf("%w: empty ID", ErrInvalidItem)
+	}
+	if i.Title == "" {
+		return fmt.Errorf("%w %s: empty title", ErrInvalidItem, i.ID)
+	}
+	if err := i.Type.Validate(); err != nil {
+		return fmt.Errorf("%w %s: %w", ErrInvalidItem, i.ID, err)
+	}
+	for idx := range i.Actions {
+		if err := i.Actions[idx].Validate(); err != nil {
+			return fmt.Errorf("%w %s: action %d: %w", ErrInvalidItem, i.ID, idx, err)
+		}
+	}
+
+	return nil
+}
+
 func (i *BaseItem) GetID() string {
 	return i.ID
 }
@@ -60,12 +187,24 @@ func EmptyToOptionalString(v string) *string {
 	return &v
 }
 
-func EmptyToOptionalIcon(v string, size int) *string {
+// EmptyToOptionalIcon returns the icon URL of v, alts are the names tried when v is not found.
+// If v is empty the first alt is the icon.
+func EmptyToOptionalIcon(v string, size int, alts ...string) *string {
+	for v == "" && len(alts) > 0 {
+		v, alts = alts[0], alts[1:]
+	}
 	if v == "" {
 		return nil
 	}
 
-	v = fmt.Sprintf("/icons/%s?size=%d", v, size)
+	query := url.Values{"size": {strconv.Itoa(size)}}
+	for _, alt := range alts {
+		if alt != "" {
+			query.Add("alt", alt)
+		}
+	}
+	// absolute paths are escaped, http.ServeMux would clean the "//" of the path
+	v = fmt.Sprintf("/icons/%s?%s", url.PathEscape(v), query.Encode())
 
 	return &v
 }
@@ -0,0 +1,180 @@
+package common
+
+import (
+	"encoding/json"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+type TypesSuite struct {
+	suite.Suite
+}
+
+func (s *TypesSuite) TestActionValidate() {
+	t := s.T()
+
+	tests := []struct {
+		action ItemAction
+		err    error
+	}{
+		{ItemAction{Action: ActionTypeLaunch}, nil},
+		{ItemAction{Action: ActionTypeCopy}, nil},
+		{ItemAction{Action: ActionTypeCopy, Payload: CopyPayload{Text: "42"}}, nil},
+		{ItemAction{Action: ActionTypeCopy, Payload: CopyPayload{MimeType: "image/png", Data: []byte{1}}}, nil},
+		{ItemAction{Action: ActionTypeCopy, Payload: CopyPayload{Data: []byte{1}}}, ErrInvalidPayload},
+		{ItemAction{Action: ActionTypeCopy, Payload: CopyPayload{Text: "42", Data: []byte{1}}}, ErrInvalidPayload},
+		{ItemAction{Action: ActionTypeCopy, Payload: CopyPayload{}}, ErrInvalidPayload},
+		{ItemAction{Action: ActionTypeOpenURL, Payload: OpenURLPayload{URL: "https://example.org"}}, nil},
+		{ItemAction{Action: ActionTypeOpenURL, Payload: OpenURLPayload{URL: "example.org"}}, ErrInvalidPayload},
+		{ItemAction{Action: ActionTypeOpenURL}, ErrMissingPayload},
+		{ItemAction{Action: ActionTypeOpenURL, Payload: OpenFilePayload{Path: "/tmp"}}, ErrPayloadMismatch},
+		{ItemAction{Action: ActionTypeOpenFile, Payload: OpenFilePayload{Path: "/home/user/a.pdf"}}, nil},
+		{ItemAction{Action: ActionTypeRevealFile, Payload: RevealFilePayload{Path: "a.pdf"}}, ErrInvalidPayload},
+		{ItemAction{Action: ActionTypeRunCommand, Payload: RunCommandPayload{Args: []string{"htop"}, Terminal: true}}, nil},
+		{ItemAction{Action: ActionTypeRunCommand, Payload: RunCommandPayload{Args: []string{"ls"}, Dir: "tmp"}}, ErrInvalidPayload},
+		{ItemAction{Action: ActionTypeRunCommand, Payload: RunCommandPayload{}}, ErrInvalidPayload},
+		{ItemAction{Action: ActionTypeActivateWindow, Payload: ActivateWindowPayload{}}, ErrInvalidPayload},
+		{ItemAction{Action: ActionTypeLaunch, Payload: CopyPayload{Text: "42"}}, ErrPayloadMismatch},
+		{ItemAction{Action: "Explode"}, ErrUnknownActionType},
+	}
+	for _, tt := range tests {
+		err := tt.action.Validate()
+		if tt.err == nil {
+			require.NoError(t, err, "%+v", tt.action)
+		} else {
+			require.ErrorIs(t, err, tt.err, "%+v", tt.action)
+		}
+	}
+}
+
+func (s *TypesSuite) TestItemValidate() {
+	t := s.T()
+
+	item := BaseItem{ID: "calc", Type: ItemTypeCalculation, Title: "4", Actions: []ItemAction{
+		{Title: "Copy", Action: ActionTypeCopy, Payload: CopyPayload{Text: "4"}},
+	}}
+	require.NoError(t, item.Validate())
+
+	invalid := item
+	invalid.Type = "Spreadsheet"
+	require.ErrorIs(t, invalid.Validate(), ErrUnknownItemType)
+	require.ErrorIs(t, invalid.Validate(), ErrInvalidItem)
+
+	invalid = item
+	invalid.Title = ""
+	require.ErrorIs(t, invalid.Validate(), ErrInvalidItem)
+
+	invalid = item
+	invalid.Actions = []ItemAction{{Title: "Open", Action: ActionTypeOpenURL}}
+	require.ErrorIs(t, invalid.Validate(), ErrMissingPayload)
+}
+
+func (s *TypesSuite) TestJSON() {
+	t := s.T()
+
+	actions := []ItemAction{
+		{Title: "Launch", Action: ActionTypeLaunch},
+		{Title: "Copy", Action: ActionTypeCopy, Payload: CopyPayload{MimeType: "image/png", Data: []byte{0x89, 'P'}}},
+		{ID: "site", Title: "Open", Action: ActionTypeOpenURL, Payload: OpenURLPayload{URL: "https://example.org"}},
+		{Title: "Run", Action: ActionTypeRunCommand, Payload: RunCommandPayload{Args: []string{"htop"}, Terminal: true}},
+	}
+	data, err := json.Marshal(actions)
+	require.NoError(t, err)
+	require.Contains(t, string(data), `{"title":"Launch","action":"Launch"}`)
+	require.Contains(t, string(data), `"payload":{"url":"https://example.org"}`)
+
+	var decoded []ItemAction
+	require.NoError(t, json.Unmarshal(data, &decoded))
+	require.Equal(t, actions, decoded)
+
+	payload, ok := PayloadAs[RunCommandPayload](decoded[3])
+	require.True(t, ok)
+	require.Equal(t, []string{"htop"}, payload.Args)
+	_, ok = PayloadAs[CopyPayload](decoded[3])
+	require.False(t, ok)
+}
+
+func (s *TypesSuite) TestUnmarshalErrors() {
+	t := s.T()
+
+	var action ItemAction
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"action":"Explode","payload":{}}`), &action), ErrUnknownActionType)
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"action":"Launch","payload":{"url":"x"}}`), &action), ErrPayloadMismatch)
+	require.ErrorIs(t, json.Unmarshal([]byte(`{"action":"OpenURL","payload":{"url":1}}`), &action), ErrInvalidPayload)
+
+	require.NoError(t, json.Unmarshal([]byte(`{"title":"Launch","action":"Launch","payload":null}`), &action))
+	require.Equal(t, ItemAction{Title: "Launch", Action: ActionTypeLaunch}, action)
+}
+
+// TestSchemaInSync fails when a type or payload field is added without updating the schema
+func (s *TypesSuite) TestSchemaInSync() {
+	t := s.T()
+
+	var schema struct {
+		Defs map[string]struct {
+			Enum       []string                   `json:"enum"`
+			Properties map[string]json.RawMessage `json:"properties"`
+			AllOf      []struct {
+				If struct {
+					Properties struct {
+						Action struct {
+							Const string `json:"const"`
+						} `json:"action"`
+					} `json:"properties"`
+				} `json:"if"`
+			} `json:"allOf"`
+		} `json:"$defs"`
+	}
+	require.NoError(t, json.Unmarshal(ItemSchema(), &schema))
+
+	itemTypeNames := make([]string, 0, len(itemTypes))
+	for _, itemType := range itemTypes {
+		itemTypeNames = append(itemTypeNames, string(itemType))
+	}
+	require.Equal(t, itemTypeNames, schema.Defs["ItemType"].Enum)
+
+	actionTypeNames := make([]string, 0, len(actionSpecs))
+	for actionType := range actionSpecs {
+		actionTypeNames = append(actionTypeNames, string(actionType))
+	}
+	require.ElementsMatch(t, actionTypeNames, schema.Defs["ActionType"].Enum)
+
+	var conditions []string
+	for _, cond := range schema.Defs["ItemAction"].AllOf {
+		conditions = append(conditions, cond.If.Properties.Action.Const)
+	}
+	require.ElementsMatch(t, actionTypeNames, conditions)
+
+	require.ElementsMatch(t, jsonFields(reflect.TypeOf(ItemAction{})), slices.Collect(maps.Keys(schema.Defs["ItemAction"].Properties)))
+	require.ElementsMatch(t, jsonFields(reflect.TypeOf(BaseItem{})), slices.Collect(maps.Keys(schema.Defs["BaseItem"].Properties)))
+	for actionType, spec := range actionSpecs {
+		if spec.decode == nil {
+			continue
+		}
+		payload, err := spec.decode(json.RawMessage(`{}`))
+		require.NoError(t, err)
+		typ := reflect.TypeOf(payload)
+		def, ok := schema.Defs[typ.Name()]
+		require.True(t, ok, "schema of %s payload", actionType)
+		require.ElementsMatch(t, jsonFields(typ), slices.Collect(maps.Keys(def.Properties)), typ.Name())
+	}
+}
+
+func jsonFields(typ reflect.Type) []string {
+	var res []string
+	for i := range typ.NumField() {
+		name, _, _ := strings.Cut(typ.Field(i).Tag.Get("json"), ",")
+		res = append(res, name)
+	}
+	return res
+}
+
+func TestTypes(t *testing.T) {
+	suite.Run(t, new(TypesSuite))
+}
@@ -0,0 +1,260 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Runix-Org/runix/internal/provider/common"
+	"go.uber.org/zap"
+)
+
+const DefaultQueryTimeout = 300 * time.Millisecond
+
+var (
+	ErrDuplicateProvider = errors.New("provider is already registered")
+	ErrUnknownProvider   = errors.New("unknown provider")
+)
+
+// QueryResult is the merged result of all providers.
+// Errors contains providers that failed or timed out, their items are missing.
+type QueryResult struct {
+	Items  []common.BaseItem
+	Errors map[string]error
+}
+
+// Registry owns the providers and fans queries out to them
+type Registry struct {
+	mu        sync.RWMutex
+	providers []common.Provider
+	byID      map[string]common.Provider
+	timeout   time.Duration
+	logger    *zap.Logger
+}
+
+// NewRegistry creates an empty registry, timeout <= 0 means DefaultQueryTimeout
+func NewRegistry(timeout time.Duration, logger *zap.Logger) *Registry {
+	if timeout <= 0 {
+		timeout = DefaultQueryTimeout
+	}
+	return &Registry{
+		providers: []common.Provider{},
+		byID:      map[string]common.Provider{},
+		timeout:   timeout,
+		logger:    logger.With(zap.String("task", "providers")),
+	}
+}
+
+// Register adds p, results are merged in the order of registration
+func (r *Registry) Register(p common.Provider) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	id := p.ID()
+	if _, ok := r.byID[id]; ok {
+		return fmt.Errorf("%w: %s", ErrDuplicateProvider, id)
+	}
+	r.providers = append(r.providers, p)
+	r.byID[id] = p
+	return nil
+}
+
+func (r *Registry) Get(id string) (common.Provider, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	p, ok := r.byID[id]
+	return p, ok
+}
+
+// Init initializes all providers concurrently.
+// Providers that fail are logged and unregistered, the joined errors are returned.
+func (r *Registry) Init(ctx context.Context) error {
+	providers := r.snapshot()
+	errs := make([]error, len(providers))
+
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = safeCall(p.ID(), func() error {
+				return p.Init(ctx)
+			})
+		}()
+	}
+	wg.Wait()
+
+	var failed []error
+	for i, err := range errs {
+		if err == nil {
+			continue
+		}
+		id := providers[i].ID()
+		r.logger.Error("Failed initializing provider", zap.String("provider", id), zap.Error(err))
+		r.unregister(id)
+		// releases what the provider opened before failing
+		if err := safeCall(id, providers[i].Close); err != nil {
+			r.logger.Warn("Failed closing provider", zap.String("provider", id), zap.Error(err))
+		}
+		failed = append(failed, fmt.Errorf("init %s: %w", id, err))
+	}
+
+	return errors.Join(failed...)
+}
+
+// Query runs query on all providers concurrently, each one with its own timeout.
+// It returns when all providers have answered, timed out or ctx is done.
+// Invalid items are dropped.
+func (r *Registry) Query(ctx context.Context, query string) QueryResult {
+	providers := r.snapshot()
+
+	type answer struct {
+		items []common.BaseItem
+		err   error
+	}
+	answers := make([]answer, len(providers))
+
+	var wg sync.WaitGroup
+	for i, p := range providers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			items, err := r.queryOne(ctx, p, query)
+			answers[i] = answer{items: items, err: err}
+		}()
+	}
+	wg.Wait()
+
+	res := QueryResult{
+		Items:  []common.BaseItem{},
+		Errors: map[string]error{},
+	}
+	type itemKey struct{ pluginID, id string }
+	seen := map[itemKey]struct{}{}
+	for i, a := range answers {
+		id := providers[i].ID()
+		if a.err != nil {
+			res.Errors[id] = a.err
+			if !errors.Is(a.err, context.Canceled) {
+				r.logger.Warn("Provider query failed", zap.String("provider", id), zap.Error(a.err))
+			}
+			continue
+		}
+
+		for _, item := range a.items {
+			// the item is routed back to its provider by PluginID
+			item.PluginID = id
+			if err := item.Validate(); err != nil {
+				r.logger.Warn("Provider returned an invalid item", zap.String("provider", id), zap.Error(err))
+				continue
+			}
+			key := itemKey{item.PluginID, item.ID}
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			res.Items = append(res.Items, item)
+		}
+	}
+
+	return res
+}
+
+// queryOne does not wait for a provider that ignores the cancellation of its context
+func (r *Registry) queryOne(ctx context.Context, p common.Provider, query string) ([]common.BaseItem, error) {
+	timeout := r.timeout
+	if t, ok := p.(common.QueryTimeouter); ok && t.QueryTimeout() > 0 {
+		timeout = t.QueryTimeout()
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	type answer struct {
+		items []common.BaseItem
+		err   error
+	}
+	ch := make(chan answer, 1)
+	go func() {
+		var items []common.BaseItem
+		err := safeCall(p.ID(), func() error {
+			var err error
+			items, err = p.Query(ctx, query)
+			return err
+		})
+		ch <- answer{items: items, err: err}
+	}()
+
+	select {
+	case a := <-ch:
+		return a.items, a.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// Execute runs the action on the item of the provider pluginID
+func (r *Registry) Execute(ctx context.Context, pluginID string, itemID string, action common.ItemAction) error {
+	p, ok := r.Get(pluginID)
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownProvider, pluginID)
+	}
+	if err := action.Validate(); err != nil {
+		return err
+	}
+
+	return safeCall(pluginID, func() error {
+		return p.Execute(ctx, itemID, action)
+	})
+}
+
+// Close closes and unregisters all providers
+func (r *Registry) Close() error {
+	r.mu.Lock()
+	providers := r.providers
+	r.providers = []common.Provider{}
+	r.byID = map[string]common.Provider{}
+	r.mu.Unlock()
+
+	var errs []error
+	for _, p := range providers {
+		if err := safeCall(p.ID(), p.Close); err != nil {
+			errs = append(errs, fmt.Errorf("close %s: %w", p.ID(), err))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *Registry) snapshot() []common.Provider {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]common.Provider(nil), r.providers...)
+}
+
+func (r *Registry) unregister(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.byID, id)
+	for i, p := range r.providers {
+		if p.ID() == id {
+			r.providers = append(r.providers[:i], r.providers[i+1:]...)
+			break
+		}
+	}
+}
+
+// safeCall turns a panic of a provider into an error
+func safeCall(id string, fn func() error) (err error) {
+	defer func() {
+		if rec := recover(); rec != nil {
+			err = fmt.Errorf("provider %s panicked: %v", id, rec)
+		}
+	}()
+
+	return fn()
+}
@@ -0,0 +1,203 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Runix-Org/runix/internal/provider/common"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+type fakeProvider struct {
+	id       string
+	items    []common.BaseItem
+	delay    time.Duration
+	timeout  time.Duration
+	initErr  error
+	queryErr error
+	closeErr error
+	panics   bool
+
+	executed atomic.Value
+	closed   atomic.Bool
+}
+
+func (p *fakeProvider) ID() string {
+	return p.id
+}
+
+func (p *fakeProvider) Init(ctx context.Context) error {
+	return p.initErr
+}
+
+func (p *fakeProvider) Query(ctx context.Context, query string) ([]common.BaseItem, error) {
+	if p.panics {
+		panic("boom")
+	}
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-time.After(p.delay):
+	}
+
+	return p.items, p.queryErr
+}
+
+func (p *fakeProvider) Execute(ctx context.Context, itemID string, action common.ItemAction) error {
+	p.executed.Store(itemID + ":" + string(action.Action))
+	return nil
+}
+
+func (p *fakeProvider) Close() error {
+	p.closed.Store(true)
+	return p.closeErr
+}
+
+// fakeTimeoutProvider has its own query timeout
+type fakeTimeoutProvider struct {
+	*fakeProvider
+}
+
+func (p fakeTimeoutProvider) QueryTimeout() time.Duration {
+	return p.timeout
+}
+
+type RegistrySuite struct {
+	suite.Suite
+	registry *Registry
+}
+
+func (s *RegistrySuite) SetupTest() {
+	s.registry = NewRegistry(50*time.Millisecond, zap.NewNop())
+}
+
+func (s *RegistrySuite) TearDownTest() {
+	require.NoError(s.T(), s.registry.Close())
+}
+
+func items(ids ...string) []common.BaseItem {
+	res := make([]common.BaseItem, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, common.BaseItem{ID: id, Type: common.ItemTypeApplication, Title: id})
+	}
+	return res
+}
+
+func itemIDs(items []common.BaseItem) []string {
+	res := make([]string, 0, len(items))
+	for _, item := range items {
+		res = append(res, item.PluginID+"/"+item.ID)
+	}
+	return res
+}
+
+func (s *RegistrySuite) TestQueryMerges() {
+	t := s.T()
+
+	invalid := common.BaseItem{ID: "broken", Type: "Spreadsheet", Title: "broken"}
+	require.NoError(t, s.registry.Register(&fakeProvider{id: "apps", items: append(items("firefox", "gimp", "firefox"), invalid), delay: 10 * time.Millisecond}))
+	require.NoError(t, s.registry.Register(&fakeProvider{id: "files", items: items("firefox")}))
+	require.NoError(t, s.registry.Init(context.Background()))
+
+	res := s.registry.Query(context.Background(), "f")
+	require.Empty(t, res.Errors)
+	require.Equal(t, []string{"apps/firefox", "apps/gimp", "files/firefox"}, itemIDs(res.Items))
+}
+
+func (s *RegistrySuite) TestQueryTimeoutsAndErrors() {
+	t := s.T()
+
+	queryErr := errors.New("failed")
+	require.NoError(t, s.registry.Register(&fakeProvider{id: "slow", items: items("a"), delay: time.Second}))
+	require.NoError(t, s.registry.Register(fakeTimeoutProvider{
+		&fakeProvider{id: "web", items: items("b"), delay: 100 * time.Millisecond, timeout: time.Second},
+	}))
+	require.NoError(t, s.registry.Register(&fakeProvider{id: "broken", queryErr: queryErr}))
+	require.NoError(t, s.registry.Register(&fakeProvider{id: "panics", panics: true}))
+	require.NoError(t, s.registry.Register(&fakeProvider{id: "apps", items: items("c")}))
+
+	start := time.Now()
+	res := s.registry.Query(context.Background(), "q")
+	require.Less(t, time.Since(start), 500*time.Millisecond)
+
+	require.Equal(t, []string{"web/b", "apps/c"}, itemIDs(res.Items))
+	require.Len(t, res.Errors, 3)
+	require.ErrorIs(t, res.Errors["slow"], context.DeadlineExceeded)
+	require.ErrorIs(t, res.Errors["broken"], queryErr)
+	require.ErrorContains(t, res.Errors["panics"], "panicked")
+}
+
+func (s *RegistrySuite) TestQueryCancel() {
+	t := s.T()
+
+	require.NoError(t, s.registry.Register(fakeTimeoutProvider{
+		&fakeProvider{id: "slow", items: items("a"), delay: time.Second, timeout: time.Second},
+	}))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	res := s.registry.Query(ctx, "q")
+	require.Empty(t, res.Items)
+	require.ErrorIs(t, res.Errors["slow"], context.Canceled)
+}
+
+func (s *RegistrySuite) TestInitUnregistersFailed() {
+	t := s.T()
+
+	core, logs := observer.New(zap.WarnLevel)
+	s.registry = NewRegistry(50*time.Millisecond, zap.New(core))
+
+	apps := &fakeProvider{id: "apps"}
+	broken := &fakeProvider{id: "broken", initErr: errors.New("no dbus")}
+	leaky := &fakeProvider{id: "leaky", initErr: errors.New("no socket"), closeErr: errors.New("busy")}
+	require.NoError(t, s.registry.Register(apps))
+	require.NoError(t, s.registry.Register(broken))
+	require.NoError(t, s.registry.Register(leaky))
+	require.ErrorIs(t, s.registry.Register(&fakeProvider{id: "apps"}), ErrDuplicateProvider)
+
+	err := s.registry.Init(context.Background())
+	require.ErrorContains(t, err, "no dbus")
+	require.ErrorContains(t, err, "no socket")
+	require.NotContains(t, err.Error(), "busy")
+	_, ok := s.registry.Get("broken")
+	require.False(t, ok)
+	_, ok = s.registry.Get("apps")
+	require.True(t, ok)
+
+	// failed providers are closed, a close error is only logged
+	require.True(t, broken.closed.Load())
+	require.True(t, leaky.closed.Load())
+	require.False(t, apps.closed.Load())
+	closeLogs := logs.FilterMessage("Failed closing provider").All()
+	require.Len(t, closeLogs, 1)
+	require.Equal(t, "leaky", closeLogs[0].ContextMap()["provider"])
+}
+
+func (s *RegistrySuite) TestExecuteAndClose() {
+	t := s.T()
+	ctx := context.Background()
+
+	p := &fakeProvider{id: "apps"}
+	require.NoError(t, s.registry.Register(p))
+
+	action := common.ItemAction{Title: "Launch", Action: common.ActionTypeLaunch}
+	require.NoError(t, s.registry.Execute(ctx, "apps", "firefox", action))
+	require.Equal(t, "firefox:Launch", p.executed.Load())
+	require.ErrorIs(t, s.registry.Execute(ctx, "files", "firefox", action), ErrUnknownProvider)
+	require.ErrorIs(t, s.registry.Execute(ctx, "apps", "firefox", common.ItemAction{Action: common.ActionTypeOpenURL}), common.ErrMissingPayload)
+
+	require.NoError(t, s.registry.Close())
+	require.True(t, p.closed.Load())
+	_, ok := s.registry.Get("apps")
+	require.False(t, ok)
+}
+
+func TestRegistrySuite(t *testing.T) {
+	suite.Run(t, new(RegistrySuite))
+}
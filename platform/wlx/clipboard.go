@@ -0,0 +1,206 @@
+package wlx
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Runix-Org/runix/platform/wlx/wayland"
+	"github.com/Runix-Org/runix/platform/wlx/x11"
+	"go.uber.org/zap"
+)
+
+const (
+	MimeTypeText = "text/plain;charset=utf-8"
+
+	clipboardCommandTimeout = 5 * time.Second
+)
+
+var (
+	ErrClipboardUnavailable = errors.New("no clipboard backend available")
+	ErrEmptyMimeType        = errors.New("empty MIME type")
+)
+
+// Text targets of the X11 selection, Wayland clients still ask for them
+var textMimeTypes = []string{MimeTypeText, "text/plain", "UTF8_STRING", "STRING", "TEXT"}
+
+// clipboardOwner serves the copied data until another client sets the clipboard or Close is called
+type clipboardOwner interface {
+	Close()
+}
+
+type clipboardBackend struct {
+	name string
+	copy func(mimeTypes []string, data []byte) (clipboardOwner, error)
+}
+
+// Clipboard copies data to the clipboard of the session.
+// The data is served by this process, so it is lost on Close unless another client has copied it.
+type Clipboard struct {
+	mu       sync.Mutex
+	owner    clipboardOwner
+	backends []clipboardBackend
+	logger   *zap.Logger
+}
+
+func NewClipboard(logger *zap.Logger) *Clipboard {
+	logger = logger.With(zap.String("task", "Clipboard"))
+
+	return &Clipboard{
+		backends: clipboardBackends(GetSessionType(), logger),
+		logger:   logger,
+	}
+}
+
+// clipboardBackends returns the native backend of the session first, the commands are the fallback
+func clipboardBackends(sessionType SessionType, logger *zap.Logger) []clipboardBackend {
+	waylandBackend := clipboardBackend{
+		name: "data-control",
+		copy: func(mimeTypes []string, data []byte) (clipboardOwner, error) {
+			owner, err := wayland.Copy(mimeTypes, data, logger)
+			if err != nil {
+				return nil, err
+			}
+			return owner, nil
+		},
+	}
+	x11Backend := clipboardBackend{
+		name: "x11-selection",
+		copy: func(mimeTypes []string, data []byte) (clipboardOwner, error) {
+			owner, err := x11.Copy(mimeTypes, data, logger)
+			if err != nil {
+				return nil, err
+			}
+			return owner, nil
+		},
+	}
+
+	switch sessionType {
+	case SessionWayland:
+		return []clipboardBackend{waylandBackend, wlCopyBackend()}
+	case SessionX11:
+		return []clipboardBackend{x11Backend, xclipBackend()}
+	default:
+		return []clipboardBackend{wlCopyBackend(), xclipBackend()}
+	}
+}
+
+// Copy sets the clipboard to data of mimeType, text is offered with all the usual text types
+func (c *Clipboard) Copy(mimeType string, data []byte) error {
+	if mimeType == "" {
+		return ErrEmptyMimeType
+	}
+	mimeTypes := offeredMimeTypes(mimeType)
+	// the data is served after returning
+	data = bytes.Clone(data)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var errs []error
+	for _, backend := range c.backends {
+		owner, err := backend.copy(mimeTypes, data)
+		if err != nil {
+			c.logger.Debug("Clipboard backend failed", zap.String("backend", backend.name), zap.Error(err))
+			errs = append(errs, fmt.Errorf("%s: %w", backend.name, err))
+			continue
+		}
+
+		// the previous owner lost the clipboard to the new one
+		if c.owner != nil {
+			c.owner.Close()
+		}
+		c.owner = owner
+		return nil
+	}
+
+	return fmt.Errorf("%w: %w", ErrClipboardUnavailable, errors.Join(errs...))
+}
+
+func (c *Clipboard) CopyText(text string) error {
+	return c.Copy(MimeTypeText, []byte(text))
+}
+
+// Close stops serving the copied data
+func (c *Clipboard) Close() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.owner != nil {
+		c.owner.Close()
+		c.owner = nil
+	}
+}
+
+func isTextMimeType(mimeType string) bool {
+	for _, textType := range textMimeTypes {
+		if strings.EqualFold(mimeType, textType) {
+			return true
+		}
+	}
+	return false
+}
+
+// offeredMimeTypes returns mimeType first, followed by the other text types for text
+func offeredMimeTypes(mimeType string) []string {
+	res := []string{mimeType}
+	if !isTextMimeType(mimeType) {
+		return res
+	}
+	for _, textType := range textMimeTypes {
+		if !strings.EqualFold(mimeType, textType) {
+			res = append(res, textType)
+		}
+	}
+	return res
+}
+
+// The commands fork and serve the data in the background, the owner has nothing to close
+type commandOwner struct{}
+
+func (commandOwner) Close() {}
+
+func commandBackend(name string, args func(mimeType string) []string) clipboardBackend {
+	return clipboardBackend{
+		name: name,
+		copy: func(mimeTypes []string, data []byte) (clipboardOwner, error) {
+			path, err := exec.LookPath(name)
+			if err != nil {
+				return nil, err
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), clipboardCommandTimeout)
+			defer cancel()
+			// no output pipes, the forked process would keep them open and Run would wait for it
+			cmd := exec.CommandContext(ctx, path, args(mimeTypes[0])...)
+			cmd.Stdin = bytes.NewReader(data)
+			if err := cmd.Run(); err != nil {
+				return nil, fmt.Errorf("run %s: %w", name, err)
+			}
+
+			return commandOwner{}, nil
+		},
+	}
+}
+
+// wl-copy offers the other text types itself
+func wlCopyBackend() clipboardBackend {
+	return commandBackend("wl-copy", func(mimeType string) []string {
+		return []string{"--type", mimeType}
+	})
+}
+
+// xclip offers UTF8_STRING and the other text targets only without -target
+func xclipBackend() clipboardBackend {
+	return commandBackend("xclip", func(mimeType string) []string {
+		if isTextMimeType(mimeType) {
+			return []string{"-selection", "clipboard", "-in"}
+		}
+		return []string{"-selection", "clipboard", "-target", mimeType, "-in"}
+	})
+}
@@ -0,0 +1,106 @@
+package wlx
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gotest.tools/v3/fs"
+)
+
+// Records the arguments and stdin next to the script
+const fakeCommand = `#!/bin/sh
+echo "$@" > "$0.args"
+cat > "$0.stdin"
+`
+
+type ClipboardSuite struct {
+	suite.Suite
+	bin *fs.Dir
+}
+
+func (s *ClipboardSuite) SetupTest() {
+	s.bin = fs.NewDir(s.T(), "bin",
+		fs.WithFile("wl-copy", fakeCommand, fs.WithMode(0o755)),
+		fs.WithFile("xclip", fakeCommand, fs.WithMode(0o755)),
+	)
+	s.T().Setenv("PATH", s.bin.Path()+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func (s *ClipboardSuite) newClipboard(backends ...clipboardBackend) *Clipboard {
+	return &Clipboard{backends: backends, logger: zap.NewNop()}
+}
+
+func (s *ClipboardSuite) recorded(name string) (string, string) {
+	t := s.T()
+
+	args, err := os.ReadFile(s.bin.Join(name + ".args"))
+	require.NoError(t, err)
+	stdin, err := os.ReadFile(s.bin.Join(name + ".stdin"))
+	require.NoError(t, err)
+	return string(args), string(stdin)
+}
+
+func (s *ClipboardSuite) TestFallback() {
+	t := s.T()
+
+	var offered []string
+	failing := clipboardBackend{
+		name: "native",
+		copy: func(mimeTypes []string, data []byte) (clipboardOwner, error) {
+			offered = mimeTypes
+			return nil, errors.New("no compositor")
+		},
+	}
+	c := s.newClipboard(failing, wlCopyBackend())
+	defer c.Close()
+
+	require.NoError(t, c.CopyText("firefox %u"))
+	require.Equal(t, []string{MimeTypeText, "text/plain", "UTF8_STRING", "STRING", "TEXT"}, offered)
+	args, stdin := s.recorded("wl-copy")
+	require.Equal(t, "--type text/plain;charset=utf-8\n", args)
+	require.Equal(t, "firefox %u", stdin)
+}
+
+func (s *ClipboardSuite) TestXclipTargets() {
+	t := s.T()
+
+	c := s.newClipboard(xclipBackend())
+	defer c.Close()
+
+	require.NoError(t, c.Copy("text/plain", []byte("text")))
+	args, _ := s.recorded("xclip")
+	require.Equal(t, "-selection clipboard -in\n", args)
+
+	require.NoError(t, c.Copy("image/png", []byte("png")))
+	args, stdin := s.recorded("xclip")
+	require.Equal(t, "-selection clipboard -target image/png -in\n", args)
+	require.Equal(t, "png", stdin)
+}
+
+func (s *ClipboardSuite) TestUnavailable() {
+	t := s.T()
+
+	s.T().Setenv("PATH", s.bin.Join("missing"))
+	c := s.newClipboard(wlCopyBackend(), xclipBackend())
+
+	err := c.CopyText("text")
+	require.ErrorIs(t, err, ErrClipboardUnavailable)
+	require.ErrorContains(t, err, "wl-copy")
+	require.ErrorContains(t, err, "xclip")
+	require.ErrorIs(t, c.Copy("", nil), ErrEmptyMimeType)
+}
+
+func (s *ClipboardSuite) TestOfferedMimeTypes() {
+	t := s.T()
+
+	require.Equal(t, []string{"image/png"}, offeredMimeTypes("image/png"))
+	require.Equal(t, []string{"UTF8_STRING", MimeTypeText, "text/plain", "STRING", "TEXT"}, offeredMimeTypes("UTF8_STRING"))
+}
+
+func TestClipboard(t *testing.T) {
+	suite.Run(t, new(ClipboardSuite))
+}
@@ -0,0 +1,235 @@
+package wayland
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync/atomic"
+
+	"github.com/MatthiasKunnen/go-wayland/wayland/client"
+	"go.uber.org/zap"
+
+	ext_data_control "github.com/Runix-Org/runix/platform/wlx/wayland/protocols/ext-data-control-v1"
+	wlr_data_control "github.com/Runix-Org/runix/platform/wlx/wayland/protocols/wlr-data-control-unstable-v1"
+)
+
+var (
+	ErrNotConnected              = errors.New("failed to connect to Wayland")
+	ErrNoSeat                    = errors.New("no wl_seat found")
+	ErrDataControlNotImplemented = errors.New("compositor implements neither ext-data-control-v1 nor wlr-data-control-unstable-v1")
+)
+
+// ClipboardOwner serves the copied data to other clients.
+// It runs until another client sets the clipboard or Close is called.
+type ClipboardOwner struct {
+	wc        *WaylandClient
+	data      []byte
+	cancelled bool
+	closed    atomic.Bool
+	done      chan struct{}
+	logger    *zap.Logger
+}
+
+// Copy sets the clipboard with ext-data-control-v1, or wlr-data-control-unstable-v1 on older compositors.
+// The data-control protocols don't need a focused surface, so it works for a hidden window too.
+func Copy(mimeTypes []string, data []byte, logger *zap.Logger) (*ClipboardOwner, error) {
+	logger = logger.With(zap.String("task", "WaylandClipboard"))
+	wc := NewWaylandClient(logger)
+	if !wc.Connect() {
+		return nil, ErrNotConnected
+	}
+
+	var (
+		seat   *client.Seat
+		extMgr *ext_data_control.Manager
+		wlrMgr *wlr_data_control.Manager
+	)
+	wc.registry.SetGlobalHandler(func(e client.RegistryGlobalEvent) {
+		var proxy client.Proxy
+		switch {
+		case e.Interface == client.SeatInterfaceName && seat == nil:
+			seat = client.NewSeat(wc.context)
+			proxy = seat
+		case e.Interface == ext_data_control.ManagerInterfaceName:
+			extMgr = ext_data_control.NewManager(wc.context)
+			proxy = extMgr
+		case e.Interface == wlr_data_control.ManagerInterfaceName:
+			wlrMgr = wlr_data_control.NewManager(wc.context)
+			proxy = wlrMgr
+		default:
+			return
+		}
+		// version 1 has everything to set the clipboard
+		if err := wc.registry.Bind(e.Name, e.Interface, 1, proxy); err != nil {
+			logger.Info("Failed to bind interface", zap.String("interface", e.Interface), zap.Error(err))
+		}
+	})
+
+	if err := wc.roundtrip(); err != nil {
+		wc.Close()
+		return nil, fmt.Errorf("roundtrip: %w", err)
+	}
+
+	o := &ClipboardOwner{
+		wc:     wc,
+		data:   data,
+		done:   make(chan struct{}),
+		logger: logger,
+	}
+
+	var err error
+	switch {
+	case seat == nil:
+		err = ErrNoSeat
+	case extMgr != nil:
+		err = o.setExtSelection(extMgr, seat, mimeTypes)
+	case wlrMgr != nil:
+		err = o.setWlrSelection(wlrMgr, seat, mimeTypes)
+	default:
+		err = ErrDataControlNotImplemented
+	}
+	if err == nil {
+		// protocol errors close the connection, so the roundtrip fails
+		err = wc.roundtrip()
+	}
+	if err != nil {
+		wc.Close()
+		return nil, err
+	}
+
+	go o.serve()
+
+	return o, nil
+}
+
+func (o *ClipboardOwner) setExtSelection(manager *ext_data_control.Manager, seat *client.Seat, mimeTypes []string) error {
+	source, err := manager.CreateDataSource()
+	if err != nil {
+		return fmt.Errorf("create data source: %w", err)
+	}
+	source.SetSendHandler(func(e ext_data_control.SourceSendEvent) {
+		o.send(e.MimeType, e.Fd)
+	})
+	source.SetCancelledHandler(func(ext_data_control.SourceCancelledEvent) {
+		o.cancelled = true
+	})
+	for _, mimeType := range mimeTypes {
+		if err := source.Offer(mimeType); err != nil {
+			return fmt.Errorf("offer %s: %w", mimeType, err)
+		}
+	}
+
+	device, err := manager.GetDataDevice(seat)
+	if err != nil {
+		return fmt.Errorf("get data device: %w", err)
+	}
+	// offers of the current selections, nil for an empty one, they are not read
+	device.SetSelectionHandler(func(e ext_data_control.DeviceSelectionEvent) {
+		if e.Id != nil {
+			_ = e.Id.Destroy()
+		}
+	})
+	device.SetPrimarySelectionHandler(func(e ext_data_control.DevicePrimarySelectionEvent) {
+		if e.Id != nil {
+			_ = e.Id.Destroy()
+		}
+	})
+	device.SetFinishedHandler(func(ext_data_control.DeviceFinishedEvent) {
+		o.cancelled = true
+	})
+
+	if err := device.SetSelection(source); err != nil {
+		return fmt.Errorf("set selection: %w", err)
+	}
+
+	return nil
+}
+
+func (o *ClipboardOwner) setWlrSelection(manager *wlr_data_control.Manager, seat *client.Seat, mimeTypes []string) error {
+	source, err := manager.CreateDataSource()
+	if err != nil {
+		return fmt.Errorf("create data source: %w", err)
+	}
+	source.SetSendHandler(func(e wlr_data_control.SourceSendEvent) {
+		o.send(e.MimeType, e.Fd)
+	})
+	source.SetCancelledHandler(func(wlr_data_control.SourceCancelledEvent) {
+		o.cancelled = true
+	})
+	for _, mimeType := range mimeTypes {
+		if err := source.Offer(mimeType); err != nil {
+			return fmt.Errorf("offer %s: %w", mimeType, err)
+		}
+	}
+
+	device, err := manager.GetDataDevice(seat)
+	if err != nil {
+		return fmt.Errorf("get data device: %w", err)
+	}
+	device.SetSelectionHandler(func(e wlr_data_control.DeviceSelectionEvent) {
+		if e.Id != nil {
+			_ = e.Id.Destroy()
+		}
+	})
+	device.SetPrimarySelectionHandler(func(e wlr_data_control.DevicePrimarySelectionEvent) {
+		if e.Id != nil {
+			_ = e.Id.Destroy()
+		}
+	})
+	device.SetFinishedHandler(func(wlr_data_control.DeviceFinishedEvent) {
+		o.cancelled = true
+	})
+
+	if err := device.SetSelection(source); err != nil {
+		return fmt.Errorf("set selection: %w", err)
+	}
+
+	return nil
+}
+
+// send writes the data without blocking the dispatch loop on a slow reader
+func (o *ClipboardOwner) send(mimeType string, fd int) {
+	go func() {
+		f := os.NewFile(uintptr(fd), "clipboard")
+		defer f.Close()
+
+		// the reader may close the pipe before reading everything
+		if _, err := f.Write(o.data); err != nil {
+			o.logger.Debug("Failed sending clipboard data", zap.String("mimeType", mimeType), zap.Error(err))
+		}
+	}()
+}
+
+func (o *ClipboardOwner) serve() {
+	defer close(o.done)
+
+	for !o.cancelled {
+		if err := o.wc.dispatch(); err != nil {
+			if !o.closed.Load() {
+				o.logger.Info("Clipboard connection lost", zap.Error(err))
+			}
+			break
+		}
+	}
+
+	// otherwise Close has closed the connection already
+	if o.closed.CompareAndSwap(false, true) {
+		o.wc.Close()
+	}
+}
+
+// Done is closed when the data is not served anymore
+func (o *ClipboardOwner) Done() <-chan struct{} {
+	return o.done
+}
+
+// Close stops serving the data, the clipboard is cleared if it still holds it
+func (o *ClipboardOwner) Close() {
+	if o.closed.CompareAndSwap(false, true) {
+		// unblocks the dispatch of serve
+		if err := o.wc.context.Close(); err != nil {
+			o.logger.Info("Failed closing Wayland context", zap.Error(err))
+		}
+	}
+	<-o.done
+}
@@ -0,0 +1,639 @@
+// Bindings for the ext-data-control-v1 protocol in the style of go-wayland-scanner,
+// go-wayland does not ship them.
+// XML file : https://gitlab.freedesktop.org/wayland/wayland-protocols/-/raw/1.45/staging/ext-data-control/ext-data-control-v1.xml?ref_type=tags
+//
+// Unlike the generated code, events carrying objects created by the compositor
+// (data_offer, selection and primary_selection) never panic: the offers are not
+// registered in the client.Context, they only get a proxy that can be destroyed.
+//
+// ext_data_control_v1 Protocol Copyright:
+//
+// Copyright © 2018 Simon Ser
+// Copyright © 2019 Ivan Molodetskikh
+// Copyright © 2024 Neal Gompa
+//
+// Permission to use, copy, modify, distribute, and sell this
+// software and its documentation for any purpose is hereby granted
+// without fee, provided that the above copyright notice appear in
+// all copies and that both that copyright notice and this permission
+// notice appear in supporting documentation, and that the name of
+// the copyright holders not be used in advertising or publicity
+// pertaining to distribution of the software without specific,
+// written prior permission.  The copyright holders make no
+// representations about the suitability of this software for any
+// purpose.  It is provided "as is" without express or implied
+// warranty.
+//
+// THE COPYRIGHT HOLDERS DISCLAIM ALL WARRANTIES WITH REGARD TO THIS
+// SOFTWARE, INCLUDING ALL IMPLIED WARRANTIES OF MERCHANTABILITY AND
+// FITNESS, IN NO EVENT SHALL THE COPYRIGHT HOLDERS BE LIABLE FOR ANY
+// SPECIAL, INDIRECT OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+// WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN
+// AN ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION,
+// ARISING OUT OF OR IN CONNECTION WITH THE USE OR PERFORMANCE OF
+// THIS SOFTWARE.
+
+package ext_data_control
+
+import (
+	"github.com/MatthiasKunnen/go-wayland/wayland/client"
+	"golang.org/x/sys/unix"
+)
+
+// ManagerInterfaceName is the name of the interface as it appears in the [client.Registry].
+// It can be used to match the [client.RegistryGlobalEvent.Interface] in the
+// [Registry.SetGlobalHandler] and can be used in [Registry.Bind] if this applies.
+const ManagerInterfaceName = "ext_data_control_manager_v1"
+
+// Manager : manager to control data devices
+//
+// This interface is a manager that allows creating per-seat data device
+// controls.
+type Manager struct {
+	client.BaseProxy
+}
+
+// NewManager : manager to control data devices
+//
+// This interface is a manager that allows creating per-seat data device
+// controls.
+func NewManager(ctx *client.Context) *Manager {
+	extDataControlManagerV1 := &Manager{}
+	ctx.Register(extDataControlManagerV1)
+	return extDataControlManagerV1
+}
+
+// CreateDataSource : create a new data source
+//
+// Create a new data source.
+func (i *Manager) CreateDataSource() (*Source, error) {
+	id := NewSource(i.Context())
+	const opcode = 0
+	const _reqBufLen = 8 + 4
+	var _reqBuf [_reqBufLen]byte
+	l := 0
+	client.PutUint32(_reqBuf[l:4], i.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], uint32(_reqBufLen<<16|opcode&0x0000ffff))
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], id.ID())
+	l += 4
+	err := i.Context().WriteMsg(_reqBuf[:], nil)
+	return id, err
+}
+
+// GetDataDevice : get a data device for a seat
+//
+// Create a data device that can be used to manage a seat's selection.
+func (i *Manager) GetDataDevice(seat *client.Seat) (*Device, error) {
+	id := NewDevice(i.Context())
+	const opcode = 1
+	const _reqBufLen = 8 + 4 + 4
+	var _reqBuf [_reqBufLen]byte
+	l := 0
+	client.PutUint32(_reqBuf[l:4], i.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], uint32(_reqBufLen<<16|opcode&0x0000ffff))
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], id.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], seat.ID())
+	l += 4
+	err := i.Context().WriteMsg(_reqBuf[:], nil)
+	return id, err
+}
+
+// Destroy : destroy the manager
+//
+// All objects created by the manager will still remain valid, until their
+// appropriate destroy request has been called.
+func (i *Manager) Destroy() error {
+	defer i.Context().Unregister(i)
+	const opcode = 2
+	const _reqBufLen = 8
+	var _reqBuf [_reqBufLen]byte
+	l := 0
+	client.PutUint32(_reqBuf[l:4], i.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], uint32(_reqBufLen<<16|opcode&0x0000ffff))
+	l += 4
+	err := i.Context().WriteMsg(_reqBuf[:], nil)
+	return err
+}
+
+// DeviceInterfaceName is the name of the interface as it appears in the [client.Registry].
+// It can be used to match the [client.RegistryGlobalEvent.Interface] in the
+// [Registry.SetGlobalHandler] and can be used in [Registry.Bind] if this applies.
+const DeviceInterfaceName = "ext_data_control_device_v1"
+
+// Device : manage a data device for a seat
+//
+// This interface allows a client to manage a seat's selection.
+//
+// When the seat is destroyed, this object becomes inert.
+type Device struct {
+	client.BaseProxy
+	dataOfferHandler        DeviceDataOfferHandlerFunc
+	selectionHandler        DeviceSelectionHandlerFunc
+	finishedHandler         DeviceFinishedHandlerFunc
+	primarySelectionHandler DevicePrimarySelectionHandlerFunc
+}
+
+// NewDevice : manage a data device for a seat
+//
+// This interface allows a client to manage a seat's selection.
+//
+// When the seat is destroyed, this object becomes inert.
+func NewDevice(ctx *client.Context) *Device {
+	extDataControlDeviceV1 := &Device{}
+	ctx.Register(extDataControlDeviceV1)
+	return extDataControlDeviceV1
+}
+
+// SetSelection : copy data to the selection
+//
+// This request asks the compositor to set the selection to the data from
+// the source on behalf of the client.
+//
+// The given source may not be used in any further set_selection or
+// set_primary_selection requests. Attempting to use a previously used
+// source triggers the used_source protocol error.
+//
+// To unset the selection, set the source to NULL.
+func (i *Device) SetSelection(source *Source) error {
+	const opcode = 0
+	const _reqBufLen = 8 + 4
+	var _reqBuf [_reqBufLen]byte
+	l := 0
+	client.PutUint32(_reqBuf[l:4], i.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], uint32(_reqBufLen<<16|opcode&0x0000ffff))
+	l += 4
+	if source == nil {
+		client.PutUint32(_reqBuf[l:l+4], 0)
+		l += 4
+	} else {
+		client.PutUint32(_reqBuf[l:l+4], source.ID())
+		l += 4
+	}
+	err := i.Context().WriteMsg(_reqBuf[:], nil)
+	return err
+}
+
+// Destroy : destroy this data device
+//
+// Destroys the data device object.
+func (i *Device) Destroy() error {
+	defer i.Context().Unregister(i)
+	const opcode = 1
+	const _reqBufLen = 8
+	var _reqBuf [_reqBufLen]byte
+	l := 0
+	client.PutUint32(_reqBuf[l:4], i.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], uint32(_reqBufLen<<16|opcode&0x0000ffff))
+	l += 4
+	err := i.Context().WriteMsg(_reqBuf[:], nil)
+	return err
+}
+
+// SetPrimarySelection : copy data to the primary selection
+//
+// This request asks the compositor to set the primary selection to the
+// data from the source on behalf of the client.
+//
+// The given source may not be used in any further set_selection or
+// set_primary_selection requests. Attempting to use a previously used
+// source triggers the used_source protocol error.
+//
+// To unset the primary selection, set the source to NULL.
+//
+// The compositor will ignore this request if it does not support primary
+// selection.
+func (i *Device) SetPrimarySelection(source *Source) error {
+	const opcode = 2
+	const _reqBufLen = 8 + 4
+	var _reqBuf [_reqBufLen]byte
+	l := 0
+	client.PutUint32(_reqBuf[l:4], i.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], uint32(_reqBufLen<<16|opcode&0x0000ffff))
+	l += 4
+	if source == nil {
+		client.PutUint32(_reqBuf[l:l+4], 0)
+		l += 4
+	} else {
+		client.PutUint32(_reqBuf[l:l+4], source.ID())
+		l += 4
+	}
+	err := i.Context().WriteMsg(_reqBuf[:], nil)
+	return err
+}
+
+type DeviceError uint32
+
+// DeviceError :
+const (
+	// DeviceErrorUsedSource : source given to set_selection or set_primary_selection was already used before
+	DeviceErrorUsedSource DeviceError = 1
+)
+
+func (e DeviceError) Name() string {
+	switch e {
+	case DeviceErrorUsedSource:
+		return "used_source"
+	default:
+		return ""
+	}
+}
+
+func (e DeviceError) Value() string {
+	switch e {
+	case DeviceErrorUsedSource:
+		return "1"
+	default:
+		return ""
+	}
+}
+
+func (e DeviceError) String() string {
+	return e.Name() + "=" + e.Value()
+}
+
+// DeviceDataOfferEvent : introduce a new ext_data_control_offer
+//
+// The data_offer event introduces a new ext_data_control_offer object,
+// which will subsequently be used in either the
+// ext_data_control_device.selection event (for the regular clipboard
+// selections) or the ext_data_control_device.primary_selection event (for
+// the primary clipboard selections). Immediately following the
+// ext_data_control_device.data_offer event, the new data_offer object
+// will send out ext_data_control_offer.offer events to describe the MIME
+// types it offers.
+type DeviceDataOfferEvent struct {
+	Id *Offer
+}
+type DeviceDataOfferHandlerFunc func(DeviceDataOfferEvent)
+
+// SetDataOfferHandler : sets handler for DeviceDataOfferEvent
+func (i *Device) SetDataOfferHandler(f DeviceDataOfferHandlerFunc) {
+	i.dataOfferHandler = f
+}
+
+// DeviceSelectionEvent : advertise new selection
+//
+// The selection event is sent out to notify the client of a new
+// ext_data_control_offer for the selection for this device. The
+// ext_data_control_device.data_offer and the ext_data_control_offer.offer
+// events are sent out immediately before this event to introduce the data
+// offer object. The selection event is sent to a client when a new
+// selection is set. The ext_data_control_offer is valid until a new
+// ext_data_control_offer or NULL is received. The client must destroy the
+// previous selection ext_data_control_offer, if any, upon receiving this
+// event. Regardless, the previous selection will be ignored once a new
+// selection ext_data_control_offer is received.
+type DeviceSelectionEvent struct {
+	Id *Offer
+}
+type DeviceSelectionHandlerFunc func(DeviceSelectionEvent)
+
+// SetSelectionHandler : sets handler for DeviceSelectionEvent
+func (i *Device) SetSelectionHandler(f DeviceSelectionHandlerFunc) {
+	i.selectionHandler = f
+}
+
+// DeviceFinishedEvent : this data control is no longer valid
+//
+// This data control object is no longer valid and should be destroyed by
+// the client.
+type DeviceFinishedEvent struct{}
+type DeviceFinishedHandlerFunc func(DeviceFinishedEvent)
+
+// SetFinishedHandler : sets handler for DeviceFinishedEvent
+func (i *Device) SetFinishedHandler(f DeviceFinishedHandlerFunc) {
+	i.finishedHandler = f
+}
+
+// DevicePrimarySelectionEvent : advertise new primary selection
+//
+// The primary_selection event is sent out to notify the client of a new
+// ext_data_control_offer for the primary selection for this device.
+type DevicePrimarySelectionEvent struct {
+	Id *Offer
+}
+type DevicePrimarySelectionHandlerFunc func(DevicePrimarySelectionEvent)
+
+// SetPrimarySelectionHandler : sets handler for DevicePrimarySelectionEvent
+func (i *Device) SetPrimarySelectionHandler(f DevicePrimarySelectionHandlerFunc) {
+	i.primarySelectionHandler = f
+}
+
+func (i *Device) Dispatch(opcode uint32, fd int, data []byte) {
+	switch opcode {
+	case 0:
+		if i.dataOfferHandler == nil {
+			return
+		}
+		var e DeviceDataOfferEvent
+		l := 0
+		e.Id = newServerOffer(i.Context(), client.Uint32(data[l:l+4]))
+		l += 4
+
+		i.dataOfferHandler(e)
+	case 1:
+		if i.selectionHandler == nil {
+			return
+		}
+		var e DeviceSelectionEvent
+		l := 0
+		e.Id = newServerOffer(i.Context(), client.Uint32(data[l:l+4]))
+		l += 4
+
+		i.selectionHandler(e)
+	case 2:
+		if i.finishedHandler == nil {
+			return
+		}
+		var e DeviceFinishedEvent
+
+		i.finishedHandler(e)
+	case 3:
+		if i.primarySelectionHandler == nil {
+			return
+		}
+		var e DevicePrimarySelectionEvent
+		l := 0
+		e.Id = newServerOffer(i.Context(), client.Uint32(data[l:l+4]))
+		l += 4
+
+		i.primarySelectionHandler(e)
+	}
+}
+
+// SourceInterfaceName is the name of the interface as it appears in the [client.Registry].
+// It can be used to match the [client.RegistryGlobalEvent.Interface] in the
+// [Registry.SetGlobalHandler] and can be used in [Registry.Bind] if this applies.
+const SourceInterfaceName = "ext_data_control_source_v1"
+
+// Source : offer to transfer data
+//
+// The ext_data_control_source object is the source side of a
+// ext_data_control_offer. It is created by the source client in a data
+// transfer and provides a way to describe the offered data and a way to
+// respond to requests to transfer the data.
+type Source struct {
+	client.BaseProxy
+	sendHandler      SourceSendHandlerFunc
+	cancelledHandler SourceCancelledHandlerFunc
+}
+
+// NewSource : offer to transfer data
+//
+// The ext_data_control_source object is the source side of a
+// ext_data_control_offer. It is created by the source client in a data
+// transfer and provides a way to describe the offered data and a way to
+// respond to requests to transfer the data.
+func NewSource(ctx *client.Context) *Source {
+	extDataControlSourceV1 := &Source{}
+	ctx.Register(extDataControlSourceV1)
+	return extDataControlSourceV1
+}
+
+// Offer : add an offered MIME type
+//
+// This request adds a MIME type to the set of MIME types advertised to
+// targets. Can be called several times to offer multiple types.
+//
+// Calling this after ext_data_control_device.set_selection is a protocol
+// error.
+//
+//	mimeType: MIME type offered by the data source
+func (i *Source) Offer(mimeType string) error {
+	const opcode = 0
+	mimeTypeLen := client.PaddedLen(len(mimeType) + 1)
+	_reqBufLen := 8 + (4 + mimeTypeLen)
+	_reqBuf := make([]byte, _reqBufLen)
+	l := 0
+	client.PutUint32(_reqBuf[l:4], i.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], uint32(_reqBufLen<<16|opcode&0x0000ffff))
+	l += 4
+	client.PutString(_reqBuf[l:l+(4+mimeTypeLen)], mimeType)
+	l += (4 + mimeTypeLen)
+	err := i.Context().WriteMsg(_reqBuf, nil)
+	return err
+}
+
+// Destroy : destroy this source
+//
+// Destroys the data source object.
+func (i *Source) Destroy() error {
+	defer i.Context().Unregister(i)
+	const opcode = 1
+	const _reqBufLen = 8
+	var _reqBuf [_reqBufLen]byte
+	l := 0
+	client.PutUint32(_reqBuf[l:4], i.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], uint32(_reqBufLen<<16|opcode&0x0000ffff))
+	l += 4
+	err := i.Context().WriteMsg(_reqBuf[:], nil)
+	return err
+}
+
+type SourceError uint32
+
+// SourceError :
+const (
+	// SourceErrorInvalidOffer : offer sent after ext_data_control_device.set_selection
+	SourceErrorInvalidOffer SourceError = 1
+)
+
+func (e SourceError) Name() string {
+	switch e {
+	case SourceErrorInvalidOffer:
+		return "invalid_offer"
+	default:
+		return ""
+	}
+}
+
+func (e SourceError) Value() string {
+	switch e {
+	case SourceErrorInvalidOffer:
+		return "1"
+	default:
+		return ""
+	}
+}
+
+func (e SourceError) String() string {
+	return e.Name() + "=" + e.Value()
+}
+
+// SourceSendEvent : send the data
+//
+// Request for data from the client. Send the data as the specified MIME
+// type over the passed file descriptor, then close it.
+type SourceSendEvent struct {
+	MimeType string
+	Fd       int
+}
+type SourceSendHandlerFunc func(SourceSendEvent)
+
+// SetSendHandler : sets handler for SourceSendEvent
+func (i *Source) SetSendHandler(f SourceSendHandlerFunc) {
+	i.sendHandler = f
+}
+
+// SourceCancelledEvent : selection was cancelled
+//
+// This data source is no longer valid. The data source has been replaced
+// by another data source.
+//
+// The client should clean up and destroy this data source.
+type SourceCancelledEvent struct{}
+type SourceCancelledHandlerFunc func(SourceCancelledEvent)
+
+// SetCancelledHandler : sets handler for SourceCancelledEvent
+func (i *Source) SetCancelledHandler(f SourceCancelledHandlerFunc) {
+	i.cancelledHandler = f
+}
+
+func (i *Source) Dispatch(opcode uint32, fd int, data []byte) {
+	switch opcode {
+	case 0:
+		if i.sendHandler == nil {
+			if fd != -1 {
+				unix.Close(fd)
+			}
+			return
+		}
+		var e SourceSendEvent
+		l := 0
+		mimeTypeLen := client.PaddedLen(int(client.Uint32(data[l : l+4])))
+		l += 4
+		e.MimeType = client.String(data[l : l+mimeTypeLen])
+		l += mimeTypeLen
+		e.Fd = fd
+
+		i.sendHandler(e)
+	case 1:
+		if i.cancelledHandler == nil {
+			return
+		}
+		var e SourceCancelledEvent
+
+		i.cancelledHandler(e)
+	}
+}
+
+// OfferInterfaceName is the name of the interface as it appears in the [client.Registry].
+// It can be used to match the [client.RegistryGlobalEvent.Interface] in the
+// [Registry.SetGlobalHandler] and can be used in [Registry.Bind] if this applies.
+const OfferInterfaceName = "ext_data_control_offer_v1"
+
+// Offer : offer to transfer data
+//
+// A ext_data_control_offer represents a piece of data offered for transfer
+// by another client (the source client). The offer describes the different
+// MIME types that the data can be converted to and provides the mechanism
+// for transferring the data directly from the source client.
+type Offer struct {
+	client.BaseProxy
+	offerHandler OfferOfferHandlerFunc
+}
+
+// newServerOffer returns the offer with the id allocated by the compositor, nil for a NULL object
+func newServerOffer(ctx *client.Context, id uint32) *Offer {
+	if id == 0 {
+		return nil
+	}
+	if offer, ok := ctx.GetProxy(id).(*Offer); ok {
+		return offer
+	}
+	offer := &Offer{}
+	offer.SetID(id)
+	offer.SetContext(ctx)
+	return offer
+}
+
+// Receive : request that the data is transferred
+//
+// To transfer the offered data, the client issues this request and
+// indicates the MIME type it wants to receive. The transfer happens
+// through the passed file descriptor (typically created with the pipe
+// system call). The source client writes the data in the MIME type
+// representation requested and then closes the file descriptor.
+//
+// The receiving client reads from the read end of the pipe until EOF and
+// then closes its end, at which point the transfer is complete.
+//
+// This request may happen multiple times for different MIME types.
+//
+//	mimeType: MIME type desired by receiver
+//	fd: file descriptor for data transfer
+func (i *Offer) Receive(mimeType string, fd int) error {
+	const opcode = 0
+	mimeTypeLen := client.PaddedLen(len(mimeType) + 1)
+	_reqBufLen := 8 + (4 + mimeTypeLen)
+	_reqBuf := make([]byte, _reqBufLen)
+	l := 0
+	client.PutUint32(_reqBuf[l:4], i.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], uint32(_reqBufLen<<16|opcode&0x0000ffff))
+	l += 4
+	client.PutString(_reqBuf[l:l+(4+mimeTypeLen)], mimeType)
+	l += (4 + mimeTypeLen)
+	oob := unix.UnixRights(int(fd))
+	err := i.Context().WriteMsg(_reqBuf, oob)
+	return err
+}
+
+// Destroy : destroy this offer
+//
+// Destroys the data offer object.
+func (i *Offer) Destroy() error {
+	defer i.Context().Unregister(i)
+	const opcode = 1
+	const _reqBufLen = 8
+	var _reqBuf [_reqBufLen]byte
+	l := 0
+	client.PutUint32(_reqBuf[l:4], i.ID())
+	l += 4
+	client.PutUint32(_reqBuf[l:l+4], uint32(_reqBufLen<<16|opcode&0x0000ffff))
+	l += 4
+	err := i.Context().WriteMsg(_reqBuf[:], nil)
+	return err
+}
+
+// OfferOfferEvent : advertise offered MIME type
+//
+// Sent immediately after creating the ext_data_control_offer object.
+// One event per offered MIME type.
+type OfferOfferEvent struct {
+	MimeType string
+}
+type OfferOfferHandlerFunc func(OfferOfferEvent)
+
+// SetOfferHandler : sets handler for OfferOfferEvent
+func (i *Offer) SetOfferHandler(f OfferOfferHandlerFunc) {
+	i.offerHandler = f
+}
+
+func (i *Offer) Dispatch(opcode uint32, fd int, data []byte) {
+	switch opcode {
+	case 0:
+		if i.offerHandler == nil {
+			return
+		}
+		var e OfferOfferEvent
+		l := 0
+		mimeTypeLen := client.PaddedLen(int(client.Uint32(data[l : l+4])))
+		l += 4
+		e.MimeType = client.String(data[l : l+mimeTypeLen])
+		l += mimeTypeLen
+
+		i.offerHandler(e)
+	}
+}
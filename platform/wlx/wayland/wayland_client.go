@@ -1,6 +1,9 @@
 package wayland
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/MatthiasKunnen/go-wayland/wayland/client"
 	"go.uber.org/zap"
 )
@@ -52,6 +55,38 @@ func (w *WaylandClient) Roundtrip() bool {
 	return true
 }
 
+// dispatch processes one incoming message, it blocks until there is one.
+// Events of objects the client doesn't track, e.g. data offers created by the compositor, are skipped.
+func (w *WaylandClient) dispatch() error {
+	err := w.context.Dispatch()
+	if errors.Is(err, client.ErrDispatchSenderNotFound) {
+		return nil
+	}
+
+	return err
+}
+
+// roundtrip is Roundtrip that skips events of untracked objects instead of failing
+func (w *WaylandClient) roundtrip() error {
+	callback, err := w.display.Sync()
+	if err != nil {
+		return fmt.Errorf("get sync callback: %w", err)
+	}
+	defer callback.Destroy()
+
+	done := false
+	callback.SetDoneHandler(func(_ client.CallbackDoneEvent) {
+		done = true
+	})
+	for !done {
+		if err := w.dispatch(); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 func (w *WaylandClient) handleDisplayError(e client.DisplayErrorEvent) {
 	w.logger.Info("Wayland display error", zap.Uint32("code", e.Code), zap.String("error", e.Message))
 }
@@ -0,0 +1,209 @@
+package x11
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/jezek/xgb"
+	"github.com/jezek/xgb/xproto"
+	"go.uber.org/zap"
+)
+
+var ErrSelectionNotOwned = errors.New("failed to own the CLIPBOARD selection")
+
+// ClipboardOwner owns the CLIPBOARD selection and answers the conversion requests of other clients.
+// It runs until another client takes the selection or Close is called.
+type ClipboardOwner struct {
+	conn    *xgb.Conn
+	window  xproto.Window
+	targets xproto.Atom
+	// Offered MIME types in order, the first is the preferred one
+	mimeTypes []xproto.Atom
+	data      []byte
+	// Data larger than this would need the INCR protocol, which is not implemented
+	maxData int
+	closed  atomic.Bool
+	done    chan struct{}
+	logger  *zap.Logger
+}
+
+// Copy owns the CLIPBOARD selection with an unmapped window of a new connection
+func Copy(mimeTypes []string, data []byte, logger *zap.Logger) (*ClipboardOwner, error) {
+	logger = logger.With(zap.String("task", "X11Clipboard"))
+	conn, err := xgb.NewConn()
+	if err != nil {
+		return nil, fmt.Errorf("connect to X11: %w", err)
+	}
+
+	o, err := newClipboardOwner(conn, mimeTypes, data, logger)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go o.serve()
+
+	return o, nil
+}
+
+func newClipboardOwner(conn *xgb.Conn, mimeTypes []string, data []byte, logger *zap.Logger) (*ClipboardOwner, error) {
+	setup := xproto.Setup(conn)
+	screen := setup.DefaultScreen(conn)
+
+	window, err := xproto.NewWindowId(conn)
+	if err != nil {
+		return nil, fmt.Errorf("new window id: %w", err)
+	}
+	err = xproto.CreateWindowChecked(conn, 0, window, screen.Root, 0, 0, 1, 1, 0,
+		xproto.WindowClassInputOnly, 0, 0, nil).Check()
+	if err != nil {
+		return nil, fmt.Errorf("create window: %w", err)
+	}
+
+	clipboard, err := internAtom(conn, "CLIPBOARD")
+	if err != nil {
+		return nil, err
+	}
+	o := &ClipboardOwner{
+		conn:      conn,
+		window:    window,
+		mimeTypes: make([]xproto.Atom, 0, len(mimeTypes)),
+		data:      data,
+		// the ChangeProperty request has a 24 bytes header, the length is in 4 bytes units
+		maxData: int(setup.MaximumRequestLength)*4 - 24,
+		done:    make(chan struct{}),
+		logger:  logger,
+	}
+	if o.targets, err = internAtom(conn, "TARGETS"); err != nil {
+		return nil, err
+	}
+	for _, mimeType := range mimeTypes {
+		a, err := internAtom(conn, mimeType)
+		if err != nil {
+			return nil, err
+		}
+		o.mimeTypes = append(o.mimeTypes, a)
+	}
+
+	err = xproto.SetSelectionOwnerChecked(conn, window, clipboard, xproto.TimeCurrentTime).Check()
+	if err != nil {
+		return nil, fmt.Errorf("set selection owner: %w", err)
+	}
+	// the server silently ignores the request when it loses a race with another client
+	owner, err := xproto.GetSelectionOwner(conn, clipboard).Reply()
+	if err != nil {
+		return nil, fmt.Errorf("get selection owner: %w", err)
+	}
+	if owner.Owner != window {
+		return nil, ErrSelectionNotOwned
+	}
+
+	return o, nil
+}
+
+func internAtom(conn *xgb.Conn, name string) (xproto.Atom, error) {
+	reply, err := xproto.InternAtom(conn, false, uint16(len(name)), name).Reply()
+	if err != nil {
+		return xproto.AtomNone, fmt.Errorf("intern atom %s: %w", name, err)
+	}
+
+	return reply.Atom, nil
+}
+
+func (o *ClipboardOwner) serve() {
+	defer close(o.done)
+
+loop:
+	for {
+		ev, xerr := o.conn.WaitForEvent()
+		if ev == nil && xerr == nil {
+			if !o.closed.Load() {
+				o.logger.Info("X11 connection lost")
+			}
+			break loop
+		}
+		if xerr != nil {
+			// errors of requests to requestors, e.g. a destroyed window
+			o.logger.Debug("X11 error", zap.String("error", xerr.Error()))
+			continue
+		}
+
+		switch e := ev.(type) {
+		case xproto.SelectionRequestEvent:
+			o.answer(e)
+		case xproto.SelectionClearEvent:
+			// another client owns the clipboard now
+			break loop
+		}
+	}
+
+	if o.closed.CompareAndSwap(false, true) {
+		o.conn.Close()
+	}
+}
+
+// answer converts the selection to the requested target and notifies the requestor
+func (o *ClipboardOwner) answer(e xproto.SelectionRequestEvent) {
+	property := e.Property
+	// obsolete clients, ICCCM 2.2
+	if property == xproto.AtomNone {
+		property = e.Target
+	}
+
+	typ, format, data, ok := o.convert(e.Target)
+	if ok {
+		xproto.ChangeProperty(o.conn, xproto.PropModeReplace, e.Requestor, property, typ, format,
+			uint32(len(data)*8/int(format)), data)
+	} else {
+		property = xproto.AtomNone
+	}
+
+	notify := xproto.SelectionNotifyEvent{
+		Time:      e.Time,
+		Requestor: e.Requestor,
+		Selection: e.Selection,
+		Target:    e.Target,
+		Property:  property,
+	}
+	xproto.SendEvent(o.conn, false, e.Requestor, xproto.EventMaskNoEvent, string(notify.Bytes()))
+}
+
+// convert returns the type, the format and the data of the property for target
+func (o *ClipboardOwner) convert(target xproto.Atom) (xproto.Atom, byte, []byte, bool) {
+	if target == o.targets {
+		data := make([]byte, 0, 4*(len(o.mimeTypes)+1))
+		for _, a := range append([]xproto.Atom{o.targets}, o.mimeTypes...) {
+			data = binary.LittleEndian.AppendUint32(data, uint32(a))
+		}
+		return xproto.AtomAtom, 32, data, true
+	}
+
+	for _, a := range o.mimeTypes {
+		if a != target {
+			continue
+		}
+		if len(o.data) > o.maxData {
+			o.logger.Info("Clipboard data is too large for a single property", zap.Int("size", len(o.data)))
+			return xproto.AtomNone, 0, nil, false
+		}
+		return target, 8, o.data, true
+	}
+
+	return xproto.AtomNone, 0, nil, false
+}
+
+// Done is closed when the selection is not owned anymore
+func (o *ClipboardOwner) Done() <-chan struct{} {
+	return o.done
+}
+
+// Close gives up the selection, the clipboard is cleared if it still holds it
+func (o *ClipboardOwner) Close() {
+	if o.closed.CompareAndSwap(false, true) {
+		// unblocks WaitForEvent of serve
+		o.conn.Close()
+	}
+	<-o.done
+}
@@ -0,0 +1,43 @@
+package x11
+
+import (
+	"testing"
+
+	"github.com/jezek/xgb/xproto"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestConvert(t *testing.T) {
+	const (
+		targets xproto.Atom = 300
+		utf8    xproto.Atom = 301
+	)
+	o := &ClipboardOwner{
+		targets:   targets,
+		mimeTypes: []xproto.Atom{utf8, xproto.AtomString},
+		data:      []byte("text"),
+		maxData:   4,
+		logger:    zap.NewNop(),
+	}
+
+	typ, format, data, ok := o.convert(targets)
+	require.True(t, ok)
+	require.EqualValues(t, xproto.AtomAtom, typ)
+	require.EqualValues(t, 32, format)
+	require.Equal(t, []byte{44, 1, 0, 0, 45, 1, 0, 0, 31, 0, 0, 0}, data)
+
+	typ, format, data, ok = o.convert(xproto.AtomString)
+	require.True(t, ok)
+	require.EqualValues(t, xproto.AtomString, typ)
+	require.EqualValues(t, 8, format)
+	require.Equal(t, []byte("text"), data)
+
+	_, _, _, ok = o.convert(xproto.AtomInteger)
+	require.False(t, ok)
+
+	// INCR is not implemented
+	o.maxData = 3
+	_, _, _, ok = o.convert(utf8)
+	require.False(t, ok)
+}
@@ -122,6 +122,12 @@ func fillXDGPaths(cache *baseCache, appName string) error {
 	return nil
 }
 
+// System icon dirs of the applications installed by flatpak and snap
+var exportIconDirs = []string{
+	"/var/lib/flatpak/exports/share/icons",
+	"/var/lib/snapd/desktop/icons",
+}
+
 func fillIconSearchDirs(cache *baseCache) error {
 	findDirs := []string{
 		filepath.Join(fs.GetUserHome(), ".icons"),
@@ -129,6 +135,9 @@ func fillIconSearchDirs(cache *baseCache) error {
 	for _, dir := range cache.allDataDirs {
 		findDirs = append(findDirs, filepath.Join(dir, "icons"))
 	}
+	// the export dirs of flatpak and snap are missing in XDG_DATA_DIRS of sessions not started by a login shell
+	findDirs = append(findDirs, filepath.Join(cache.dataHome, "flatpak", "exports", "share", "icons"))
+	findDirs = append(findDirs, exportIconDirs...)
 	findDirs = append(findDirs, "/usr/share/pixmaps")
 	index := make(map[string]struct{}, len(findDirs))
 
@@ -68,6 +68,25 @@ type DesktopEntry struct {
 	// If specified, it is known that the application will map at least one window with the given
 	// string as its WM class or WM name hint
 	StartupWMClass string
+
+	// Additional application actions, e.g. "New Private Window"
+	Actions []DesktopAction
+}
+
+// DesktopAction is a "Desktop Action <ID>" group of the desktop entry
+type DesktopAction struct {
+	// The action identifier from the Actions key
+	ID string
+
+	// Label of the action
+	// Array by locale
+	Name []string
+
+	// Icon of the action
+	Icon string
+
+	// Program to execute, if empty the application is D-Bus activated with the action
+	Exec string
 }
 
 func NewDesktopEntry(
@@ -233,10 +252,73 @@ func (de *DesktopEntry) parse(
 		if de.StartupWMClass, ok = parser.StartupWMClass(); !ok {
 			return false
 		}
+
+		if de.Actions, ok = parseActions(parser, locales, de.ID); !ok {
+			return false
+		}
 	} else {
 		de.Categories = []string{}
 		de.Keywords = [][]string{}
+		de.Actions = []DesktopAction{}
 	}
 
 	return true
 }
+
+// parseActions skips broken actions, so a single bad action group does not hide the whole entry
+func parseActions(parser *DesktopEntryParser, locales []Locale, entryID string) ([]DesktopAction, bool) {
+	ids, ok := parser.Actions()
+	if !ok {
+		return nil, false
+	}
+
+	actions := make([]DesktopAction, 0, len(ids))
+	for _, id := range ids {
+		if !parser.HasAction(id) {
+			// Skip action without its group
+			continue
+		}
+
+		action, ok := parseAction(parser, locales, id)
+		if !ok {
+			parser.rd.logger.Info("Skip broken desktop action",
+				zap.String("id", entryID),
+				zap.String("actionID", id),
+				zap.String("path", parser.rd.filePath))
+			continue
+		}
+
+		actions = append(actions, action)
+	}
+
+	return actions, true
+}
+
+func parseAction(parser *DesktopEntryParser, locales []Locale, id string) (DesktopAction, bool) {
+	var ok bool
+	action := DesktopAction{
+		ID:   id,
+		Name: make([]string, 0, len(locales)),
+	}
+	for i, l := range locales {
+		if name, ok := parser.ActionName(id, l, i == 0); !ok {
+			return action, false
+		} else if name != "" {
+			action.Name = append(action.Name, name)
+		}
+	}
+
+	for _, l := range locales {
+		if action.Icon, ok = parser.ActionIcon(id, l); !ok {
+			return action, false
+		} else if action.Icon != "" {
+			break
+		}
+	}
+
+	if action.Exec, ok = parser.ActionExec(id); !ok {
+		return action, false
+	}
+
+	return action, true
+}
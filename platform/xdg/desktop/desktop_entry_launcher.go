@@ -157,11 +157,30 @@ func (l *DesktopEntryLauncher) checkTryExec(tryExec string) error {
 }
 
 func (l *DesktopEntryLauncher) LaunchFull(de *DesktopEntry, urls []string, files []string) error {
+	return l.launchExec(de, de.Exec, urls, files)
+}
+
+// LaunchAction runs the Exec of the desktop action, with the environment of the entry
+func (l *DesktopEntryLauncher) LaunchAction(de *DesktopEntry, actionID string) error {
+	for _, action := range de.Actions {
+		if action.ID != actionID {
+			continue
+		}
+		if action.Exec == "" {
+			return fmt.Errorf("desktop action %s of %s has no Exec", actionID, de.ID)
+		}
+		return l.launchExec(de, action.Exec, []string{}, []string{})
+	}
+
+	return fmt.Errorf("desktop action %s of %s not found", actionID, de.ID)
+}
+
+func (l *DesktopEntryLauncher) launchExec(de *DesktopEntry, execStr string, urls []string, files []string) error {
 	if err := l.checkTryExec(de.TryExec); err != nil {
 		return err
 	}
 
-	args, err := l.buildLaunchArgs(de.Exec, urls, files)
+	args, err := l.buildLaunchArgs(execStr, urls, files)
 	if err != nil {
 		return err
 	}
@@ -10,11 +10,15 @@ import (
 	"go.uber.org/zap"
 )
 
+// Called after each Update with the IDs of all loaded entries
+type UpdateHandler func(ids []string)
+
 type DesktopEntryLoader struct {
 	mimeStorage *mimeStorage
 	dfileCache  []*DesktopEntry
 	dfileIndex  map[string]*DesktopEntry
 	locales     []Locale
+	onUpdate    UpdateHandler
 
 	logger *zap.Logger
 }
@@ -25,6 +29,7 @@ func NewDesktopEntryLoader(logger *zap.Logger) *DesktopEntryLoader {
 		dfileCache:  []*DesktopEntry{},
 		dfileIndex:  make(map[string]*DesktopEntry),
 		locales:     []Locale{},
+		onUpdate:    nil,
 		logger:      logger,
 	}
 }
@@ -86,12 +91,31 @@ func (h *DesktopEntryLoader) Update() {
 	h.dfileCache = dfileCache
 	h.dfileIndex = dfileIndex
 	h.mimeStorage = mimeStorage
+
+	if h.onUpdate != nil {
+		h.onUpdate(h.GetIDs())
+	}
+}
+
+// SetUpdateHandler sets the handler called after each Update,
+// e.g. to prune the launch history of uninstalled applications
+func (h *DesktopEntryLoader) SetUpdateHandler(onUpdate UpdateHandler) {
+	h.onUpdate = onUpdate
 }
 
 func (h *DesktopEntryLoader) GetAll() []*DesktopEntry {
 	return h.dfileCache
 }
 
+func (h *DesktopEntryLoader) GetIDs() []string {
+	ids := make([]string, 0, len(h.dfileCache))
+	for _, dfile := range h.dfileCache {
+		ids = append(ids, dfile.ID)
+	}
+
+	return ids
+}
+
 func (h *DesktopEntryLoader) GetByID(id string) (*DesktopEntry, bool) {
 	dfile, ok := h.dfileIndex[id]
 	return dfile, ok
@@ -20,7 +20,7 @@ func NewDesktopEntryParser(filePath string, logger *zap.Logger) (*DesktopEntryPa
 	}, true
 }
 
-// TODO: Version, Comment, Actions, Implements, URL, PrefersNonDefaultGPU, SingleMainWindow
+// TODO: Version, Comment, Implements, URL, PrefersNonDefaultGPU, SingleMainWindow
 
 func (p *DesktopEntryParser) EntryType() (string, bool) {
 	return p.rd.String(groupDesktopEntry, "Type", true)
@@ -93,3 +93,28 @@ func (p *DesktopEntryParser) StartupNotify() (bool, bool) {
 func (p *DesktopEntryParser) StartupWMClass() (string, bool) {
 	return p.rd.String(groupDesktopEntry, "StartupWMClass", false)
 }
+
+func (p *DesktopEntryParser) Actions() ([]string, bool) {
+	return p.rd.StringList(groupDesktopEntry, "Actions")
+}
+
+func actionGroup(actionID string) string {
+	return "Desktop Action " + actionID
+}
+
+// HasAction reports whether the group of the action exists, actions without a group are ignored
+func (p *DesktopEntryParser) HasAction(actionID string) bool {
+	return p.rd.HasGroup(actionGroup(actionID))
+}
+
+func (p *DesktopEntryParser) ActionName(actionID string, l Locale, isRequired bool) (string, bool) {
+	return p.rd.LocaleString(actionGroup(actionID), "Name", l, isRequired)
+}
+
+func (p *DesktopEntryParser) ActionIcon(actionID string, l Locale) (string, bool) {
+	return p.rd.LocaleString(actionGroup(actionID), "Icon", l, false)
+}
+
+func (p *DesktopEntryParser) ActionExec(actionID string) (string, bool) {
+	return p.rd.String(actionGroup(actionID), "Exec", false)
+}
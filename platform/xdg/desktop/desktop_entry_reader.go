@@ -51,6 +51,11 @@ func NewDesktopEntryReader(filePath string, logger *zap.Logger) (*DesktopEntryRe
 	}, true
 }
 
+func (r *DesktopEntryReader) HasGroup(group string) bool {
+	_, exists := r.kf[group]
+	return exists
+}
+
 func (r *DesktopEntryReader) Bool(group string, key string) (bool, bool) {
 	value, exists := r.kf[group][key]
 	if !exists {
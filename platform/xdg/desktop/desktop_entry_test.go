@@ -0,0 +1,80 @@
+package desktop
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+	"gotest.tools/v3/fs"
+)
+
+type DesktopEntrySuite struct {
+	suite.Suite
+}
+
+func (s *DesktopEntrySuite) newEntry(content string) (*DesktopEntry, bool) {
+	t := s.T()
+
+	dir := fs.NewDir(t, "desktop", fs.WithFile("app.desktop", content))
+	locale, err := ParseLocale("de_DE")
+	require.NoError(t, err)
+
+	return NewDesktopEntry("app", dir.Join("app.desktop"), []Locale{locale, DefaultLocale()}, newMimeStorage(), zap.NewNop())
+}
+
+func (s *DesktopEntrySuite) TestActions() {
+	t := s.T()
+
+	de, ok := s.newEntry(`[Desktop Entry]
+Type=Application
+Name=Firefox
+Exec=firefox %u
+Actions=new-window;new-private-window;missing;
+
+[Desktop Action new-window]
+Name=New Window
+Name[de]=Neues Fenster
+Exec=firefox --new-window %u
+
+[Desktop Action new-private-window]
+Name=New Private Window
+Icon=private
+Exec=firefox --private-window %u
+`)
+	require.True(t, ok)
+	require.Equal(t, []DesktopAction{
+		{ID: "new-window", Name: []string{"Neues Fenster", "New Window"}, Exec: "firefox --new-window %u"},
+		{ID: "new-private-window", Name: []string{"New Private Window", "New Private Window"}, Icon: "private", Exec: "firefox --private-window %u"},
+	}, de.Actions)
+}
+
+func (s *DesktopEntrySuite) TestBrokenActions() {
+	t := s.T()
+
+	de, ok := s.newEntry(`[Desktop Entry]
+Type=Application
+Name=Firefox
+Exec=firefox
+Actions=new-window;no-name;bad-exec;
+
+[Desktop Action new-window]
+Name=New Window
+Exec=firefox --new-window
+
+[Desktop Action no-name]
+Exec=firefox --private-window
+
+[Desktop Action bad-exec]
+Name=Profile
+Exec=firefox \q
+`)
+	require.True(t, ok)
+	require.Equal(t, []DesktopAction{
+		{ID: "new-window", Name: []string{"New Window", "New Window"}, Exec: "firefox --new-window"},
+	}, de.Actions)
+}
+
+func TestDesktopEntry(t *testing.T) {
+	suite.Run(t, new(DesktopEntrySuite))
+}
@@ -2,110 +2,273 @@ package icons
 
 import (
 	"context"
+	"encoding/xml"
+	"errors"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
 	"time"
 
 	"github.com/Runix-Org/runix/platform/fs"
 	"github.com/Runix-Org/runix/platform/xdg/base"
+	"github.com/godbus/dbus/v5"
 	"gopkg.in/ini.v1"
 )
 
-func getKDEIconTheme(ctx context.Context) (string, error) {
-	cmd := exec.CommandContext(ctx, "kreadconfig5", "--file", "kdeglobals", "--group", "Icons", "--key", "Theme")
-	out, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("kreadconfig5 failed: %w", err)
+const (
+	portalBusName  = "org.freedesktop.portal.Desktop"
+	portalTimeout  = time.Second
+	gnomeNamespace = "org.gnome.desktop.interface"
+	kdeNamespace   = "org.kde.kdeglobals.Icons"
+	// Icon theme of Plasma 5 and 6 when kdeglobals does not set one
+	kdeDefaultTheme = "breeze"
+)
+
+var errThemeNotSet = errors.New("icon theme is not set")
+
+// порядок проверки gtk конфигов
+var gtkFiles = []struct {
+	Dir     string
+	File    string
+	Section string
+}{
+	{Dir: ".config/gtk-3.0", File: "settings.ini", Section: "Settings"},
+	{Dir: ".config/gtk-4.0", File: "settings.ini", Section: "Settings"},
+	// gtkrc has no sections and quotes the values
+	{Dir: "", File: ".gtkrc-2.0", Section: ini.DefaultSection},
+}
+
+// Config files relative to the XDG config dirs
+var (
+	// Plasma 6 keeps the defaults of the global theme in kdedefaults
+	kdeglobalsFiles = []string{"kdeglobals", "kdedefaults/kdeglobals"}
+	xfconfFile      = "xfce4/xfconf/xfce-perchannel-xml/xsettings.xml"
+	lxqtFile        = "lxqt/lxqt.conf"
+)
+
+// settingsReader is org.freedesktop.portal.Settings, replaced by a fake in tests
+type settingsReader interface {
+	ReadAll(ctx context.Context, namespaces []string) (map[string]map[string]dbus.Variant, error)
+}
+
+type portalSettingsReader struct {
+	conn *dbus.Conn
+}
+
+func (r *portalSettingsReader) ReadAll(ctx context.Context, namespaces []string) (map[string]map[string]dbus.Variant, error) {
+	var res map[string]map[string]dbus.Variant
+	err := r.conn.Object(portalBusName, portalObjectPath).
+		CallWithContext(ctx, portalSettings+".ReadAll", 0, namespaces).
+		Store(&res)
+
+	return res, err
+}
+
+// themeDetector finds the icon theme of the desktop without running its tools,
+// which are missing inside flatpak and differ between versions of the desktops
+type themeDetector struct {
+	desktops   map[string]struct{}
+	home       string
+	configHome string
+	configDirs []string
+	// nil without a session bus
+	portal settingsReader
+}
+
+// GetCurrentIconTheme returns the icon theme of the current desktop or hicolor
+func GetCurrentIconTheme() string {
+	d := &themeDetector{
+		desktops:   base.GetCurrentDesktops(),
+		home:       fs.GetUserHome(),
+		configHome: base.GetConfigHome(),
+		configDirs: base.GetConfigDirs(),
 	}
-	result := strings.TrimSpace(string(out))
-	if result == "" {
-		return "", fmt.Errorf("kreadconfig5 returned empty")
+	if conn, err := dbus.ConnectSessionBus(); err == nil {
+		defer conn.Close()
+		d.portal = &portalSettingsReader{conn: conn}
 	}
-	return result, nil
+
+	return d.detect()
 }
 
-func getGNOMEIconTheme(ctx context.Context) (string, error) {
-	cmd := exec.CommandContext(ctx, "gsettings", "get", "org.gnome.desktop.interface", "icon-theme")
-	out, err := cmd.Output()
-	if err != nil {
-		return "", fmt.Errorf("gsettings failed: %w", err)
+func (d *themeDetector) detect() string {
+	var sources []func() (string, error)
+	switch {
+	case d.isDesktop("KDE", "Plasma"):
+		sources = append(sources, d.portalTheme(kdeNamespace), d.kdeTheme)
+	case d.isDesktop("XFCE"):
+		sources = append(sources, d.xfceTheme)
+	case d.isDesktop("LXQt"):
+		sources = append(sources, d.lxqtTheme)
+	case d.isDesktop("GNOME", "Unity", "X-Cinnamon", "MATE", "Budgie", "Pop"):
+		sources = append(sources, d.portalTheme(gnomeNamespace))
+	default:
+		sources = append(sources, d.portalTheme(gnomeNamespace), d.portalTheme(kdeNamespace))
 	}
-	result := strings.TrimSpace(string(out))
-	// gsettings возвращает строку с кавычками, типа "'Adwaita'"
-	result = strings.Trim(result, "'\"")
-	if result == "" {
-		return "", fmt.Errorf("gsettings returned empty")
+	// default → GTK fallback
+	sources = append(sources, d.gtkTheme)
+
+	for _, source := range sources {
+		if theme, err := source(); err == nil {
+			return theme
+		}
 	}
-	return result, nil
+
+	if d.isDesktop("KDE", "Plasma") {
+		return kdeDefaultTheme
+	}
+
+	return "hicolor"
 }
 
-// порядок проверки gtk конфигов
-var gtkFiles = []struct {
-	Dir  string
-	File string
-}{
-	{Dir: ".config/gtk-3.0", File: "settings.ini"},
-	{Dir: ".config/gtk-4.0", File: "settings.ini"},
-	{Dir: "", File: ".gtkrc-2.0"},
+func (d *themeDetector) isDesktop(names ...string) bool {
+	for _, n := range names {
+		if _, ok := d.desktops[n]; ok {
+			return true
+		}
+	}
+
+	return false
 }
 
-func getGTKIconTheme() (string, error) {
-	home := fs.GetUserHome()
-	for _, gtkf := range gtkFiles {
-		path := filepath.Join(home, gtkf.Dir, gtkf.File)
-		if _, err := os.Stat(path); err != nil {
-			continue
+// configFiles returns the existing files of name in the config dirs, the user one first
+func (d *themeDetector) configFiles(name string) []string {
+	var files []string
+	for _, dir := range append([]string{d.configHome}, d.configDirs...) {
+		path := filepath.Join(dir, name)
+		if fs.ExistsFile(path) {
+			files = append(files, path)
 		}
-		cfg, err := ini.Load(path)
-		if err != nil {
-			continue
+	}
+
+	return files
+}
+
+// portalTheme reads the icon theme of the namespace, the GNOME one has "icon-theme" and the KDE one "Theme"
+func (d *themeDetector) portalTheme(namespace string) func() (string, error) {
+	return func() (string, error) {
+		if d.portal == nil {
+			return "", fmt.Errorf("%w: no session bus", errThemeNotSet)
 		}
-		sect, err := cfg.GetSection("Settings")
+
+		ctx, cancel := context.WithTimeout(context.Background(), portalTimeout)
+		defer cancel()
+
+		settings, err := d.portal.ReadAll(ctx, []string{namespace})
 		if err != nil {
-			continue
+			return "", fmt.Errorf("portal ReadAll failed: %w", err)
+		}
+		value, ok := settings[namespace][portalIconThemeKeys[namespace]]
+		if !ok {
+			return "", fmt.Errorf("%w: portal has no %s", errThemeNotSet, namespace)
 		}
-		if key, err := sect.GetKey("gtk-icon-theme-name"); err == nil && key.String() != "" {
-			return key.String(), nil
+		// some portal backends wrap the value in one more variant
+		for {
+			inner, ok := value.Value().(dbus.Variant)
+			if !ok {
+				break
+			}
+			value = inner
 		}
+		if theme, ok := value.Value().(string); ok && theme != "" {
+			return theme, nil
+		}
+
+		return "", fmt.Errorf("%w: portal value of %s is %s", errThemeNotSet, namespace, value.String())
 	}
-	return "", fmt.Errorf("gtk settings not found")
 }
 
-func GetCurrentIconTheme() string {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
-	defer cancel()
+// kdeTheme reads [Icons] Theme of kdeglobals, the files are the same in Plasma 5 and 6.
+// The files of a config dir go before the next dir, as KConfig cascades them.
+func (d *themeDetector) kdeTheme() (string, error) {
+	for _, dir := range append([]string{d.configHome}, d.configDirs...) {
+		for _, name := range kdeglobalsFiles {
+			path := filepath.Join(dir, name)
+			if theme := readINIKey(path, "Icons", "Theme"); theme != "" {
+				return theme, nil
+			}
+		}
+	}
 
-	des := base.GetCurrentDesktops()
+	return "", fmt.Errorf("%w: kdeglobals", errThemeNotSet)
+}
 
-	if containsAny(des, []string{"KDE", "Plasma"}) {
-		if theme, err := getKDEIconTheme(ctx); err == nil {
-			return theme
+// lxqtTheme reads [General] icon_theme of lxqt.conf
+func (d *themeDetector) lxqtTheme() (string, error) {
+	for _, path := range d.configFiles(lxqtFile) {
+		if theme := readINIKey(path, "General", "icon_theme"); theme != "" {
+			return theme, nil
 		}
 	}
 
-	if containsAny(des, []string{"GNOME", "Unity", "X-Cinnamon", "MATE", "Budgie", "Pop"}) {
-		if theme, err := getGNOMEIconTheme(ctx); err == nil {
-			return theme
+	return "", fmt.Errorf("%w: lxqt.conf", errThemeNotSet)
+}
+
+// xfconfChannel is the XML of a channel stored by xfconfd
+type xfconfChannel struct {
+	Properties []xfconfProperty `xml:"property"`
+}
+
+type xfconfProperty struct {
+	Name       string           `xml:"name,attr"`
+	Value      string           `xml:"value,attr"`
+	Properties []xfconfProperty `xml:"property"`
+}
+
+// xfceTheme reads /Net/IconThemeName of the xsettings channel of xfconf
+func (d *themeDetector) xfceTheme() (string, error) {
+	for _, path := range d.configFiles(xfconfFile) {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var channel xfconfChannel
+		if err := xml.Unmarshal(data, &channel); err != nil {
+			continue
+		}
+		for _, net := range channel.Properties {
+			if net.Name != "Net" {
+				continue
+			}
+			for _, prop := range net.Properties {
+				if prop.Name == "IconThemeName" && prop.Value != "" {
+					return prop.Value, nil
+				}
+			}
 		}
 	}
 
-	// default → GTK fallback
-	if theme, err := getGTKIconTheme(); err == nil {
-		return theme
+	return "", fmt.Errorf("%w: xfconf xsettings", errThemeNotSet)
+}
+
+func (d *themeDetector) gtkTheme() (string, error) {
+	for _, gtkf := range gtkFiles {
+		path := filepath.Join(d.home, gtkf.Dir, gtkf.File)
+		if theme := strings.Trim(readINIKey(path, gtkf.Section, "gtk-icon-theme-name"), `"`); theme != "" {
+			return theme, nil
+		}
 	}
 
-	return "hicolor"
+	return "", fmt.Errorf("%w: gtk settings", errThemeNotSet)
 }
 
-func containsAny(haystack map[string]struct{}, needles []string) bool {
-	for _, n := range needles {
-		if _, ok := haystack[n]; ok {
-			return true
-		}
+// readINIKey returns the value of the key or empty if the file, the section or the key is missing
+func readINIKey(path string, section string, key string) string {
+	if !fs.ExistsFile(path) {
+		return ""
+	}
+	cfg, err := ini.Load(path)
+	if err != nil {
+		return ""
+	}
+	sect, err := cfg.GetSection(section)
+	if err != nil {
+		return ""
+	}
+	if k, err := sect.GetKey(key); err == nil {
+		return k.String()
 	}
 
-	return false
+	return ""
 }
@@ -0,0 +1,164 @@
+package icons
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+)
+
+// fakeSettings answers ReadAll with the values of the namespaces, err fails every call
+type fakeSettings struct {
+	values map[string]map[string]dbus.Variant
+	err    error
+	calls  []string
+}
+
+func (f *fakeSettings) ReadAll(_ context.Context, namespaces []string) (map[string]map[string]dbus.Variant, error) {
+	f.calls = append(f.calls, namespaces...)
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	res := make(map[string]map[string]dbus.Variant)
+	for _, ns := range namespaces {
+		if values, ok := f.values[ns]; ok {
+			res[ns] = values
+		}
+	}
+
+	return res, nil
+}
+
+type CurrentThemeSuite struct {
+	suite.Suite
+	home      string
+	systemDir string
+}
+
+func TestCurrentThemeSuite(t *testing.T) {
+	suite.Run(t, new(CurrentThemeSuite))
+}
+
+func (s *CurrentThemeSuite) SetupTest() {
+	s.home = s.T().TempDir()
+	s.systemDir = s.T().TempDir()
+}
+
+func (s *CurrentThemeSuite) detector(desktops []string, portal settingsReader) *themeDetector {
+	d := &themeDetector{
+		desktops:   make(map[string]struct{}),
+		home:       s.home,
+		configHome: filepath.Join(s.home, ".config"),
+		configDirs: []string{s.systemDir},
+		portal:     portal,
+	}
+	for _, name := range desktops {
+		d.desktops[name] = struct{}{}
+	}
+
+	return d
+}
+
+func (s *CurrentThemeSuite) write(path string, content string) {
+	require.NoError(s.T(), os.MkdirAll(filepath.Dir(path), 0o755))
+	require.NoError(s.T(), os.WriteFile(path, []byte(content), 0o644))
+}
+
+func (s *CurrentThemeSuite) writeConfig(name string, content string) {
+	s.write(filepath.Join(s.home, ".config", name), content)
+}
+
+func (s *CurrentThemeSuite) TestKDEPortal() {
+	s.writeConfig("kdeglobals", "[Icons]\nTheme=Papirus\n")
+	portal := &fakeSettings{values: map[string]map[string]dbus.Variant{
+		kdeNamespace: {"Theme": dbus.MakeVariant(dbus.MakeVariant("breeze-dark"))},
+	}}
+
+	require.Equal(s.T(), "breeze-dark", s.detector([]string{"KDE"}, portal).detect())
+	require.Equal(s.T(), []string{kdeNamespace}, portal.calls)
+}
+
+func (s *CurrentThemeSuite) TestKDEGlobals() {
+	d := s.detector([]string{"KDE"}, nil)
+	require.Equal(s.T(), kdeDefaultTheme, d.detect())
+
+	s.write(filepath.Join(s.systemDir, "kdeglobals"), "[Icons]\nTheme=oxygen\n")
+	require.Equal(s.T(), "oxygen", d.detect())
+
+	// Plasma 6 writes the defaults of the global theme to kdedefaults
+	s.writeConfig("kdedefaults/kdeglobals", "[Icons]\nTheme=breeze-dark\n")
+	require.Equal(s.T(), "breeze-dark", d.detect())
+
+	s.writeConfig("kdeglobals", "[General]\nColorScheme=BreezeDark\n\n[Icons]\nTheme=Papirus\n")
+	require.Equal(s.T(), "Papirus", d.detect())
+}
+
+func (s *CurrentThemeSuite) TestKDEPortalFailed() {
+	s.writeConfig("kdeglobals", "[Icons]\nTheme=Papirus\n")
+	portal := &fakeSettings{err: errors.New("org.freedesktop.DBus.Error.ServiceUnknown")}
+
+	require.Equal(s.T(), "Papirus", s.detector([]string{"KDE"}, portal).detect())
+}
+
+func (s *CurrentThemeSuite) TestXFCE() {
+	s.writeConfig(xfconfFile, `<?xml version="1.0" encoding="UTF-8"?>
+<channel name="xsettings" version="1.0">
+  <property name="Net" type="empty">
+    <property name="ThemeName" type="string" value="Greybird"/>
+    <property name="IconThemeName" type="string" value="elementary-xfce-dark"/>
+  </property>
+  <property name="Xft" type="empty">
+    <property name="DPI" type="int" value="96"/>
+  </property>
+</channel>
+`)
+
+	require.Equal(s.T(), "elementary-xfce-dark", s.detector([]string{"XFCE"}, nil).detect())
+}
+
+func (s *CurrentThemeSuite) TestLXQt() {
+	s.write(filepath.Join(s.systemDir, lxqtFile), "[General]\nicon_theme=breeze\n")
+	d := s.detector([]string{"LXQt"}, nil)
+	require.Equal(s.T(), "breeze", d.detect())
+
+	s.writeConfig(lxqtFile, "[General]\n__userfile__=true\nicon_theme=Papirus-Dark\n")
+	require.Equal(s.T(), "Papirus-Dark", d.detect())
+}
+
+func (s *CurrentThemeSuite) TestGNOMEPortal() {
+	s.writeConfig("gtk-3.0/settings.ini", "[Settings]\ngtk-icon-theme-name=Adwaita\n")
+	portal := &fakeSettings{values: map[string]map[string]dbus.Variant{
+		gnomeNamespace: {"icon-theme": dbus.MakeVariant("Yaru")},
+	}}
+
+	require.Equal(s.T(), "Yaru", s.detector([]string{"ubuntu", "GNOME"}, portal).detect())
+}
+
+func (s *CurrentThemeSuite) TestGTKFallback() {
+	portal := &fakeSettings{err: errors.New("org.freedesktop.DBus.Error.ServiceUnknown")}
+	d := s.detector([]string{"GNOME"}, portal)
+	require.Equal(s.T(), "hicolor", d.detect())
+
+	s.write(filepath.Join(s.home, ".gtkrc-2.0"), "gtk-theme-name=\"Adwaita\"\ngtk-icon-theme-name=\"Tango\"\n")
+	require.Equal(s.T(), "Tango", d.detect())
+
+	s.writeConfig("gtk-4.0/settings.ini", "[Settings]\ngtk-icon-theme-name=Adwaita\n")
+	require.Equal(s.T(), "Adwaita", d.detect())
+}
+
+func (s *CurrentThemeSuite) TestUnknownDesktop() {
+	portal := &fakeSettings{values: map[string]map[string]dbus.Variant{
+		gnomeNamespace: {"icon-theme": dbus.MakeVariant("")},
+		kdeNamespace:   {"Theme": dbus.MakeVariant("Papirus")},
+	}}
+
+	require.Equal(s.T(), "Papirus", s.detector(nil, portal).detect())
+	require.Equal(s.T(), []string{gnomeNamespace, kdeNamespace}, portal.calls)
+	require.Equal(s.T(), "hicolor", s.detector(nil, &fakeSettings{}).detect())
+}
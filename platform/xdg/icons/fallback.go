@@ -0,0 +1,92 @@
+package icons
+
+import (
+	"slices"
+	"strings"
+)
+
+const symbolicSuffix = "-symbolic"
+
+// Generic icons of well-known applications whose reverse-DNS icon is often missing in themes
+var appIconAliases = map[string]string{
+	"org.gnome.Nautilus":     "system-file-manager",
+	"org.kde.dolphin":        "system-file-manager",
+	"org.gnome.Terminal":     "utilities-terminal",
+	"org.gnome.Console":      "utilities-terminal",
+	"org.kde.konsole":        "utilities-terminal",
+	"org.gnome.TextEditor":   "accessories-text-editor",
+	"org.gnome.gedit":        "accessories-text-editor",
+	"org.kde.kate":           "accessories-text-editor",
+	"org.gnome.Calculator":   "accessories-calculator",
+	"org.kde.kcalc":          "accessories-calculator",
+	"org.gnome.Settings":     "preferences-system",
+	"org.kde.systemsettings": "preferences-system",
+	"org.gnome.Software":     "system-software-install",
+	"org.gnome.Epiphany":     "web-browser",
+	"org.gnome.Evolution":    "internet-mail",
+}
+
+// iconNameFallbacks returns the names tried when iconName is not found, from specific to generic:
+//
+//	foo-bar-baz        -> foo-bar, foo
+//	org.gnome.Nautilus -> nautilus, system-file-manager
+//	foo-bar-symbolic   -> foo-symbolic, foo-bar, foo
+func iconNameFallbacks(iconName string) []string {
+	base, symbolic := strings.CutSuffix(iconName, symbolicSuffix)
+	if base == "" {
+		return nil
+	}
+
+	names := genericNames(base)
+	if symbolic {
+		// the symbolic variants of every name first, then the full-color ones
+		withSuffix := make([]string, 0, 2*len(names))
+		for _, name := range names {
+			withSuffix = append(withSuffix, name+symbolicSuffix)
+		}
+		names = append(withSuffix, names...)
+	}
+
+	return names[1:]
+}
+
+// genericNames returns name followed by its more generic names
+func genericNames(name string) []string {
+	names := []string{name}
+
+	var alias string
+	if isReverseDNS(name) {
+		alias = appIconAliases[name]
+		name = strings.ToLower(name[strings.LastIndexByte(name, '.')+1:])
+		names = append(names, name)
+	}
+	for i := strings.LastIndexByte(name, '-'); i > 0; i = strings.LastIndexByte(name, '-') {
+		name = name[:i]
+		names = append(names, name)
+	}
+	// aliases are generic already, their prefixes like "system" would match unrelated icons
+	if alias != "" {
+		names = append(names, alias)
+	}
+
+	return names
+}
+
+// isReverseDNS reports whether name looks like an application ID, e.g. org.gnome.Nautilus
+func isReverseDNS(name string) bool {
+	return strings.Count(name, ".") >= 2 && !strings.HasSuffix(name, ".") && !strings.ContainsAny(name, "/ ")
+}
+
+// AppIconNames returns the names tried for the icon of an application: the Icon key, then the desktop ID
+// and the StartupWMClass, which are the only link to the icon of some flatpak and snap applications.
+// The WM class is tried lowercased too, e.g. "Firefox" -> "firefox".
+func AppIconNames(icon string, desktopID string, wmClass string) []string {
+	var names []string
+	for _, name := range []string{icon, desktopID, wmClass, strings.ToLower(wmClass)} {
+		if name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,222 @@
+package icons
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// GTK icon-theme.cache written by gtk-update-icon-cache, all numbers are big-endian:
+//
+//	Header:    u16 major, u16 minor, u32 hash offset, u32 directory list offset
+//	DirList:   u32 count, count * u32 name offset
+//	Hash:      u32 bucket count, buckets * u32 icon offset
+//	Icon:      u32 next icon offset in the bucket, u32 name offset, u32 image list offset
+//	ImageList: u32 count, count * (u16 directory index, u16 flags, u32 image data offset)
+const (
+	iconCacheFileName     = "icon-theme.cache"
+	iconCacheMajorVersion = 1
+	iconCacheNone         = 0xffffffff
+
+	iconCacheHasXPM = 1 << 0
+	iconCacheHasSVG = 1 << 1
+	iconCacheHasPNG = 1 << 2
+)
+
+var (
+	errIconCacheStale   = errors.New("icon cache is older than the theme")
+	errIconCacheInvalid = errors.New("invalid icon cache")
+)
+
+// File extensions of the suffix flags
+var iconCacheSuffixes = []struct {
+	flag uint16
+	ext  string
+}{
+	{iconCacheHasPNG, ".png"},
+	{iconCacheHasSVG, ".svg"},
+	{iconCacheHasXPM, ".xpm"},
+}
+
+type iconCache struct {
+	data []byte
+}
+
+// loadIconCache reads the cache of themeDir, it is fresh if it is not older than
+// the theme dir and the icon dirs, gtk-update-icon-cache does not track single files either
+func loadIconCache(themeDir string, iconDirs []*iconThemeDir) (*iconCache, error) {
+	cachePath := filepath.Join(themeDir, iconCacheFileName)
+	info, err := os.Stat(cachePath)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := []string{themeDir}
+	for _, iconDir := range iconDirs {
+		dirs = append(dirs, filepath.Join(themeDir, iconDir.subPath))
+	}
+	for _, dir := range dirs {
+		dirInfo, err := os.Stat(dir)
+		if err != nil {
+			continue
+		}
+		if dirInfo.ModTime().After(info.ModTime()) {
+			return nil, fmt.Errorf("%w: %s", errIconCacheStale, dir)
+		}
+	}
+
+	data, err := os.ReadFile(cachePath)
+	if err != nil {
+		return nil, err
+	}
+	cache := &iconCache{data: data}
+	if major, err := cache.u16(0); err != nil || major != iconCacheMajorVersion {
+		return nil, fmt.Errorf("%w: unsupported version", errIconCacheInvalid)
+	}
+
+	return cache, nil
+}
+
+func (c *iconCache) u16(offset uint32) (uint16, error) {
+	if uint64(offset)+2 > uint64(len(c.data)) {
+		return 0, fmt.Errorf("%w: offset %d is out of range", errIconCacheInvalid, offset)
+	}
+
+	return binary.BigEndian.Uint16(c.data[offset:]), nil
+}
+
+func (c *iconCache) u32(offset uint32) (uint32, error) {
+	if uint64(offset)+4 > uint64(len(c.data)) {
+		return 0, fmt.Errorf("%w: offset %d is out of range", errIconCacheInvalid, offset)
+	}
+
+	return binary.BigEndian.Uint32(c.data[offset:]), nil
+}
+
+func (c *iconCache) str(offset uint32) (string, error) {
+	if uint64(offset) >= uint64(len(c.data)) {
+		return "", fmt.Errorf("%w: offset %d is out of range", errIconCacheInvalid, offset)
+	}
+	for end := offset; end < uint32(len(c.data)); end++ {
+		if c.data[end] == 0 {
+			return string(c.data[offset:end]), nil
+		}
+	}
+
+	return "", fmt.Errorf("%w: unterminated string at %d", errIconCacheInvalid, offset)
+}
+
+// u32s reads the count-prefixed list at offset
+func (c *iconCache) u32s(offset uint32) ([]uint32, error) {
+	count, err := c.u32(offset)
+	if err != nil {
+		return nil, err
+	}
+	if uint64(count)*4 > uint64(len(c.data)) {
+		return nil, fmt.Errorf("%w: list of %d items at %d", errIconCacheInvalid, count, offset)
+	}
+
+	res := make([]uint32, count)
+	for i := range res {
+		if res[i], err = c.u32(offset + 4 + uint32(i)*4); err != nil {
+			return nil, err
+		}
+	}
+
+	return res, nil
+}
+
+func (c *iconCache) directories() ([]string, error) {
+	listOffset, err := c.u32(8)
+	if err != nil {
+		return nil, err
+	}
+	nameOffsets, err := c.u32s(listOffset)
+	if err != nil {
+		return nil, err
+	}
+
+	dirs := make([]string, len(nameOffsets))
+	for i, offset := range nameOffsets {
+		if dirs[i], err = c.str(offset); err != nil {
+			return nil, err
+		}
+	}
+
+	return dirs, nil
+}
+
+// forEach calls fn for every image of every icon, dir is the subdirectory of the theme
+func (c *iconCache) forEach(fn func(name string, dir string, flags uint16)) error {
+	dirs, err := c.directories()
+	if err != nil {
+		return err
+	}
+	hashOffset, err := c.u32(4)
+	if err != nil {
+		return err
+	}
+	buckets, err := c.u32s(hashOffset)
+	if err != nil {
+		return err
+	}
+
+	for _, iconOffset := range buckets {
+		// chains are acyclic in a valid cache, the limit guards against broken files
+		for steps := 0; iconOffset != iconCacheNone; steps++ {
+			if steps > len(c.data)/12 {
+				return fmt.Errorf("%w: cyclic hash chain", errIconCacheInvalid)
+			}
+			if err := c.readIcon(iconOffset, dirs, fn); err != nil {
+				return err
+			}
+			if iconOffset, err = c.u32(iconOffset); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (c *iconCache) readIcon(offset uint32, dirs []string, fn func(name string, dir string, flags uint16)) error {
+	nameOffset, err := c.u32(offset + 4)
+	if err != nil {
+		return err
+	}
+	name, err := c.str(nameOffset)
+	if err != nil {
+		return err
+	}
+	listOffset, err := c.u32(offset + 8)
+	if err != nil {
+		return err
+	}
+	count, err := c.u32(listOffset)
+	if err != nil {
+		return err
+	}
+	if uint64(count)*8 > uint64(len(c.data)) {
+		return fmt.Errorf("%w: image list of %d items at %d", errIconCacheInvalid, count, listOffset)
+	}
+
+	for i := range count {
+		imageOffset := listOffset + 4 + i*8
+		dirIndex, err := c.u16(imageOffset)
+		if err != nil {
+			return err
+		}
+		flags, err := c.u16(imageOffset + 2)
+		if err != nil {
+			return err
+		}
+		if int(dirIndex) >= len(dirs) {
+			return fmt.Errorf("%w: directory index %d of %q", errIconCacheInvalid, dirIndex, name)
+		}
+		fn(name, dirs[dirIndex], flags)
+	}
+
+	return nil
+}
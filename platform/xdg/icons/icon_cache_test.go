@@ -0,0 +1,238 @@
+package icons
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// writeIconCache writes the icon-theme.cache of themeDir like gtk-update-icon-cache
+func writeIconCache(tb testing.TB, themeDir string) {
+	tb.Helper()
+
+	type image struct {
+		dir   uint16
+		flags uint16
+	}
+	var dirs []string
+	images := make(map[string][]image)
+	err := filepath.WalkDir(themeDir, func(path string, entry os.DirEntry, err error) error {
+		if err != nil || entry.IsDir() || filepath.Dir(path) == themeDir {
+			return err
+		}
+		dir, _ := filepath.Rel(themeDir, filepath.Dir(path))
+		index := slices.Index(dirs, dir)
+		if index < 0 {
+			dirs = append(dirs, dir)
+			index = len(dirs) - 1
+		}
+		ext := filepath.Ext(path)
+		name := strings.TrimSuffix(filepath.Base(path), ext)
+		for _, suffix := range iconCacheSuffixes {
+			if suffix.ext == ext {
+				images[name] = append(images[name], image{dir: uint16(index), flags: suffix.flag})
+			}
+		}
+		return nil
+	})
+	require.NoError(tb, err)
+
+	names := make([]string, 0, len(images))
+	for name := range images {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	buckets := make([][]string, max(1, len(names)/2))
+	for _, name := range names {
+		h := gtkIconNameHash(name) % uint32(len(buckets))
+		buckets[h] = append(buckets[h], name)
+	}
+
+	data := make([]byte, 12)
+	u32 := func(v uint32) { data = binary.BigEndian.AppendUint32(data, v) }
+	set := func(offset int, v uint32) { binary.BigEndian.PutUint32(data[offset:], v) }
+
+	binary.BigEndian.PutUint16(data, iconCacheMajorVersion)
+	set(4, uint32(len(data)))
+	u32(uint32(len(buckets)))
+	bucketsOffset := len(data)
+	for range buckets {
+		u32(iconCacheNone)
+	}
+
+	strs := make(map[string]int)
+	str := func(s string) {
+		strs[s] = len(data)
+		data = append(append(data, s...), 0)
+	}
+	for _, name := range names {
+		str(name)
+	}
+	for _, dir := range dirs {
+		str(dir)
+	}
+
+	for i, bucket := range buckets {
+		next := uint32(iconCacheNone)
+		for _, name := range slices.Backward(bucket) {
+			listOffset := len(data)
+			u32(uint32(len(images[name])))
+			for _, img := range images[name] {
+				data = binary.BigEndian.AppendUint16(data, img.dir)
+				data = binary.BigEndian.AppendUint16(data, img.flags)
+				u32(0)
+			}
+			iconOffset := len(data)
+			u32(next)
+			u32(uint32(strs[name]))
+			u32(uint32(listOffset))
+			next = uint32(iconOffset)
+		}
+		set(bucketsOffset+i*4, next)
+	}
+
+	set(8, uint32(len(data)))
+	u32(uint32(len(dirs)))
+	for _, dir := range dirs {
+		u32(uint32(strs[dir]))
+	}
+
+	cachePath := filepath.Join(themeDir, iconCacheFileName)
+	require.NoError(tb, os.WriteFile(cachePath, data, 0o644))
+	// not older than the directories written in the same second
+	later := time.Now().Add(time.Minute)
+	require.NoError(tb, os.Chtimes(cachePath, later, later))
+}
+
+func gtkIconNameHash(name string) uint32 {
+	var h uint32
+	for i, c := range []byte(name) {
+		if i == 0 {
+			h = uint32(int8(c))
+			continue
+		}
+		h = (h << 5) - h + uint32(int8(c))
+	}
+	return h
+}
+
+// writeTheme generates a theme with icons in every directory
+func writeTheme(tb testing.TB, themeDir string, sizes []int, iconsPerDir int) {
+	tb.Helper()
+
+	var dirs, sections []string
+	for _, size := range sizes {
+		for _, context := range []string{"apps", "mimetypes"} {
+			dir := fmt.Sprintf("%dx%d/%s", size, size, context)
+			dirs = append(dirs, dir)
+			sections = append(sections, fmt.Sprintf("[%s]\nSize=%d\nType=Fixed\n", dir, size))
+			require.NoError(tb, os.MkdirAll(filepath.Join(themeDir, dir), 0o755))
+			for i := range iconsPerDir {
+				ext := ".png"
+				if i%3 == 0 {
+					ext = ".svg"
+				}
+				name := fmt.Sprintf("%s-%d%s", context, i, ext)
+				require.NoError(tb, os.WriteFile(filepath.Join(themeDir, dir, name), nil, 0o644))
+			}
+		}
+	}
+	// listed in the cache but not in index.theme
+	require.NoError(tb, os.MkdirAll(filepath.Join(themeDir, "unlisted"), 0o755))
+	require.NoError(tb, os.WriteFile(filepath.Join(themeDir, "unlisted", "apps-0.png"), nil, 0o644))
+
+	index := fmt.Sprintf("[Icon Theme]\nName=Generated\nDirectories=%s\n\n%s",
+		strings.Join(dirs, ","), strings.Join(sections, "\n"))
+	require.NoError(tb, os.WriteFile(filepath.Join(themeDir, "index.theme"), []byte(index), 0o644))
+}
+
+func loadGeneratedTheme(tb testing.TB, themeDir string) *iconTheme {
+	theme, ok := newIconTheme("Generated", filepath.Join(themeDir, "index.theme"), []string{themeDir}, zap.NewNop())
+	require.True(tb, ok)
+	return theme
+}
+
+func TestIconCache(t *testing.T) {
+	themeDir := filepath.Join(t.TempDir(), "Generated")
+	writeTheme(t, themeDir, []int{16, 48}, 20)
+	scanned := loadGeneratedTheme(t, themeDir)
+	require.Len(t, scanned.icons, 40)
+
+	writeIconCache(t, themeDir)
+	cache, err := loadIconCache(themeDir, scanned.iconDirs)
+	require.NoError(t, err)
+	visited := 0
+	require.NoError(t, cache.forEach(func(name string, dir string, flags uint16) { visited++ }))
+	require.Equal(t, 81, visited)
+
+	cached := loadGeneratedTheme(t, themeDir)
+	require.Equal(t, scanned.icons, cached.icons)
+	iconPath, ok := cached.lookupIcon("apps-3", 48, 1)
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(themeDir, "48x48", "apps", "apps-3.svg"), iconPath)
+
+	// a changed icon dir makes the cache stale, the new file is found by the scan
+	require.NoError(t, os.WriteFile(filepath.Join(themeDir, "16x16", "apps", "new.png"), nil, 0o644))
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(themeDir, "16x16", "apps"), later, later))
+	_, err = loadIconCache(themeDir, scanned.iconDirs)
+	require.ErrorIs(t, err, errIconCacheStale)
+	_, ok = loadGeneratedTheme(t, themeDir).icons["new"]
+	require.True(t, ok)
+}
+
+func TestIconCacheInvalid(t *testing.T) {
+	themeDir := filepath.Join(t.TempDir(), "Generated")
+	writeTheme(t, themeDir, []int{16}, 4)
+	scanned := loadGeneratedTheme(t, themeDir)
+	writeIconCache(t, themeDir)
+
+	cachePath := filepath.Join(themeDir, iconCacheFileName)
+	data, err := os.ReadFile(cachePath)
+	require.NoError(t, err)
+	info, err := os.Stat(cachePath)
+	require.NoError(t, err)
+
+	for name, broken := range map[string][]byte{
+		"version":   append([]byte{0, 2}, data[2:]...),
+		"truncated": data[:len(data)-6],
+		"hash":      append(append(slices.Clone(data[:4]), 0xff, 0xff, 0xff, 0x00), data[8:]...),
+	} {
+		require.NoError(t, os.WriteFile(cachePath, broken, 0o644))
+		require.NoError(t, os.Chtimes(cachePath, info.ModTime(), info.ModTime()))
+
+		cache, err := loadIconCache(themeDir, scanned.iconDirs)
+		if err == nil {
+			err = cache.forEach(func(string, string, uint16) {})
+		}
+		require.ErrorIs(t, err, errIconCacheInvalid, name)
+		require.Equal(t, scanned.icons, loadGeneratedTheme(t, themeDir).icons, name)
+	}
+}
+
+// BenchmarkLoadTheme compares the startup of a theme of Papirus size with and without the cache
+func BenchmarkLoadTheme(b *testing.B) {
+	themeDir := filepath.Join(b.TempDir(), "Generated")
+	writeTheme(b, themeDir, []int{16, 22, 24, 32, 48, 64, 96, 128}, 1000)
+
+	b.Run("Scan", func(b *testing.B) {
+		for b.Loop() {
+			loadGeneratedTheme(b, themeDir)
+		}
+	})
+
+	writeIconCache(b, themeDir)
+	b.Run("Cache", func(b *testing.B) {
+		for b.Loop() {
+			loadGeneratedTheme(b, themeDir)
+		}
+	})
+}
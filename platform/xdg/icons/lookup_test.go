@@ -0,0 +1,161 @@
+package icons
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+// TestLookupGolden checks the lookup against testdata/lookup.golden, written by testdata/gen_lookup_golden.py from GTK
+func TestLookupGolden(t *testing.T) {
+	testdata, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	searchDirs := []string{filepath.Join(testdata, "local"), filepath.Join(testdata, "icons")}
+	themeNames := []string{"Child", "hicolor"}
+
+	f, err := os.Open(filepath.Join(testdata, "lookup.golden"))
+	require.NoError(t, err)
+	defer f.Close()
+
+	cases := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		require.Len(t, fields, 4, line)
+		size, err := strconv.Atoi(fields[1])
+		require.NoError(t, err, line)
+		scale, err := strconv.Atoi(fields[2])
+		require.NoError(t, err, line)
+
+		// the variants are sorted once per load, a fresh load must give the same result
+		for range 3 {
+			themes := newIconThemeManager(searchDirs, zap.NewNop()).loadThemesByName(themeNames)
+			iconPath, ok := findIcon(themes, themeNames, fields[0], size, scale)
+			if fields[3] == "-" {
+				require.False(t, ok, line)
+				continue
+			}
+			require.True(t, ok, line)
+			require.Equal(t, filepath.Join(testdata, fields[3]), iconPath, line)
+		}
+		cases++
+	}
+	require.NoError(t, scanner.Err())
+	require.NotZero(t, cases)
+}
+
+func TestSizeDistance(t *testing.T) {
+	fixed := &iconThemeDir{scale: 1, size: 32, minSize: 32, minSizeEffective: 32, maxSize: 32, maxSizeEffective: 32}
+	scaled := &iconThemeDir{scale: 2, size: 32, minSize: 30, minSizeEffective: 60, maxSize: 34, maxSizeEffective: 68}
+
+	require.True(t, fixed.matchesSize(32, 1))
+	require.False(t, fixed.matchesSize(32, 2))
+	require.Equal(t, 8, fixed.sizeDistance(24, 1))
+	require.Equal(t, 32, fixed.sizeDistance(32, 2))
+
+	require.True(t, scaled.matchesSize(31, 2))
+	require.False(t, scaled.matchesSize(31, 1))
+	require.Equal(t, 0, scaled.sizeDistance(32, 2))
+	require.Equal(t, 0, scaled.sizeDistance(64, 1))
+	require.Equal(t, 28, scaled.sizeDistance(32, 1))
+	require.Equal(t, 4, scaled.sizeDistance(36, 2))
+}
+
+func TestIconNameFallbacks(t *testing.T) {
+	tests := []struct {
+		name      string
+		fallbacks []string
+	}{
+		{"foo", []string{}},
+		{"foo-bar-baz", []string{"foo-bar", "foo"}},
+		{"foo-bar-symbolic", []string{"foo-symbolic", "foo-bar", "foo"}},
+		{"org.gnome.Nautilus", []string{"nautilus", "system-file-manager"}},
+		{"org.gnome.Nautilus-symbolic", []string{
+			"nautilus-symbolic", "system-file-manager-symbolic", "org.gnome.Nautilus", "nautilus", "system-file-manager",
+		}},
+		{"io.github.some-app", []string{"some-app", "some"}},
+		{"gtk-3.0", []string{"gtk"}},
+		{"-symbolic", nil},
+	}
+	for _, tt := range tests {
+		fallbacks := iconNameFallbacks(tt.name)
+		if tt.fallbacks == nil {
+			require.Empty(t, fallbacks, tt.name)
+			continue
+		}
+		require.Equal(t, tt.fallbacks, fallbacks, tt.name)
+	}
+}
+
+func TestAppIconNames(t *testing.T) {
+	require.Equal(t, []string{"firefox", "org.mozilla.firefox", "Firefox"}, AppIconNames("firefox", "org.mozilla.firefox", "Firefox"))
+	require.Equal(t, []string{"org.example.App", "app"}, AppIconNames("", "org.example.App", "app"))
+	require.Empty(t, AppIconNames("", "", ""))
+}
+
+func TestResolveAny(t *testing.T) {
+	testdata, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	themeNames := []string{"Child", "hicolor"}
+	manager := newIconThemeManager([]string{filepath.Join(testdata, "icons")}, zap.NewNop())
+	resolver := &IconResolver{
+		state: &resolverState{
+			themeNames:    themeNames,
+			themes:        manager.loadThemesByName(themeNames),
+			fallbackIcons: map[string]string{},
+			cache:         newResolveCache(defaultResolveCacheSize, defaultNegativeTTL),
+		},
+		logger: zap.NewNop(),
+	}
+	apps := filepath.Join(testdata, "icons", "Child", "48x48", "apps")
+
+	tests := []struct {
+		names []string
+		path  string
+	}{
+		{[]string{"network-wireless-signal-good-symbolic"}, filepath.Join(testdata, "icons", "Child", "scalable", "apps", "network-wireless-symbolic.svg")},
+		{[]string{"org.gnome.Nautilus"}, filepath.Join(apps, "system-file-manager.png")},
+		{[]string{"org.gnome.Nautilus-symbolic"}, filepath.Join(apps, "system-file-manager.png")},
+		{[]string{"accessories-text-editor-extra"}, filepath.Join(apps, "accessories.png")},
+		{[]string{"edit-find-symbolic"}, filepath.Join(apps, "edit.png")},
+		// exact names before the fallbacks of the first one
+		{[]string{"", "missing-app", "inherited-extra", "order"}, filepath.Join(apps, "order.png")},
+		{[]string{"missing-app", "inherited-extra"}, filepath.Join(testdata, "icons", "Child", "16x16", "apps", "inherited.png")},
+		{[]string{"missing-app"}, ""},
+		// the desktop ID and the WM class of applications whose Icon is missing
+		{AppIconNames("missing-app", "org.example.Viewer", "Viewer"), filepath.Join(testdata, "icons", "hicolor", "48x48", "apps", "org.example.Viewer.png")},
+		{AppIconNames("missing-app", "missing-id", "Grandparent"), filepath.Join(testdata, "icons", "Grandparent", "24x24", "apps", "grandparent.png")},
+		{[]string{""}, ""},
+		{nil, ""},
+	}
+	for range 2 {
+		for _, tt := range tests {
+			iconPath, ok := resolver.ResolveAny(48, 1, tt.names...)
+			require.Equal(t, tt.path != "", ok, tt.names)
+			require.Equal(t, tt.path, iconPath, tt.names)
+		}
+	}
+
+	iconPath, ok := resolver.Resolve("org.gnome.Nautilus", 48, 1)
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(apps, "system-file-manager.png"), iconPath)
+
+	// the exact lookup does not share the cache entry of the fallback one
+	_, ok = resolver.ResolveExact("org.gnome.Nautilus", 48, 1)
+	require.False(t, ok)
+	_, ok = resolver.ResolveExact("edit-find", 48, 1)
+	require.False(t, ok)
+	iconPath, ok = resolver.ResolveExact("edit", 48, 1)
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(apps, "edit.png"), iconPath)
+}
@@ -0,0 +1,102 @@
+package icons
+
+import (
+	"container/list"
+	"time"
+)
+
+const (
+	defaultResolveCacheSize = 4096
+	// A missing icon is often installed soon after, e.g. with its application
+	defaultNegativeTTL = 30 * time.Second
+)
+
+// CacheStats are the counters of the lookup cache since the resolver was created
+type CacheStats struct {
+	Hits uint64
+	// NegativeHits are the hits of the icons cached as missing, included in Hits
+	NegativeHits uint64
+	Misses       uint64
+	Evictions    uint64
+	// Size is the number of entries of the current cache
+	Size int
+}
+
+type resolveEntry struct {
+	key      string
+	iconPath string
+	// zero for the found icons, they stay until evicted or reset
+	expires time.Time
+}
+
+// resolveCache is an LRU of the lookup results limited to capacity entries.
+// It is not safe for concurrent use, get changes the order too.
+type resolveCache struct {
+	capacity    int
+	negativeTTL time.Duration
+	now         func() time.Time
+	items       map[string]*list.Element
+	// the most recently used first
+	order *list.List
+}
+
+func newResolveCache(capacity int, negativeTTL time.Duration) *resolveCache {
+	return &resolveCache{
+		capacity:    max(1, capacity),
+		negativeTTL: negativeTTL,
+		now:         time.Now,
+		items:       make(map[string]*list.Element),
+		order:       list.New(),
+	}
+}
+
+// get returns the cached result of key, an empty iconPath is a cached miss.
+// An expired miss is removed and reported as not cached.
+func (c *resolveCache) get(key string) (iconPath string, cached bool) {
+	elem, ok := c.items[key]
+	if !ok {
+		return "", false
+	}
+
+	entry := elem.Value.(*resolveEntry)
+	if !entry.expires.IsZero() && !c.now().Before(entry.expires) {
+		c.remove(elem)
+		return "", false
+	}
+	c.order.MoveToFront(elem)
+
+	return entry.iconPath, true
+}
+
+// put stores the result of key, an empty iconPath expires after negativeTTL.
+// It reports whether the least recently used entry was evicted.
+func (c *resolveCache) put(key string, iconPath string) bool {
+	var expires time.Time
+	if iconPath == "" {
+		expires = c.now().Add(c.negativeTTL)
+	}
+
+	if elem, ok := c.items[key]; ok {
+		entry := elem.Value.(*resolveEntry)
+		entry.iconPath, entry.expires = iconPath, expires
+		c.order.MoveToFront(elem)
+		return false
+	}
+
+	c.items[key] = c.order.PushFront(&resolveEntry{key: key, iconPath: iconPath, expires: expires})
+	if c.order.Len() <= c.capacity {
+		return false
+	}
+	c.remove(c.order.Back())
+
+	return true
+}
+
+func (c *resolveCache) remove(elem *list.Element) {
+	c.order.Remove(elem)
+	delete(c.items, elem.Value.(*resolveEntry).key)
+}
+
+func (c *resolveCache) len() int {
+	return c.order.Len()
+}
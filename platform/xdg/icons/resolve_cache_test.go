@@ -0,0 +1,103 @@
+package icons
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestResolveCacheEviction(t *testing.T) {
+	cache := newResolveCache(2, time.Minute)
+
+	require.False(t, cache.put("a", "/a.png"))
+	require.False(t, cache.put("b", "/b.png"))
+	// a becomes the most recently used, b is evicted
+	iconPath, ok := cache.get("a")
+	require.True(t, ok)
+	require.Equal(t, "/a.png", iconPath)
+	require.True(t, cache.put("c", "/c.png"))
+
+	_, ok = cache.get("b")
+	require.False(t, ok)
+	_, ok = cache.get("c")
+	require.True(t, ok)
+	require.Equal(t, 2, cache.len())
+
+	// an update is not an insert
+	require.False(t, cache.put("a", "/a.svg"))
+	iconPath, _ = cache.get("a")
+	require.Equal(t, "/a.svg", iconPath)
+	require.Equal(t, 2, cache.len())
+}
+
+func TestResolveCacheNegativeTTL(t *testing.T) {
+	now := time.Unix(1000, 0)
+	cache := newResolveCache(8, 30*time.Second)
+	cache.now = func() time.Time { return now }
+
+	cache.put("missing", "")
+	cache.put("found", "/found.png")
+
+	now = now.Add(29 * time.Second)
+	iconPath, ok := cache.get("missing")
+	require.True(t, ok)
+	require.Empty(t, iconPath)
+
+	now = now.Add(time.Second)
+	_, ok = cache.get("missing")
+	require.False(t, ok)
+	require.Equal(t, 1, cache.len())
+
+	// found icons do not expire
+	now = now.Add(time.Hour)
+	_, ok = cache.get("found")
+	require.True(t, ok)
+}
+
+func TestResolverCacheStats(t *testing.T) {
+	testdata, err := filepath.Abs("testdata")
+	require.NoError(t, err)
+	themeNames := []string{"Child", "hicolor"}
+	manager := newIconThemeManager([]string{filepath.Join(testdata, "icons")}, zap.NewNop())
+	resolver := &IconResolver{
+		state: &resolverState{
+			themeNames:    themeNames,
+			themes:        manager.loadThemesByName(themeNames),
+			fallbackIcons: map[string]string{},
+			cache:         newResolveCache(4, time.Minute),
+		},
+		logger: zap.NewNop(),
+	}
+
+	var wg sync.WaitGroup
+	for i := range 8 {
+		wg.Go(func() {
+			for j := range 100 {
+				// 2 found and 1 missing icon in 2 sizes, 6 keys for 4 entries
+				names := []string{"order", "inherited", fmt.Sprintf("missing-%d", i%2)}
+				resolver.Resolve(names[j%3], 16+32*(j%2), 1)
+				resolver.CacheStats()
+			}
+		})
+	}
+	wg.Wait()
+
+	stats := resolver.CacheStats()
+	require.Equal(t, uint64(800), stats.Hits+stats.Misses)
+	require.Equal(t, 4, stats.Size)
+	require.NotZero(t, stats.Evictions)
+	require.LessOrEqual(t, stats.NegativeHits, stats.Hits)
+
+	// a cached miss is a negative hit
+	resolver.Resolve("missing-2", 24, 1)
+	resolver.Resolve("missing-2", 24, 1)
+	next := resolver.CacheStats()
+	require.Equal(t, stats.Misses+1, next.Misses)
+	require.Equal(t, stats.Hits+1, next.Hits)
+	require.Equal(t, stats.NegativeHits+1, next.NegativeHits)
+}
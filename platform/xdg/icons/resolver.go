@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 	"sync"
 
@@ -14,15 +15,26 @@ import (
 )
 
 type IconResolver struct {
-	themeManager  *iconThemeMamager
-	themes        []*iconTheme
-	fallbackIcons map[string]string
-	cache         map[string]string
+	state *resolverState
+	// guarded by mu, kept by ResetCache
+	stats CacheStats
 
 	mu     sync.RWMutex
 	logger *zap.Logger
 }
 
+// resolverState is replaced as a whole by ResetCache, a lookup uses one state from start to end,
+// so a result found with the previous theme never lands in the new cache
+type resolverState struct {
+	// current theme and hicolor, searched with their parents in this order
+	themeNames []string
+	// loaded themes by name
+	themes        map[string]*iconTheme
+	fallbackIcons map[string]string
+	// guarded by IconResolver.mu, a read locks for writing too since it changes the LRU order
+	cache *resolveCache
+}
+
 func NewIconFinder(logger *zap.Logger) *IconResolver {
 	obj := &IconResolver{logger: logger}
 	obj.ResetCache()
@@ -30,27 +42,55 @@ func NewIconFinder(logger *zap.Logger) *IconResolver {
 	return obj
 }
 
+// Resolve finds iconName, falling back to its generic names, see iconNameFallbacks
 func (f *IconResolver) Resolve(iconName string, iconSize int, iconScale int) (string, bool) {
-	if len(iconName) == 0 {
+	return f.ResolveAny(iconSize, iconScale, iconName)
+}
+
+// ResolveAny finds the first of iconNames that exists, every name is tried exactly
+// before the generic fallbacks of any of them
+func (f *IconResolver) ResolveAny(iconSize int, iconScale int, iconNames ...string) (string, bool) {
+	return f.resolve(iconNames, iconSize, iconScale, true)
+}
+
+// ResolveExact finds iconName only, without its generic names
+func (f *IconResolver) ResolveExact(iconName string, iconSize int, iconScale int) (string, bool) {
+	return f.resolve([]string{iconName}, iconSize, iconScale, false)
+}
+
+func (f *IconResolver) resolve(iconNames []string, iconSize int, iconScale int, fallbacks bool) (string, bool) {
+	iconNames = slices.DeleteFunc(slices.Clone(iconNames), func(name string) bool { return name == "" })
+	if len(iconNames) == 0 {
 		return "", false
 	}
 
-	cacheKey := fmt.Sprintf("%s|%d|%d", iconName, iconSize, iconScale)
-	f.mu.RLock()
-	iconPath, ok := f.cache[cacheKey]
-	f.mu.RUnlock()
+	cacheKey := fmt.Sprintf("%s|%d|%d|%t", strings.Join(iconNames, ","), iconSize, iconScale, fallbacks)
+	f.mu.Lock()
+	state := f.state
+	iconPath, ok := state.cache.get(cacheKey)
 	if ok {
-		return iconPath, true
+		f.stats.Hits++
+		if iconPath == "" {
+			f.stats.NegativeHits++
+		}
+	} else {
+		f.stats.Misses++
+	}
+	f.mu.Unlock()
+	if ok {
+		return iconPath, iconPath != ""
 	}
 
-	iconPath, ok = f.findIconImpl(iconName, iconSize, iconScale)
+	iconPath, ok = state.findAny(iconNames, iconSize, iconScale, fallbacks)
 	f.mu.Lock()
-	f.cache[cacheKey] = iconPath
+	if state.cache.put(cacheKey, iconPath) {
+		f.stats.Evictions++
+	}
 	f.mu.Unlock()
 
 	if !ok {
 		f.logger.Debug("Failed find full icon path",
-			zap.String("name", iconName),
+			zap.Strings("names", iconNames),
 			zap.Int("size", iconSize),
 			zap.Int("scale", iconScale))
 	}
@@ -58,49 +98,143 @@ func (f *IconResolver) Resolve(iconName string, iconSize int, iconScale int) (st
 	return iconPath, ok
 }
 
+// CurrentTheme returns the icon theme loaded by the last ResetCache
+func (f *IconResolver) CurrentTheme() string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.state.themeNames[0]
+}
+
+// CacheStats returns the counters of the lookup cache
+func (f *IconResolver) CacheStats() CacheStats {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	stats := f.stats
+	stats.Size = f.state.cache.len()
+
+	return stats
+}
+
+// ResetCache reloads the current theme, the lookups see the old or the new state, never a mix
 func (f *IconResolver) ResetCache() {
-	themeManager := newIconThemeManager(f.logger)
+	themeManager := newIconThemeManager(base.GetIconSearchDirs(), f.logger)
 	themesName := []string{GetCurrentIconTheme(), "hicolor"}
-	themes := themeManager.loadThemesWithParents(themesName)
-	fallbackIcons := f.getFallbackIcons()
+	state := &resolverState{
+		themeNames:    themesName,
+		themes:        themeManager.loadThemesByName(themesName),
+		fallbackIcons: getFallbackIcons(),
+		cache:         newResolveCache(defaultResolveCacheSize, defaultNegativeTTL),
+	}
 
 	f.mu.Lock()
 	defer f.mu.Unlock()
 
-	f.cache = make(map[string]string)
-	f.themeManager = themeManager
-	f.themes = themes
-	f.fallbackIcons = fallbackIcons
+	f.state = state
 }
 
-func (f *IconResolver) findIconImpl(iconName string, iconSize int, iconScale int) (string, bool) {
+// watchDirs returns the dirs whose changes may change the lookup results:
+// the icon search dirs, the dirs of the loaded themes and their Directories from index.theme
+func (f *IconResolver) watchDirs() []string {
+	f.mu.RLock()
+	state := f.state
+	f.mu.RUnlock()
+
+	dirs := slices.Clone(base.GetIconSearchDirs())
+	for _, theme := range state.themes {
+		dirs = append(dirs, theme.themeDirs...)
+		for _, themeDir := range theme.themeDirs {
+			for _, iconDir := range theme.iconDirs {
+				dirs = append(dirs, filepath.Join(themeDir, iconDir.subPath))
+			}
+		}
+	}
+	slices.Sort(dirs)
+
+	return slices.Compact(dirs)
+}
+
+// findAny tries iconNames in order, then their generic names if fallbacks is set
+func (s *resolverState) findAny(iconNames []string, iconSize int, iconScale int, fallbacks bool) (string, bool) {
+	candidates := slices.Clone(iconNames)
+	for _, iconName := range iconNames {
+		if fallbacks && !filepath.IsAbs(iconName) {
+			candidates = append(candidates, iconNameFallbacks(iconName)...)
+		}
+	}
+
+	tried := make(map[string]struct{}, len(candidates))
+	for _, candidate := range candidates {
+		if _, ok := tried[candidate]; ok {
+			continue
+		}
+		tried[candidate] = struct{}{}
+
+		if iconPath, ok := s.find(candidate, iconSize, iconScale); ok {
+			return iconPath, true
+		}
+	}
+
+	return "", false
+}
+
+// find is FindIcon of the Icon Theme spec
+func (s *resolverState) find(iconName string, iconSize int, iconScale int) (string, bool) {
 	if filepath.IsAbs(iconName) {
 		if fs.ExistsFile(iconName) {
 			return iconName, true
 		}
 	}
 
-	for _, theme := range f.themes {
-		iconPath, ok := theme.lookupIcon(iconName, iconSize, iconScale)
-		if ok {
-			return iconPath, true
-		}
+	if iconPath, ok := findIcon(s.themes, s.themeNames, iconName, iconSize, iconScale); ok {
+		return iconPath, true
+	}
+
+	if iconPath, ok := s.fallbackIcons[iconName]; ok {
+		return iconPath, true
 	}
-	for _, theme := range f.themes {
-		iconPath, ok := theme.lookupIconOutside(iconName, iconSize, iconScale)
-		if ok {
+
+	return "", false
+}
+
+// findIcon searches themeNames in order, a theme reached twice is searched once
+func findIcon(themes map[string]*iconTheme, themeNames []string, iconName string, iconSize int, iconScale int) (string, bool) {
+	visited := make(map[string]struct{})
+	for _, themeName := range themeNames {
+		if iconPath, ok := findThemeIcon(themes, themeName, iconName, iconSize, iconScale, visited); ok {
 			return iconPath, true
 		}
 	}
 
-	if iconPath, ok := f.fallbackIcons[iconName]; ok {
+	return "", false
+}
+
+// findThemeIcon is FindIconHelper of the spec: the theme, then each parent with its own parents.
+// visited breaks inheritance cycles.
+func findThemeIcon(themes map[string]*iconTheme, themeName string, iconName string, iconSize int, iconScale int, visited map[string]struct{}) (string, bool) {
+	if _, ok := visited[themeName]; ok {
+		return "", false
+	}
+	visited[themeName] = struct{}{}
+
+	theme, ok := themes[themeName]
+	if !ok {
+		return "", false
+	}
+	if iconPath, ok := theme.lookupIcon(iconName, iconSize, iconScale); ok {
 		return iconPath, true
 	}
+	for _, parent := range theme.getParentNames() {
+		if iconPath, ok := findThemeIcon(themes, parent, iconName, iconSize, iconScale, visited); ok {
+			return iconPath, true
+		}
+	}
 
 	return "", false
 }
 
-func (f *IconResolver) getFallbackIcons() map[string]string {
+func getFallbackIcons() map[string]string {
 	fallbackIcons := make(map[string]string)
 	for _, findDir := range base.GetIconSearchDirs() {
 		entries, err := os.ReadDir(findDir)
@@ -0,0 +1,98 @@
+#!/usr/bin/env python3
+"""Writes lookup.golden from the lookups of GTK 3 on the fixture themes.
+
+Needs PyGObject and GTK 3, run from any dir:
+
+    python3 platform/xdg/icons/testdata/gen_lookup_golden.py > platform/xdg/icons/testdata/lookup.golden
+"""
+
+import configparser
+import os
+import sys
+
+import gi
+
+gi.require_version("Gtk", "3.0")
+from gi.repository import Gtk  # noqa: E402
+
+TESTDATA = os.path.dirname(os.path.abspath(__file__))
+SEARCH_PATH = [os.path.join(TESTDATA, "local"), os.path.join(TESTDATA, "icons")]
+THEME = "Child"
+
+# name, size, scale
+CASES = [
+    ("inherited", 16, 1),
+    ("inherited", 32, 1),
+    ("vector", 48, 1),
+    ("vector", 512, 1),
+    ("raster", 48, 1),
+    ("raster", 44, 1),
+    ("hidpi", 48, 1),
+    ("hidpi", 48, 2),
+    ("hidpi", 24, 2),
+    ("distance", 30, 1),
+    ("distance", 34, 1),
+    ("order", 48, 1),
+    ("order", 20, 1),
+    ("order", 100, 1),
+    ("parent", 48, 1),
+    ("grandparent", 48, 1),
+    ("hicolor", 48, 1),
+    ("local", 16, 1),
+    ("missing", 48, 1),
+]
+
+HEADER = """\
+# Generated by gen_lookup_golden.py from gtk_icon_theme_lookup_icon_for_scale of GTK {version},
+# do not edit. The theme is Child, the base dirs are testdata/local and testdata/icons in this order.
+# GTK prefers PNG in every dir, the resolver prefers SVG in scalable dirs: an icon found in a
+# Type=Scalable dir is looked up again with GTK_ICON_LOOKUP_FORCE_SVG.
+#
+# name          size  scale  path"""
+
+
+def is_scalable_dir(icon_path):
+    """Reports whether the dir of icon_path is a Type=Scalable dir of its theme."""
+    for base in SEARCH_PATH:
+        rel = os.path.relpath(os.path.dirname(icon_path), base)
+        if rel.startswith(".."):
+            continue
+        theme, _, sub_dir = rel.partition(os.sep)
+        for index_base in SEARCH_PATH:
+            index = os.path.join(index_base, theme, "index.theme")
+            if not os.path.isfile(index):
+                continue
+            cfg = configparser.ConfigParser(interpolation=None)
+            cfg.read(index)
+            return cfg.get(sub_dir, "Type", fallback="Threshold") == "Scalable"
+    return False
+
+
+def lookup(theme, name, size, scale):
+    info = theme.lookup_icon_for_scale(name, size, scale, 0)
+    if info is None:
+        return None
+    icon_path = info.get_filename()
+    if is_scalable_dir(icon_path) and not icon_path.endswith(".svg"):
+        info = theme.lookup_icon_for_scale(name, size, scale, Gtk.IconLookupFlags.FORCE_SVG)
+        icon_path = info.get_filename()
+    return icon_path
+
+
+def main():
+    theme = Gtk.IconTheme.new()
+    theme.set_search_path(SEARCH_PATH)
+    theme.set_custom_theme(THEME)
+
+    version = "{}.{}.{}".format(Gtk.get_major_version(), Gtk.get_minor_version(), Gtk.get_micro_version())
+    lines = [HEADER.format(version=version)]
+    for name, size, scale in CASES:
+        icon_path = lookup(theme, name, size, scale)
+        rel = "-" if icon_path is None else os.path.relpath(icon_path, TESTDATA)
+        lines.append(f"{name:<16}{size:<6}{scale:<7}{rel}")
+
+    sys.stdout.write("\n".join(lines) + "\n")
+
+
+if __name__ == "__main__":
+    main()
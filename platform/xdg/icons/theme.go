@@ -1,10 +1,12 @@
 package icons
 
 import (
+	"cmp"
 	"errors"
 	"math"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
 
 	"github.com/Runix-Org/runix/platform/fs"
@@ -12,16 +14,41 @@ import (
 	"gopkg.in/ini.v1"
 )
 
-var supportedIconExts = map[string]struct{}{".png": {}, ".svg": {}}
+var supportedIconExts = map[string]struct{}{".png": {}, ".svg": {}, ".xpm": {}}
 
-// Full icon path => *iconThemeDir
-type iconVariants map[string]*iconThemeDir
+// Extension order of the spec, scalable dirs prefer SVG
+var (
+	iconExtsOrder         = []string{".png", ".svg", ".xpm"}
+	scalableIconExtsOrder = []string{".svg", ".png", ".xpm"}
+)
+
+type iconVariant struct {
+	path string
+	dir  *iconThemeDir
+	// position of the theme dir in the icon search dirs
+	baseIndex int
+}
+
+// Files of an icon in the order of LookupIcon of the spec: by icon dir, base dir and extension
+type iconVariants []iconVariant
+
+func (v iconVariants) sort() {
+	slices.SortFunc(v, func(a, b iconVariant) int {
+		return cmp.Or(
+			cmp.Compare(a.dir.index, b.dir.index),
+			cmp.Compare(a.baseIndex, b.baseIndex),
+			cmp.Compare(a.dir.extRank(filepath.Ext(a.path)), b.dir.extRank(filepath.Ext(b.path))),
+		)
+	})
+}
 
 type iconTheme struct {
-	name     string
-	parents  []string
-	iconDirs []*iconThemeDir
-	// base icon name => []*iconThemeDir
+	name    string
+	parents []string
+	// dirs of the theme in the icon search dirs
+	themeDirs []string
+	iconDirs  []*iconThemeDir
+	// base icon name => variants
 	icons map[string]iconVariants
 }
 
@@ -61,6 +88,7 @@ func newIconTheme(name string, themeFilePath string, themeDirs []string, logger
 							zap.Error(errors.New("size field not set")),
 						)
 					} else {
+						iconDir.index = len(iconDirs)
 						iconDirs = append(iconDirs, iconDir)
 					}
 				}
@@ -69,49 +97,102 @@ func newIconTheme(name string, themeFilePath string, themeDirs []string, logger
 	}
 
 	icons := make(map[string]iconVariants)
-	for _, themeDir := range themeDirs {
-		for _, iconDir := range iconDirs {
-			iconDirFullPath := filepath.Join(themeDir, iconDir.subPath)
-			if !fs.ExistsDir(iconDirFullPath) {
+	for baseIndex, themeDir := range themeDirs {
+		cache, err := loadIconCache(themeDir, iconDirs)
+		if err == nil {
+			err = addCachedIcons(icons, cache, themeDir, baseIndex, iconDirs)
+			if err == nil {
 				continue
 			}
-			entries, err := os.ReadDir(iconDirFullPath)
-			if err != nil {
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			logger.Debug("Icon theme cache is not used",
+				zap.String("path", filepath.Join(themeDir, iconCacheFileName)), zap.Error(err))
+		}
+		scanIcons(icons, themeDir, baseIndex, iconDirs)
+	}
+	for _, variants := range icons {
+		variants.sort()
+	}
+
+	return &iconTheme{
+		name:      name,
+		parents:   parents,
+		themeDirs: themeDirs,
+		iconDirs:  iconDirs,
+		icons:     icons,
+	}, true
+}
+
+// scanIcons reads the icon dirs of themeDir
+func scanIcons(icons map[string]iconVariants, themeDir string, baseIndex int, iconDirs []*iconThemeDir) {
+	for _, iconDir := range iconDirs {
+		iconDirFullPath := filepath.Join(themeDir, iconDir.subPath)
+		if !fs.ExistsDir(iconDirFullPath) {
+			continue
+		}
+		entries, err := os.ReadDir(iconDirFullPath)
+		if err != nil {
+			continue
+		}
+
+		for _, entry := range entries {
+			if entry.IsDir() {
 				continue
 			}
 
-			for _, entry := range entries {
-				if entry.IsDir() {
-					continue
-				}
+			name := entry.Name()
 
-				name := entry.Name()
+			ext := filepath.Ext(name)
+			if _, ok := supportedIconExts[ext]; !ok {
+				continue
+			}
 
-				ext := filepath.Ext(name)
-				if _, ok := supportedIconExts[ext]; !ok {
-					continue
-				}
+			name = strings.TrimSuffix(name, ext)
+			icons[name] = append(icons[name], iconVariant{filepath.Join(iconDirFullPath, entry.Name()), iconDir, baseIndex})
+		}
+	}
+}
 
-				base := strings.TrimSuffix(name, ext)
-				fullPath := filepath.Join(iconDirFullPath, name)
+// addCachedIcons reads the icons of themeDir from its cache, the directories
+// of the cache missing in index.theme are skipped like in scanIcons
+func addCachedIcons(icons map[string]iconVariants, cache *iconCache, themeDir string, baseIndex int, iconDirs []*iconThemeDir) error {
+	type cachedDir struct {
+		iconDir *iconThemeDir
+		// full path of the dir with the trailing separator
+		prefix string
+	}
+	bySubPath := make(map[string]cachedDir, len(iconDirs))
+	for _, iconDir := range iconDirs {
+		bySubPath[iconDir.subPath] = cachedDir{iconDir, filepath.Join(themeDir, iconDir.subPath) + string(filepath.Separator)}
+	}
 
-				if varians, ok := icons[base]; ok {
-					varians[fullPath] = iconDir
-				} else {
-					icons[base] = iconVariants{
-						fullPath: iconDir,
-					}
-				}
+	// the cache is read completely before icons is changed, a broken cache falls back to the scan
+	type cachedIcon struct {
+		name    string
+		variant iconVariant
+	}
+	var cached []cachedIcon
+	err := cache.forEach(func(name string, dir string, flags uint16) {
+		d, ok := bySubPath[dir]
+		if !ok {
+			return
+		}
+		for _, suffix := range iconCacheSuffixes {
+			if flags&suffix.flag != 0 {
+				cached = append(cached, cachedIcon{name, iconVariant{d.prefix + name + suffix.ext, d.iconDir, baseIndex}})
 			}
 		}
+	})
+	if err != nil {
+		return err
 	}
 
-	return &iconTheme{
-		name:     name,
-		parents:  parents,
-		iconDirs: iconDirs,
-		icons:    icons,
-	}, true
+	for _, icon := range cached {
+		icons[icon.name] = append(icons[icon.name], icon.variant)
+	}
+
+	return nil
 }
 
 func (t *iconTheme) getName() string {
@@ -122,43 +203,28 @@ func (t *iconTheme) getParentNames() []string {
 	return t.parents
 }
 
+// lookupIcon is LookupIcon of the spec: the first file of a dir matching the size,
+// else the first file of the closest dir
 func (t *iconTheme) lookupIcon(iconName string, iconSize int, iconScale int) (string, bool) {
 	variants, ok := t.icons[iconName]
 	if !ok {
 		return "", false
 	}
 
-	bestPath := ""
-	bestDist := math.MaxInt64
-	for iconPath, iconDir := range variants {
-		if iconDir.matchesSize(iconSize, iconScale) {
-			return iconPath, true
-		}
-		dist := iconDir.sizeDistance(iconSize, iconScale)
-		if dist < bestDist {
-			bestDist = dist
-			bestPath = iconPath
+	for _, variant := range variants {
+		if variant.dir.matchesSize(iconSize, iconScale) {
+			return variant.path, true
 		}
 	}
 
-	return bestPath, bestDist != math.MaxInt64
-}
-
-func (t *iconTheme) lookupIconOutside(iconName string, iconSize int, iconScale int) (string, bool) {
-	variants, ok := t.icons[iconName]
-	if !ok {
-		return "", false
-	}
-
 	bestPath := ""
-	bestDist := math.MaxInt64
-	for iconPath, iconDir := range variants {
-		dist := iconDir.sizeDistanceOutside(iconSize, iconScale)
-		if dist < bestDist {
+	bestDist := math.MaxInt
+	for _, variant := range variants {
+		if dist := variant.dir.sizeDistance(iconSize, iconScale); dist < bestDist {
 			bestDist = dist
-			bestPath = iconPath
+			bestPath = variant.path
 		}
 	}
 
-	return bestPath, bestDist != math.MaxInt64
+	return bestPath, bestPath != ""
 }
@@ -1,17 +1,18 @@
 package icons
 
 import (
-	"math"
 	"strings"
 
 	"gopkg.in/ini.v1"
 )
 
 type iconThemeDir struct {
-	subPath          string
+	subPath string
+	// position in the Directories of index.theme, lookups prefer earlier dirs
+	index            int
+	scalable         bool
 	scale            int
 	size             int
-	sizeEffective    int
 	minSize          int
 	minSizeEffective int
 	maxSize          int
@@ -39,9 +40,9 @@ func newIconThemeDir(subPath string, sec *ini.Section) *iconThemeDir {
 
 	return &iconThemeDir{
 		subPath:          subPath,
+		scalable:         dirType == "scalable",
 		scale:            scale,
 		size:             size,
-		sizeEffective:    size * scale,
 		minSize:          minSize,
 		minSizeEffective: minSize * scale,
 		maxSize:          maxSize,
@@ -49,28 +50,16 @@ func newIconThemeDir(subPath string, sec *ini.Section) *iconThemeDir {
 	}
 }
 
+// matchesSize is DirectoryMatchesSize of the Icon Theme spec
 func (i *iconThemeDir) matchesSize(iconSize int, iconScale int) bool {
 	return i.scale == iconScale && i.minSize <= iconSize && iconSize <= i.maxSize
 }
 
+// sizeDistance is DirectorySizeDistance of the Icon Theme spec, with the typos of its
+// Threshold branch fixed like in GTK: 0 inside the size range, else the distance to it
 func (i *iconThemeDir) sizeDistance(iconSize int, iconScale int) int {
 	iconEffective := iconSize * iconScale
 
-	if i.minSizeEffective <= iconEffective && iconEffective <= i.maxSizeEffective {
-		dt := i.sizeEffective - iconEffective
-		if dt < 0 {
-			return -dt
-		}
-
-		return dt
-	}
-
-	return math.MaxInt64
-}
-
-func (i *iconThemeDir) sizeDistanceOutside(iconSize int, iconScale int) int {
-	iconEffective := iconSize * iconScale
-
 	if iconEffective < i.minSizeEffective {
 		return i.minSizeEffective - iconEffective
 	}
@@ -79,9 +68,20 @@ func (i *iconThemeDir) sizeDistanceOutside(iconSize int, iconScale int) int {
 		return iconEffective - i.maxSizeEffective
 	}
 
-	if i.sizeEffective >= iconEffective {
-		return i.sizeEffective - iconEffective
+	return 0
+}
+
+// extRank orders the files of an icon in one dir, scalable dirs prefer SVG
+func (i *iconThemeDir) extRank(ext string) int {
+	exts := iconExtsOrder
+	if i.scalable {
+		exts = scalableIconExtsOrder
+	}
+	for rank, e := range exts {
+		if e == ext {
+			return rank
+		}
 	}
 
-	return iconEffective - i.sizeEffective
+	return len(exts)
 }
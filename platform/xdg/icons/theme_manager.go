@@ -4,19 +4,21 @@ import (
 	"path/filepath"
 
 	"github.com/Runix-Org/runix/platform/fs"
-	"github.com/Runix-Org/runix/platform/xdg/base"
 	"go.uber.org/zap"
 )
 
 type iconThemeMamager struct {
-	themes map[string]*iconTheme
-	logger *zap.Logger
+	// base dirs of the themes in order of preference, see base.GetIconSearchDirs
+	searchDirs []string
+	themes     map[string]*iconTheme
+	logger     *zap.Logger
 }
 
-func newIconThemeManager(logger *zap.Logger) *iconThemeMamager {
+func newIconThemeManager(searchDirs []string, logger *zap.Logger) *iconThemeMamager {
 	return &iconThemeMamager{
-		themes: make(map[string]*iconTheme),
-		logger: logger,
+		searchDirs: searchDirs,
+		themes:     make(map[string]*iconTheme),
+		logger:     logger,
 	}
 }
 
@@ -28,7 +30,7 @@ func (f *iconThemeMamager) loadTheme(themeName string) *iconTheme {
 	var ok bool
 	var theme *iconTheme
 	themeDirs := []string{}
-	for _, dir := range base.GetIconSearchDirs() {
+	for _, dir := range f.searchDirs {
 		themeDir := filepath.Join(dir, themeName)
 		if fs.ExistsDir(themeDir) {
 			themeDirs = append(themeDirs, themeDir)
@@ -52,27 +54,34 @@ func (f *iconThemeMamager) loadTheme(themeName string) *iconTheme {
 
 func (f *iconThemeMamager) loadThemesWithParents(themesName []string) []*iconTheme {
 	themes := []*iconTheme{}
-	namesIndex := map[string]struct{}{}
+	f.appendThemesWithParents(&themes, themesName, map[string]struct{}{})
 
+	return themes
+}
+
+// appendThemesWithParents adds each theme followed by its parents, namesIndex breaks inheritance cycles
+func (f *iconThemeMamager) appendThemesWithParents(themes *[]*iconTheme, themesName []string, namesIndex map[string]struct{}) {
 	for _, themeName := range themesName {
-		theme := f.loadTheme(themeName)
-		if theme == nil {
-			continue
-		}
 		if _, ok := namesIndex[themeName]; ok {
 			continue
 		}
-
-		themes = append(themes, theme)
 		namesIndex[themeName] = struct{}{}
 
-		for _, parentTheme := range f.loadThemesWithParents(theme.getParentNames()) {
-			if _, ok := namesIndex[parentTheme.getName()]; ok {
-				continue
-			}
-			themes = append(themes, parentTheme)
-			namesIndex[parentTheme.getName()] = struct{}{}
+		theme := f.loadTheme(themeName)
+		if theme == nil {
+			continue
 		}
+
+		*themes = append(*themes, theme)
+		f.appendThemesWithParents(themes, theme.getParentNames(), namesIndex)
+	}
+}
+
+// loadThemesByName loads themesName with their parents, missing themes are skipped
+func (f *iconThemeMamager) loadThemesByName(themesName []string) map[string]*iconTheme {
+	themes := make(map[string]*iconTheme)
+	for _, theme := range f.loadThemesWithParents(themesName) {
+		themes[theme.getName()] = theme
 	}
 
 	return themes
@@ -0,0 +1,361 @@
+package icons
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/Runix-Org/runix/platform/fs"
+	"github.com/Runix-Org/runix/platform/xdg/base"
+	"github.com/godbus/dbus/v5"
+	"go.uber.org/zap"
+	"golang.org/x/sys/unix"
+)
+
+const (
+	portalObjectPath  = dbus.ObjectPath("/org/freedesktop/portal/desktop")
+	portalSettings    = "org.freedesktop.portal.Settings"
+	portalSettingSig  = portalSettings + ".SettingChanged"
+	defaultWatchDelay = 500 * time.Millisecond
+
+	// Config files are often replaced by a rename
+	configWatchMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_CREATE | unix.IN_DELETE
+	// Themes and icons installed or removed by a package manager, and icon-theme.cache updates
+	iconWatchMask = unix.IN_CLOSE_WRITE | unix.IN_MOVED_TO | unix.IN_MOVED_FROM | unix.IN_CREATE | unix.IN_DELETE
+)
+
+// Portal settings that hold the icon theme, namespace => key
+var portalIconThemeKeys = map[string]string{
+	"org.gnome.desktop.interface": "icon-theme",
+	"org.kde.kdeglobals.Icons":    "Theme",
+}
+
+// ThemeChangedFunc is called with the current icon theme after the resolver is reset
+type ThemeChangedFunc func(theme string)
+
+type watchedDir struct {
+	path string
+	// names of the watched files in the dir, nil for every entry
+	names map[string]struct{}
+}
+
+// ThemeWatcher resets the resolver when the icon theme setting changes or icons are installed.
+// Bursts of changes are coalesced into one reset after delay.
+type ThemeWatcher struct {
+	resolver *IconResolver
+	delay    time.Duration
+
+	inotify *os.File
+	// raw fd of inotify for adding watches, File.Fd would make reads blocking
+	inotifyFd int
+	// watch descriptor => dir, guarded by mu
+	watches map[int]*watchedDir
+	conn    *dbus.Conn
+	// dbus.ConnectSessionBus, replaced in tests
+	connectBus func(opts ...dbus.ConnOption) (*dbus.Conn, error)
+
+	subscribers map[uint64]ThemeChangedFunc
+	nextID      uint64
+
+	trigger chan struct{}
+	done    chan struct{}
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	logger  *zap.Logger
+}
+
+func NewThemeWatcher(resolver *IconResolver, logger *zap.Logger) *ThemeWatcher {
+	return &ThemeWatcher{
+		resolver:    resolver,
+		delay:       defaultWatchDelay,
+		connectBus:  dbus.ConnectSessionBus,
+		watches:     make(map[int]*watchedDir),
+		subscribers: make(map[uint64]ThemeChangedFunc),
+		trigger:     make(chan struct{}, 1),
+		done:        make(chan struct{}),
+		logger:      logger.With(zap.String("task", "IconThemeWatcher")),
+	}
+}
+
+// Start watches the files and dirs, the portal is optional: without a session bus
+// only the config files of the desktops are watched
+func (w *ThemeWatcher) Start() error {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return fmt.Errorf("failed init inotify: %w", err)
+	}
+	// a non-blocking fd is handled by the runtime poller, Close interrupts Read
+	w.inotify = os.NewFile(uintptr(fd), "inotify")
+	w.inotifyFd = fd
+
+	for dir, names := range configWatchFiles() {
+		w.watch(dir, names, configWatchMask)
+	}
+	w.watchIconDirs()
+
+	if err := w.connectPortal(); err != nil {
+		w.logger.Info("Icon theme changes of the settings portal are not watched", zap.Error(err))
+	}
+
+	w.wg.Add(2)
+	go w.readInotify()
+	go w.run()
+
+	return nil
+}
+
+// Subscribe adds fn, called after every reset of the resolver, the returned func removes it
+func (w *ThemeWatcher) Subscribe(fn ThemeChangedFunc) func() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	id := w.nextID
+	w.nextID++
+	w.subscribers[id] = fn
+
+	return func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.subscribers, id)
+	}
+}
+
+func (w *ThemeWatcher) Close() {
+	select {
+	case <-w.done:
+		return
+	default:
+		close(w.done)
+	}
+
+	if w.conn != nil {
+		_ = w.conn.Close()
+	}
+	if w.inotify != nil {
+		_ = w.inotify.Close()
+	}
+	w.wg.Wait()
+}
+
+// configWatchFiles returns the settings files of the desktops by dir, see themeDetector
+func configWatchFiles() map[string][]string {
+	files := make(map[string][]string)
+	add := func(path string) {
+		dir := filepath.Dir(path)
+		files[dir] = append(files[dir], filepath.Base(path))
+	}
+
+	for _, name := range append(slices.Clone(kdeglobalsFiles), xfconfFile, lxqtFile) {
+		add(filepath.Join(base.GetConfigHome(), name))
+	}
+	home := fs.GetUserHome()
+	for _, gtkf := range gtkFiles {
+		add(filepath.Join(home, gtkf.Dir, gtkf.File))
+	}
+
+	return files
+}
+
+// watchIconDirs adds the dirs of the themes loaded by the last reset, the existing watches are kept
+func (w *ThemeWatcher) watchIconDirs() {
+	for _, dir := range w.resolver.watchDirs() {
+		w.watch(dir, nil, iconWatchMask)
+	}
+}
+
+// watch adds the dir, missing dirs are skipped
+func (w *ThemeWatcher) watch(dir string, names []string, mask uint32) {
+	wd, err := unix.InotifyAddWatch(w.inotifyFd, dir, mask|unix.IN_MASK_ADD|unix.IN_ONLYDIR)
+	if err != nil {
+		if !errors.Is(err, unix.ENOENT) && !errors.Is(err, unix.ENOTDIR) {
+			w.logger.Info("Failed watch dir", zap.String("path", dir), zap.Error(err))
+		}
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	watched, ok := w.watches[wd]
+	if !ok {
+		watched = &watchedDir{path: dir, names: make(map[string]struct{})}
+		w.watches[wd] = watched
+	}
+	if names == nil {
+		watched.names = nil
+	} else if watched.names != nil {
+		for _, name := range names {
+			watched.names[name] = struct{}{}
+		}
+	}
+}
+
+func (w *ThemeWatcher) connectPortal() error {
+	conn, err := w.connectBus()
+	if err != nil {
+		return err
+	}
+
+	err = conn.AddMatchSignal(
+		dbus.WithMatchObjectPath(portalObjectPath),
+		dbus.WithMatchInterface(portalSettings),
+		dbus.WithMatchMember("SettingChanged"),
+	)
+	if err != nil {
+		_ = conn.Close()
+		return err
+	}
+
+	signals := make(chan *dbus.Signal, 16)
+	conn.Signal(signals)
+	w.conn = conn
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		// the channel is closed with the connection
+		for signal := range signals {
+			w.handleSignal(signal)
+		}
+	}()
+
+	return nil
+}
+
+// handleSignal schedules a reset on SettingChanged(namespace, key, value) of the icon theme
+func (w *ThemeWatcher) handleSignal(signal *dbus.Signal) {
+	if signal.Name != portalSettingSig || len(signal.Body) < 2 {
+		return
+	}
+	namespace, _ := signal.Body[0].(string)
+	key, _ := signal.Body[1].(string)
+	if expected, ok := portalIconThemeKeys[namespace]; ok && key == expected {
+		w.logger.Debug("Icon theme setting changed", zap.String("namespace", namespace))
+		w.schedule()
+	}
+}
+
+func (w *ThemeWatcher) readInotify() {
+	defer w.wg.Done()
+
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.inotify.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				w.logger.Error("Failed read inotify events", zap.Error(err))
+			}
+			return
+		}
+		if w.handleEvents(buf[:n]) {
+			w.schedule()
+		}
+	}
+}
+
+// handleEvents reports whether any of the events is relevant
+func (w *ThemeWatcher) handleEvents(buf []byte) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	changed := false
+	for offset := 0; offset+unix.SizeofInotifyEvent <= len(buf); {
+		event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+		end := offset + unix.SizeofInotifyEvent + int(event.Len)
+		if end > len(buf) {
+			break
+		}
+		nameBytes := buf[offset+unix.SizeofInotifyEvent : end]
+		offset = end
+
+		if event.Mask&unix.IN_Q_OVERFLOW != 0 {
+			changed = true
+			continue
+		}
+		watched, ok := w.watches[int(event.Wd)]
+		if !ok {
+			continue
+		}
+		if event.Mask&unix.IN_IGNORED != 0 {
+			// the dir is removed, a reset watches it again if it comes back
+			delete(w.watches, int(event.Wd))
+			changed = true
+			continue
+		}
+
+		name := string(trimNull(nameBytes))
+		if watched.names == nil {
+			changed = true
+		} else if _, ok := watched.names[name]; ok {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+func (w *ThemeWatcher) schedule() {
+	select {
+	case w.trigger <- struct{}{}:
+	default:
+	}
+}
+
+// run resets the resolver once the changes stop for delay
+func (w *ThemeWatcher) run() {
+	defer w.wg.Done()
+
+	timer := time.NewTimer(w.delay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.trigger:
+			timer.Reset(w.delay)
+		case <-timer.C:
+			w.reload()
+		}
+	}
+}
+
+func (w *ThemeWatcher) reload() {
+	prev := w.resolver.CurrentTheme()
+	w.resolver.ResetCache()
+	theme := w.resolver.CurrentTheme()
+	w.watchIconDirs()
+
+	if theme != prev {
+		w.logger.Info("Icon theme changed", zap.String("from", prev), zap.String("to", theme))
+	} else {
+		w.logger.Debug("Icon dirs changed", zap.String("theme", theme))
+	}
+
+	w.mu.Lock()
+	subscribers := make([]ThemeChangedFunc, 0, len(w.subscribers))
+	for _, fn := range w.subscribers {
+		subscribers = append(subscribers, fn)
+	}
+	w.mu.Unlock()
+
+	for _, fn := range subscribers {
+		fn(theme)
+	}
+}
+
+func trimNull(b []byte) []byte {
+	for i, c := range b {
+		if c == 0 {
+			return b[:i]
+		}
+	}
+
+	return b
+}
@@ -0,0 +1,200 @@
+package icons
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Runix-Org/runix/platform/fs"
+	"github.com/Runix-Org/runix/platform/xdg/base"
+	"github.com/godbus/dbus/v5"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.uber.org/zap"
+)
+
+var testHome string
+
+// TestMain points the XDG dirs to testdata, the platform modules can be initialized only once
+func TestMain(m *testing.M) {
+	os.Exit(runWithFixture(m))
+}
+
+func runWithFixture(m *testing.M) int {
+	var err error
+	if testHome, err = os.MkdirTemp("", "icons"); err != nil {
+		panic(err)
+	}
+	defer os.RemoveAll(testHome)
+
+	testdata, err := filepath.Abs("testdata")
+	if err != nil {
+		panic(err)
+	}
+	for _, dir := range []string{".config/gtk-3.0", ".local/share/icons"} {
+		if err := os.MkdirAll(filepath.Join(testHome, dir), 0o755); err != nil {
+			panic(err)
+		}
+	}
+	writeGTKTheme("Child")
+
+	for key, value := range map[string]string{
+		"HOME":            testHome,
+		"XDG_DATA_HOME":   filepath.Join(testHome, ".local", "share"),
+		"XDG_CONFIG_HOME": filepath.Join(testHome, ".config"),
+		"XDG_CACHE_HOME":  filepath.Join(testHome, ".cache"),
+		"XDG_DATA_DIRS":   testdata,
+		// neither KDE nor GNOME, the theme is read from the GTK settings
+		"XDG_CURRENT_DESKTOP": "Fixture",
+	} {
+		os.Setenv(key, value)
+	}
+	if err := fs.InitFS(); err != nil {
+		panic(err)
+	}
+	if err := base.InitBase("runix"); err != nil {
+		panic(err)
+	}
+
+	return m.Run()
+}
+
+// writeGTKTheme replaces the settings file like the settings daemons do
+func writeGTKTheme(theme string) {
+	path := filepath.Join(testHome, ".config", "gtk-3.0", "settings.ini")
+	if err := os.WriteFile(path+".tmp", []byte("[Settings]\ngtk-icon-theme-name="+theme+"\n"), 0o644); err != nil {
+		panic(err)
+	}
+	if err := os.Rename(path+".tmp", path); err != nil {
+		panic(err)
+	}
+}
+
+type WatcherSuite struct {
+	suite.Suite
+	resolver *IconResolver
+	watcher  *ThemeWatcher
+	changes  chan string
+}
+
+func (s *WatcherSuite) SetupTest() {
+	writeGTKTheme("Child")
+	s.resolver = NewIconFinder(zap.NewNop())
+	s.watcher = NewThemeWatcher(s.resolver, zap.NewNop())
+	s.watcher.delay = 20 * time.Millisecond
+	s.watcher.connectBus = func(...dbus.ConnOption) (*dbus.Conn, error) {
+		return nil, errors.New("no session bus")
+	}
+	s.changes = make(chan string, 16)
+	s.watcher.Subscribe(func(theme string) { s.changes <- theme })
+}
+
+func (s *WatcherSuite) TearDownTest() {
+	s.watcher.Close()
+}
+
+func (s *WatcherSuite) waitChange() string {
+	select {
+	case theme := <-s.changes:
+		return theme
+	case <-time.After(5 * time.Second):
+		s.FailNow("no theme change")
+		return ""
+	}
+}
+
+func (s *WatcherSuite) TestSettingsFile() {
+	t := s.T()
+	require.Equal(t, "Child", s.resolver.CurrentTheme())
+	require.NoError(t, s.watcher.Start())
+
+	writeGTKTheme("Parent")
+	require.Equal(t, "Parent", s.waitChange())
+	require.Equal(t, "Parent", s.resolver.CurrentTheme())
+
+	// Child had a 16px variant, Parent has the exact size
+	iconPath, ok := s.resolver.Resolve("inherited", 32, 1)
+	require.True(t, ok)
+	require.Contains(t, iconPath, filepath.Join("Parent", "32x32"))
+}
+
+func (s *WatcherSuite) TestInstalledIcon() {
+	t := s.T()
+	require.NoError(t, s.watcher.Start())
+	_, ok := s.resolver.Resolve("installed-app", 48, 1)
+	require.False(t, ok)
+
+	// a package manager moves the files in place
+	staging := filepath.Join(t.TempDir(), "hicolor")
+	require.NoError(t, os.MkdirAll(filepath.Join(staging, "48x48", "apps"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(staging, "48x48", "apps", "installed-app.png"), nil, 0o644))
+	installed := filepath.Join(testHome, ".local", "share", "icons", "hicolor")
+	require.NoError(t, os.Rename(staging, installed))
+	defer os.RemoveAll(installed)
+
+	require.Equal(t, "Child", s.waitChange())
+	iconPath, ok := s.resolver.Resolve("installed-app", 48, 1)
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(installed, "48x48", "apps", "installed-app.png"), iconPath)
+}
+
+func (s *WatcherSuite) TestIconInThemeSubdir() {
+	t := s.T()
+	// the user part of the Child theme, loaded with the theme
+	appsDir := filepath.Join(testHome, ".local", "share", "icons", "Child", "48x48", "apps")
+	require.NoError(t, os.MkdirAll(appsDir, 0o755))
+	defer os.RemoveAll(filepath.Join(testHome, ".local", "share", "icons", "Child"))
+	s.resolver.ResetCache()
+	require.NoError(t, s.watcher.Start())
+
+	_, ok := s.resolver.Resolve("subdir-app", 48, 1)
+	require.False(t, ok)
+	require.NoError(t, os.WriteFile(filepath.Join(appsDir, "subdir-app.png"), nil, 0o644))
+
+	require.Equal(t, "Child", s.waitChange())
+	iconPath, ok := s.resolver.Resolve("subdir-app", 48, 1)
+	require.True(t, ok)
+	require.Equal(t, filepath.Join(appsDir, "subdir-app.png"), iconPath)
+}
+
+func (s *WatcherSuite) TestPortalSignal() {
+	t := s.T()
+
+	signal := func(namespace string, key string) *dbus.Signal {
+		return &dbus.Signal{
+			Path: portalObjectPath,
+			Name: portalSettingSig,
+			Body: []any{namespace, key, dbus.MakeVariant("Parent")},
+		}
+	}
+
+	// not started, the trigger is not consumed
+	s.watcher.handleSignal(signal("org.gnome.desktop.interface", "font-name"))
+	s.watcher.handleSignal(signal("org.gnome.desktop.background", "icon-theme"))
+	s.watcher.handleSignal(&dbus.Signal{Name: portalSettingSig, Body: []any{1, 2}})
+	require.Empty(t, s.watcher.trigger)
+
+	s.watcher.handleSignal(signal("org.gnome.desktop.interface", "icon-theme"))
+	require.Len(t, s.watcher.trigger, 1)
+	<-s.watcher.trigger
+	s.watcher.handleSignal(signal("org.kde.kdeglobals.Icons", "Theme"))
+	require.Len(t, s.watcher.trigger, 1)
+}
+
+func (s *WatcherSuite) TestUnsubscribe() {
+	t := s.T()
+
+	calls := 0
+	unsubscribe := s.watcher.Subscribe(func(string) { calls++ })
+	s.watcher.reload()
+	unsubscribe()
+	s.watcher.reload()
+	require.Equal(t, 1, calls)
+	require.Len(t, s.changes, 2)
+}
+
+func TestWatcher(t *testing.T) {
+	suite.Run(t, new(WatcherSuite))
+}